@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"code.cloudfoundry.org/cli/plugin"
+
+	"github.com/svrc-pivotal/cf-report-buildpacks/pkg/report"
+)
+
+type reportBuildpacks struct{}
+
+func (c *reportBuildpacks) Run(cliConnection plugin.CliConnection, args []string) {
+	report.Run(pluginConnection{cliConnection}, args)
+}
+
+// pluginConnection adds the cf CLI's target to its connection, for -current
+type pluginConnection struct {
+	plugin.CliConnection
+}
+
+func (pc pluginConnection) CurrentTarget() (*report.Target, error) {
+	org, err := pc.GetCurrentOrg()
+	if err != nil {
+		return nil, err
+	}
+	space, err := pc.GetCurrentSpace()
+	if err != nil {
+		return nil, err
+	}
+	return &report.Target{OrgGuid: org.Guid, OrgName: org.Name, SpaceGuid: space.Guid, SpaceName: space.Name}, nil
+}
+
+func (c *reportBuildpacks) GetMetadata() plugin.PluginMetadata {
+	buildpacksOptions := report.UsageOptions("output-cyclonedx", "output-sarif", "output-xlsx", "output-template", "emit-restage-script", "group-by", "include-contacts", "include-routes", "include-services", "include-revisions", "include-tasks", "include-sidecars", "include-health", "include-events", "metadata-columns", "memory-breakdown", "check-latest", "check-latest-behind", "github-api", "check-pivnet", "pivnet-token", "pivnet-api", "advisories", "max-droplet-age", "skip-in-flight", "buildpack", "anonymize", "flag-autodetect", "deprecated-stacks", "policy", "fail-on-policy", "stream", "resume", "history-file", "since", "change", "foundations", "serve", "serve-interval", "watch", "watch-output", "watch-max-size", "watch-keep", "notify-slack", "post-url", "post-header", "post-token", "export-elasticsearch", "elasticsearch-api-key", "export-splunk-hec", "splunk-token", "export-datadog", "datadog-api-key", "datadog-site", "email-to", "email-from", "email-format", "smtp-addr", "tag-apps", "restage", "dry-run", "yes", "restage-max-parallel", "restage-per-space")
+	return plugin.PluginMetadata{
+		Name: "report-buildpacks",
+		Version: plugin.VersionType{
+			Major: 0,
+			Minor: 2,
+			Build: 0,
+		},
+		MinCliVersion: plugin.VersionType{
+			Major: 6,
+			Minor: 7,
+			Build: 0,
+		},
+		Commands: []plugin.Command{
+			{
+				Name:     "report-buildpacks",
+				HelpText: "Report all buildpacks used in installation",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-buildpacks [-org ORG] [-space SPACE] [-restage [-dry-run]]\n   cf report-buildpacks diff [-output-json|-output-csv] OLD.json NEW.json\n   cf report-buildpacks history [-since 30d] [-change CHANGE] HISTORY",
+					Options: buildpacksOptions,
+				},
+			},
+			{
+				Name:     "report-orphaned-buildpacks",
+				HelpText: "Report installed buildpacks that no app's current droplet uses",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-orphaned-buildpacks",
+					Options: report.UsageOptions(),
+				},
+			},
+			{
+				Name:     "report-buildpack-order",
+				HelpText: "Report installed buildpacks in detection order, flagging positions that cause apps to be detected wrongly",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-buildpack-order [-attention-only]",
+					Options: report.UsageOptions(),
+				},
+			},
+			{
+				Name:     "report-stacks",
+				HelpText: "Report the stack used by all apps in installation",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-stacks [-org ORG] [-space SPACE]",
+					Options: report.UsageOptions("deprecated-stacks"),
+				},
+			},
+			{
+				Name:     "report-services",
+				HelpText: "Report the service instances in all spaces in installation, and the apps bound to them",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-services [-org ORG] [-space SPACE]",
+					Options: report.UsageOptions(),
+				},
+			},
+			{
+				Name:     "report-docker",
+				HelpText: "Report the image of all docker apps in installation, and whether it is pulled with credentials",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-docker [-org ORG] [-space SPACE]",
+					Options: report.UsageOptions(),
+				},
+			},
+			{
+				Name:     "report-quotas",
+				HelpText: "Report the quota of all orgs and spaces in installation, and the memory and instances used",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-quotas [-org ORG] [-space SPACE]",
+					Options: report.UsageOptions(),
+				},
+			},
+			{
+				Name:     "report-users",
+				HelpText: "Report the roles users have in all orgs and spaces in installation",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-users [-org ORG] [-space SPACE]",
+					Options: report.UsageOptions(),
+				},
+			},
+			{
+				Name:     "report-isolation-segments",
+				HelpText: "Report the isolation segment of all apps in installation, flagging those their org is not entitled to",
+				UsageDetails: plugin.Usage{
+					Usage:   "cf report-isolation-segments [-org ORG] [-space SPACE]",
+					Options: report.UsageOptions(),
+				},
+			},
+		},
+	}
+}
+
+// isPort returns true if s is a port number, as passed to plugins by the cf CLI
+func isPort(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
+
+func main() {
+	// the cf CLI runs plugins with the port to talk back to it on first
+	if len(os.Args) >= 2 && isPort(os.Args[1]) {
+		plugin.Start(&reportBuildpacks{})
+		return
+	}
+	report.RunStandalone(os.Args[1:])
+}
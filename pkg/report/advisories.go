@@ -0,0 +1,125 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// advisory is a known vulnerability in a range of versions of a buildpack
+type advisory struct {
+	// ID - eg a CVE identifier
+	ID string `json:"id"`
+
+	// Buildpack - name of the affected buildpack, eg java_buildpack
+	Buildpack string `json:"buildpack"`
+
+	// IntroducedIn - first affected version, if not set all versions before FixedIn are affected
+	IntroducedIn string `json:"introduced_in,omitempty"`
+
+	// FixedIn - first version that is not affected, if not set no version is fixed
+	FixedIn string `json:"fixed_in,omitempty"`
+
+	Severity string `json:"severity,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// affects returns true if version of the buildpack name is vulnerable
+func (a *advisory) affects(name, version string) bool {
+	if buildpackRepo(a.Buildpack) != buildpackRepo(name) {
+		return false
+	}
+	if a.IntroducedIn != "" && compareVersions(version, a.IntroducedIn) < 0 {
+		return false
+	}
+	if a.FixedIn != "" && compareVersions(version, a.FixedIn) >= 0 {
+		return false
+	}
+	return true
+}
+
+// advisorySource provides advisories, eg from a file or a feed
+type advisorySource interface {
+	Advisories() ([]*advisory, error)
+}
+
+// newAdvisorySource returns a source reading advisories from location, which
+// may be a http(s) URL or a path to a local JSON file
+func newAdvisorySource(location string) advisorySource {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return urlAdvisories(location)
+	}
+	return fileAdvisories(location)
+}
+
+// fileAdvisories reads a JSON array of advisories from a file
+type fileAdvisories string
+
+func (fa fileAdvisories) Advisories() ([]*advisory, error) {
+	f, err := os.Open(string(fa))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeAdvisories(string(fa), f)
+}
+
+// urlAdvisories fetches a JSON array of advisories from a URL
+type urlAdvisories string
+
+func (ua urlAdvisories) Advisories() ([]*advisory, error) {
+	resp, err := externalClient.Get(string(ua))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, newAPIError(http.MethodGet, string(ua), resp)
+	}
+	return decodeAdvisories(string(ua), resp.Body)
+}
+
+func decodeAdvisories(location string, r io.Reader) ([]*advisory, error) {
+	var rv []*advisory
+	err := json.NewDecoder(r).Decode(&rv)
+	if err != nil {
+		return nil, fmt.Errorf("reading advisories from %s: %s", location, err)
+	}
+	return rv, nil
+}
+
+// advisoryIndex matches staged buildpacks against advisories
+type advisoryIndex struct {
+	advisories []*advisory
+}
+
+func loadAdvisories(src advisorySource) (*advisoryIndex, error) {
+	advisories, err := src.Advisories()
+	if err != nil {
+		return nil, err
+	}
+	return &advisoryIndex{advisories: advisories}, nil
+}
+
+// check returns the IDs of the advisories affecting staged, and a reason for
+// each buildpack that is affected
+func (ai *advisoryIndex) check(staged []stagedBuildpack) ([]string, []*reason) {
+	var ids []string
+	var reasons []*reason
+	for _, bp := range staged {
+		var bpIDs []string
+		for _, a := range ai.advisories {
+			if a.affects(bp.name, bp.version) {
+				bpIDs = append(bpIDs, a.ID)
+			}
+		}
+		if len(bpIDs) != 0 {
+			ids = append(ids, bpIDs...)
+			reasons = append(reasons, newReason(reasonVulnerable, "%s v%s is affected by %s", bp.name, bp.version, strings.Join(bpIDs, ", ")))
+		}
+	}
+	return ids, reasons
+}
@@ -0,0 +1,47 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// anonymousName returns a stable stand-in for the kind of resource at path,
+// eg "app-1a2b3c4d" for the app at []string{org, space, app}. The whole path
+// is hashed so that, eg, spaces called "dev" in different orgs differ.
+func anonymousName(kind string, path ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(path, "/")))
+	return kind + "-" + hex.EncodeToString(sum[:4])
+}
+
+// anonymize replaces the names in info, and anything else that could reveal
+// internal naming, with stable hashes, for -anonymize. Buildpacks, versions,
+// memory and reasons are kept.
+func (info *AppBuildpackInfo) anonymize() {
+	org, space, app := info.Organization, info.Space, info.Application
+	info.Organization = anonymousName("org", org)
+	info.Space = anonymousName("space", org, space)
+	info.Application = anonymousName("app", org, space, app)
+	info.OrgGUID, info.SpaceGUID, info.AppGUID = "", "", ""
+
+	for i, c := range info.Contacts {
+		info.Contacts[i] = anonymousName("user", c)
+	}
+	for i, r := range info.Routes {
+		info.Routes[i] = anonymousName("route", r)
+	}
+	for i, s := range info.Services {
+		info.Services[i] = anonymousName("service", org, space, s)
+	}
+	if info.LastEvent != nil {
+		e := *info.LastEvent
+		e.Actor = anonymousName("user", e.Actor)
+		info.LastEvent = &e
+	}
+	for k, v := range info.Metadata {
+		info.Metadata[k] = anonymousName(k, v)
+	}
+	if info.DockerImage != "" {
+		info.DockerImage = anonymousName("image", info.DockerImage)
+	}
+}
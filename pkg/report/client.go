@@ -0,0 +1,653 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// simpleClient is a simple CloudFoundry client
+type simpleClient struct {
+	// API url, ie "https://api.system.example.com"
+	API string
+
+	// Authorization header, ie "bearer eyXXXXX"
+	Authorization string
+
+	// RefreshAuthorization - if set, called to get a new Authorization header
+	// when a request fails with 401, ie because the token has expired
+	RefreshAuthorization func() (string, error)
+
+	// authMu guards Authorization once requests are in flight
+	authMu sync.Mutex
+
+	// Quiet - if set don't print progress to stderr
+	Quiet bool
+
+	// Client - http.Client to use
+	Client *http.Client
+
+	// Concurrency - maximum number of requests Parallel will have in flight
+	Concurrency int
+
+	// Retries - number of times to retry a request that fails with a transient error
+	Retries int
+
+	// RetryBackoff - wait before the first retry, doubled for each subsequent retry
+	RetryBackoff time.Duration
+
+	// Stats - if set, requests, retries and rate limiting are counted here
+	Stats *runStats
+
+	// Tracer - if set, spans are recorded here for each phase of collecting
+	// and each request
+	Tracer *otelTracer
+
+	// RateLimit - if set, requests are spaced out to stay within its rate
+	RateLimit *rateLimiter
+
+	// ResultsPerPage - if set, the size of the pages listed, capped at the
+	// most each API version allows, which is used if not set
+	ResultsPerPage int
+
+	// Context - if set, requests in flight are cancelled and no more are
+	// made once it is done, eg on Ctrl-C
+	Context context.Context
+
+	// inaccessible - the orgs and spaces skipped because the user isn't
+	// permitted to read them, shared with the clients made by withContext
+	inaccessibleMu sync.Mutex
+	inaccessible   *inaccessibleCounts
+}
+
+// context returns sc.Context, or a context that is never done if not set
+func (sc *simpleClient) context() context.Context {
+	if sc.Context == nil {
+		return context.Background()
+	}
+	return sc.Context
+}
+
+// phase starts timing the named phase of collecting for -stats and tracing,
+// and returns a func to call when it ends
+func (sc *simpleClient) phase(name string) func() {
+	endStats := sc.Stats.phase(name)
+	endSpan := sc.Tracer.phaseSpan(name)
+	return func() {
+		endSpan()
+		endStats()
+	}
+}
+
+// withContext returns a client with the same settings as sc, whose requests
+// are cancelled when ctx is done
+func (sc *simpleClient) withContext(ctx context.Context) *simpleClient {
+	return &simpleClient{
+		API:                  sc.API,
+		Authorization:        sc.authorization(),
+		RefreshAuthorization: sc.RefreshAuthorization,
+		Quiet:                sc.Quiet,
+		Client:               sc.Client,
+		Concurrency:          sc.Concurrency,
+		Retries:              sc.Retries,
+		RetryBackoff:         sc.RetryBackoff,
+		Stats:                sc.Stats,
+		Tracer:               sc.Tracer,
+		RateLimit:            sc.RateLimit,
+		ResultsPerPage:       sc.ResultsPerPage,
+		Context:              ctx,
+		inaccessible:         sc.inaccessibleCounts(),
+	}
+}
+
+// interrupted returns true if sc.Context is done
+func (sc *simpleClient) interrupted() bool {
+	return sc.context().Err() != nil
+}
+
+// Get makes a GET request, where r is the relative path, and rv is json.Unmarshalled to.
+// r may also be an absolute URL on the API, as returned in v3 pagination links
+func (sc *simpleClient) Get(r string, rv interface{}) error {
+	return sc.Do(http.MethodGet, r, nil, rv)
+}
+
+// Do makes a request with the given method, where r is the relative path (or
+// absolute URL on the API), body if not nil is sent as JSON, and rv if not nil
+// is json.Unmarshalled to
+func (sc *simpleClient) Do(method, r string, body, rv interface{}) error {
+	u := r
+	if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+		u = sc.API + r
+	}
+
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		auth := sc.authorization()
+		err := sc.do(method, u, auth, b, rv)
+		ae, ok := err.(*apiError)
+		if ok && ae.StatusCode == http.StatusUnauthorized && sc.RefreshAuthorization != nil && !refreshed {
+			refreshed = true
+			err = sc.refreshAuthorization(auth)
+			if err != nil {
+				return err
+			}
+			attempt--
+			continue
+		}
+		re, ok := err.(*retryableError)
+		if !ok {
+			return err
+		}
+		if attempt >= sc.Retries {
+			return re.err
+		}
+		sc.Stats.retry()
+
+		wait := re.after
+		if wait == 0 {
+			wait = sc.RetryBackoff << uint(attempt)
+			if wait > maxRetryBackoff {
+				wait = maxRetryBackoff
+			}
+		}
+		if !sc.Quiet {
+			logf(levelWarn, logFields{"method": method, "url": u, "retry_in": wait.Seconds()}, "%s %s failed (%s), retrying in %s", method, u, re.err, wait)
+		}
+		select {
+		case <-time.After(wait):
+		case <-sc.context().Done():
+			return sc.context().Err()
+		}
+	}
+}
+
+// authorization returns the current Authorization header
+func (sc *simpleClient) authorization() string {
+	sc.authMu.Lock()
+	defer sc.authMu.Unlock()
+	return sc.Authorization
+}
+
+// refreshAuthorization replaces the Authorization header, unless it has
+// already been replaced since old was used by a concurrent request
+func (sc *simpleClient) refreshAuthorization(old string) error {
+	sc.authMu.Lock()
+	defer sc.authMu.Unlock()
+	if sc.Authorization != old {
+		return nil
+	}
+	if !sc.Quiet {
+		logf(levelWarn, nil, "access token rejected, refreshing...")
+	}
+	auth, err := sc.RefreshAuthorization()
+	if err != nil {
+		return err
+	}
+	sc.Authorization = auth
+	return nil
+}
+
+// maxRetryBackoff caps the exponential backoff between retries
+const maxRetryBackoff = time.Minute
+
+// retryableError is returned for requests that may succeed if made again
+type retryableError struct {
+	err error
+
+	// after - if set, how long the server asked us to wait before retrying
+	after time.Duration
+}
+
+func (re *retryableError) Error() string {
+	return re.err.Error()
+}
+
+// do makes a single attempt at a request for Do, returning a *retryableError
+// if the request failed in a way that may succeed if retried. Requests other
+// than GET are only retried if rate limited, as they may not be idempotent.
+func (sc *simpleClient) do(method, u, auth string, b []byte, rv interface{}) (err error) {
+	sc.Stats.request()
+	status := 0
+	if sc.Tracer != nil {
+		start := time.Now()
+		defer func() {
+			sc.Tracer.request(method, u, status, start, err)
+		}()
+	}
+	if !sc.Quiet && jsonLogger == nil {
+		log.Printf("%s %s", method, u)
+	}
+	if !sc.Quiet && jsonLogger != nil {
+		// logged once complete, so that the status and duration are known
+		start := time.Now()
+		defer func() {
+			fields := logFields{"method": method, "url": u, "status": status, "duration": time.Since(start).Seconds()}
+			if err != nil {
+				fields["error"] = err.Error()
+				logf(levelError, fields, "%s %s failed", method, u)
+				return
+			}
+			logf(levelInfo, fields, "%s %s", method, u)
+		}()
+	}
+
+	err = sc.RateLimit.wait(sc.context())
+	if err != nil {
+		return err
+	}
+
+	var reqBody io.Reader
+	if b != nil {
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(sc.context(), method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	if b != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := sc.Client.Do(req)
+	if err != nil {
+		if sc.interrupted() {
+			return sc.context().Err()
+		}
+		if method == http.MethodGet {
+			return &retryableError{err: err}
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	if resp.StatusCode/100 != 2 {
+		apiErr := newAPIError(method, u, resp)
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			sc.Stats.rateLimit()
+			return &retryableError{
+				err:   apiErr,
+				after: parseRetryAfter(resp.Header.Get("Retry-After")),
+			}
+		case resp.StatusCode/100 == 5 && method == http.MethodGet:
+			return &retryableError{err: apiErr}
+		default:
+			return apiErr
+		}
+	}
+
+	if rv == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(rv)
+}
+
+// rateLimiter spaces out requests so that no more than a given number are
+// started each second, however many are made in parallel
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter returns a limiter of perSecond requests a second, or nil,
+// which doesn't limit requests, if perSecond isn't positive
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next request may be made, or ctx is done
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	if rl == nil {
+		return nil
+	}
+	rl.mu.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	at := rl.next
+	rl.next = rl.next.Add(rl.interval)
+	rl.mu.Unlock()
+
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseRetryAfter returns the wait requested by a Retry-After header, which
+// is either a number of seconds or a date, or 0 if there is none
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	secs, err := strconv.Atoi(v)
+	if err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	t, err := http.ParseTime(v)
+	if err == nil && t.After(time.Now()) {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// The most results per page the v2 and v3 APIs allow
+const (
+	maxResultsPerPageV2 = 100
+	maxResultsPerPageV3 = 5000
+)
+
+// withPageSize adds the page size to r, the first page of a listing, unless
+// it is already set. Fewer, larger pages mean fewer round trips. The next
+// pages listed by the API keep the same size.
+func withPageSize(client CloudControllerClient, r string) string {
+	u, err := url.Parse(r)
+	if err != nil {
+		return r
+	}
+	param, max := "per_page", maxResultsPerPageV3
+	if strings.HasPrefix(u.Path, "/v2/") {
+		param, max = "results-per-page", maxResultsPerPageV2
+	}
+	if u.Query().Get(param) != "" {
+		return r
+	}
+
+	n := max
+	if sc, ok := client.(*simpleClient); ok && sc.ResultsPerPage > 0 && sc.ResultsPerPage < max {
+		n = sc.ResultsPerPage
+	}
+	sep := "?"
+	if strings.Contains(r, "?") {
+		sep = "&"
+	}
+	return r + sep + param + "=" + strconv.Itoa(n)
+}
+
+// List makes a GET request, to list resources, where we will follow the "next_url"
+// to page results, and calls "f" as a callback to process each resource found
+func (sc *simpleClient) List(r string, f func(*Resource) error) error {
+	r = withPageSize(sc, r)
+	for r != "" {
+		var res struct {
+			NextURL   string `json:"next_url"`
+			Resources []*Resource
+		}
+		err := sc.Get(r, &res)
+		if err != nil {
+			return err
+		}
+
+		for _, rr := range res.Resources {
+			err = f(rr)
+			if err != nil {
+				return err
+			}
+		}
+
+		r = res.NextURL
+	}
+	return nil
+}
+
+// ListV3 makes a GET request to list v3 resources, following "pagination.next.href"
+// to page results, and calls "f" with the raw JSON of each resource found
+func (sc *simpleClient) ListV3(r string, f func(json.RawMessage) error) error {
+	r = withPageSize(sc, r)
+	for r != "" {
+		var res struct {
+			Pagination struct {
+				Next *struct {
+					Href string `json:"href"`
+				} `json:"next"`
+			} `json:"pagination"`
+			Resources []json.RawMessage `json:"resources"`
+		}
+		err := sc.Get(r, &res)
+		if err != nil {
+			return err
+		}
+
+		for _, rr := range res.Resources {
+			err = f(rr)
+			if err != nil {
+				return err
+			}
+		}
+
+		r = ""
+		if res.Pagination.Next != nil {
+			r = res.Pagination.Next.Href
+		}
+	}
+	return nil
+}
+
+// CurrentDroplet fetches the current droplet of the app with appGuid, which
+// is only available from the v3 API
+func (sc *simpleClient) CurrentDroplet(appGuid string) (*Droplet, error) {
+	var rv Droplet
+	err := sc.Get(fmt.Sprintf("/v3/apps/%s/droplets/current", appGuid), &rv)
+	if err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
+
+// Parallel calls f once for each i in [0, n) using a pool of sc.Concurrency
+// workers, and returns the first error returned by f, if any. Once an error
+// has been seen, or sc.Context is done, no further calls to f are started.
+func (sc *simpleClient) Parallel(n int, f func(i int) error) error {
+	err := parallel(sc.Concurrency, n, func(i int) error {
+		if sc.interrupted() {
+			return sc.context().Err()
+		}
+		return f(i)
+	})
+	if err == nil && sc.interrupted() {
+		return sc.context().Err()
+	}
+	return err
+}
+
+// parallel calls f once for each i in [0, n) using a pool of workers, and
+// returns the first error returned by f, if any. Once an error has been
+// seen, no further calls to f are started.
+func parallel(workers, n int, f func(i int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := f(i)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// loadCACerts returns the system cert pool with the PEM encoded certificates
+// in path added
+func loadCACerts(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// parseProxy parses a proxy URL, which may be given as just host:port
+func parseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %s", proxy, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: no host", proxy)
+	}
+	return u, nil
+}
+
+// Connection is the part of plugin.CliConnection used to call the API, so
+// that the plugin can also run standalone
+type Connection interface {
+	AccessToken() (string, error)
+	ApiEndpoint() (string, error)
+	IsSSLDisabled() (bool, error)
+}
+
+// defaultConcurrency is the number of requests made in parallel unless
+// -concurrency is set
+const defaultConcurrency = 10
+
+// newSimpleClient returns a client for the API the connection is logged in
+// to. If caCert is set the API's certificate is verified against the
+// certificates in that file, as well as the system's. Requests are sent
+// through proxy if set, otherwise through the proxy given by HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY.
+func newSimpleClient(conn Connection, quiet bool, concurrency int, caCert, proxy string) (*simpleClient, error) {
+	api, err := conn.ApiEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	skipSSL, err := conn.IsSSLDisabled()
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := newHTTPClient(skipSSL, quiet, caCert, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	// a standalone connection fetches tokens itself, so needs the same TLS
+	// and proxy settings as the API
+	if sc, ok := conn.(*standaloneConnection); ok {
+		sc.Client = httpClient
+	}
+
+	at, err := conn.AccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &simpleClient{
+		API:           api,
+		Authorization: at,
+		Quiet:         quiet,
+		Client:        httpClient,
+		Concurrency:   concurrency,
+		RetryBackoff:  time.Second,
+
+		// the connection refreshes the token if it has expired
+		RefreshAuthorization: conn.AccessToken,
+	}, nil
+}
+
+// newHTTPClient returns a http.Client for the API, see newSimpleClient
+func newHTTPClient(skipSSL, quiet bool, caCert, proxy string) (*http.Client, error) {
+	// cloned from the default transport so it keeps its proxy, timeouts and
+	// connection pooling settings
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := parseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	switch {
+	case skipSSL:
+		if !quiet {
+			logf(levelWarn, nil, "warning: skipping TLS validation...")
+		}
+
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true,
+		}
+	case caCert != "":
+		pool, err := loadCACerts(caCert)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &http.Client{Transport: transport}, nil
+}
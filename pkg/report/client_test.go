@@ -0,0 +1,130 @@
+package report
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/svrc-pivotal/cf-report-buildpacks/pkg/report/reporttest"
+)
+
+// newTestClient returns a client of the fake API srv, which fails tests
+// rather than retrying slowly
+func newTestClient(t *testing.T, srv *reporttest.Server) *simpleClient {
+	t.Helper()
+	client, err := newSimpleClient(srv.Connection(), true, 2, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryBackoff = time.Millisecond
+	return client
+}
+
+func TestList(t *testing.T) {
+	srv := reporttest.NewServer(map[string]string{
+		"/v2/apps":        `{"next_url":"/v2/apps?page=2","resources":[{"metadata":{"guid":"a1"}}]}`,
+		"/v2/apps?page=2": `{"next_url":null,"resources":[{"metadata":{"guid":"a2"}},{"metadata":{"guid":"a3"}}]}`,
+	})
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	var guids []string
+	err := client.List("/v2/apps", func(r *Resource) error {
+		guids = append(guids, r.Metadata.Guid)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(guids, ","); got != "a1,a2,a3" {
+		t.Errorf("listed %s, want a1,a2,a3", got)
+	}
+	if got := srv.Requests(); len(got) != 2 || !strings.Contains(got[0], "results-per-page=") {
+		t.Errorf("got requests %q, want 2 pages with a page size", got)
+	}
+}
+
+func TestListV3(t *testing.T) {
+	srv := reporttest.NewServer(map[string]string{
+		"/v3/apps":        `{"pagination":{"next":{"href":"SERVER/v3/apps?page=2"}},"resources":[{"guid":"a1"}]}`,
+		"/v3/apps?page=2": `{"pagination":{"next":null},"resources":[{"guid":"a2"}]}`,
+	})
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	var guids []string
+	err := client.ListV3("/v3/apps", func(raw json.RawMessage) error {
+		var vr v3Resource
+		err := json.Unmarshal(raw, &vr)
+		guids = append(guids, vr.Guid)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(guids, ","); got != "a1,a2" {
+		t.Errorf("listed %s, want a1,a2", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	srv := reporttest.NewServer(map[string]string{"/v2/info": `{}`})
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	client.Retries = 2
+
+	srv.Fail("/v2/info", http.StatusBadGateway, 2)
+	if err := client.Get("/v2/info", nil); err != nil {
+		t.Errorf("got %v, want success on the last retry", err)
+	}
+	if got := len(srv.Requests()); got != 3 {
+		t.Errorf("made %d requests, want 3", got)
+	}
+
+	srv.Fail("/v2/info", http.StatusBadGateway, 3)
+	err := client.Get("/v2/info", nil)
+	if ae, ok := err.(*apiError); !ok || ae.StatusCode != http.StatusBadGateway {
+		t.Errorf("got %v, want 502 once out of retries", err)
+	}
+
+	// other requests may not be idempotent, so aren't retried
+	srv.Fail("/v2/info", http.StatusBadGateway, 1)
+	before := len(srv.Requests())
+	if err := client.Do(http.MethodPost, "/v2/info", nil, nil); err == nil {
+		t.Error("POST succeeded, want it failed without retrying")
+	}
+	if got := len(srv.Requests()) - before; got != 1 {
+		t.Errorf("POST made %d requests, want 1", got)
+	}
+}
+
+func TestRefreshAuthorization(t *testing.T) {
+	srv := reporttest.NewServer(map[string]string{"/v2/info": `{}`})
+	defer srv.Close()
+	client := newTestClient(t, srv)
+	refreshed := 0
+	client.RefreshAuthorization = func() (string, error) {
+		refreshed++
+		return "bearer new", nil
+	}
+
+	srv.Fail("/v2/info", http.StatusUnauthorized, 1)
+	if err := client.Get("/v2/info", nil); err != nil {
+		t.Errorf("got %v, want success with the refreshed token", err)
+	}
+	if refreshed != 1 || client.authorization() != "bearer new" {
+		t.Errorf("refreshed %d times to %q, want once to bearer new", refreshed, client.authorization())
+	}
+
+	// the token is only refreshed once for each request
+	srv.Fail("/v2/info", http.StatusUnauthorized, 2)
+	err := client.Get("/v2/info", nil)
+	if ae, ok := err.(*apiError); !ok || ae.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %v, want 401 once refreshed", err)
+	}
+	if refreshed != 2 {
+		t.Errorf("refreshed %d times, want 2", refreshed)
+	}
+}
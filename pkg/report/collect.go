@@ -0,0 +1,864 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AppBuildpackInfo is a row of the report, describing the buildpacks one app
+// was staged with
+type AppBuildpackInfo struct {
+	// Foundation - name of the foundation the app is on, if -foundations is set
+	Foundation string `json:"foundation,omitempty"`
+
+	Organization string `json:"organization"`
+	Space        string `json:"space"`
+	Application  string `json:"application"`
+
+	// OrgGUID, SpaceGUID and AppGUID - identify the app, and the space and
+	// org it is in, so it can be acted on without looking up its name
+	OrgGUID   string `json:"org_guid,omitempty"`
+	SpaceGUID string `json:"space_guid,omitempty"`
+	AppGUID   string `json:"app_guid,omitempty"`
+
+	State       string   `json:"state"`
+	Lifecycle   string   `json:"lifecycle"`
+	DockerImage string   `json:"docker_image,omitempty"`
+	Buildpacks  []string `json:"buildpacks,omitempty"`
+
+	// BuildpackNames - names of the buildpacks the app was staged with, or
+	// requested if it has not been staged
+	BuildpackNames []string `json:"buildpack_names,omitempty"`
+
+	// AutoDetected - set if the app doesn't request any buildpacks, so they
+	// are detected when it is staged, and can change with the buildpack order
+	AutoDetected bool `json:"auto_detected,omitempty"`
+
+	// BuildpackGUIDs - GUIDs of the installed buildpacks in BuildpackNames,
+	// by name
+	BuildpackGUIDs map[string]string `json:"buildpack_guids,omitempty"`
+
+	// Stack - the stack the droplet was staged for, or else the app's stack
+	Stack string `json:"stack,omitempty"`
+
+	TotalMemory string `json:"total_memory,omitempty"`
+
+	// ProcessMemory - TotalMemory broken down by type of process, in MB
+	ProcessMemory map[string]int64 `json:"process_memory,omitempty"`
+
+	// CustomBuildpacks - buildpacks given by URL rather than installed by an admin
+	CustomBuildpacks []*customBuildpack `json:"custom_buildpacks,omitempty"`
+
+	// LastStaged - when the current droplet was created
+	LastStaged *time.Time `json:"last_staged,omitempty"`
+
+	// StalenessDays - how many days the current droplet predates the most
+	// recent update of an installed buildpack it was staged with
+	StalenessDays int `json:"staleness_days,omitempty"`
+
+	Reasons []*reason `json:"reasons,omitempty"`
+
+	// Contacts - usernames of the space's developers and managers, if
+	// -include-contacts is set
+	Contacts []string `json:"contacts,omitempty"`
+
+	// Routes - URLs of the routes mapped to the app, if -include-routes is
+	// set
+	Routes []string `json:"routes,omitempty"`
+
+	// Services - names of the service instances bound to the app, if
+	// -include-services is set
+	Services []string `json:"services,omitempty"`
+
+	// Revisions - the app's most recent revisions, if -include-revisions is
+	// set
+	Revisions []*Revision `json:"revisions,omitempty"`
+
+	// LastEvent - who last pushed, restaged, restarted or started the app,
+	// and when, if -include-events is set
+	LastEvent *AppEvent `json:"last_event,omitempty"`
+
+	// Metadata - the app's labels or annotations named by -metadata-columns,
+	// by key
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Tasks - the app's most recent tasks, if -include-tasks is set
+	Tasks []*Task `json:"tasks,omitempty"`
+
+	// Sidecars - the app's sidecars, if -include-sidecars is set, whose
+	// memory is included in TotalMemory
+	Sidecars []*Sidecar `json:"sidecars,omitempty"`
+
+	// Health - the app's health check type and instance states, if
+	// -include-health is set
+	Health *AppHealth `json:"health,omitempty"`
+
+	// Vulnerabilities - IDs of advisories affecting the staged buildpacks, if
+	// -advisories is set
+	Vulnerabilities []string `json:"vulnerabilities,omitempty"`
+
+	// staged - buildpacks with a known version the droplet was staged with
+	staged []stagedBuildpack
+}
+
+// customBuildpack is a buildpack given by URL, eg "cf push -b https://github.com/..."
+type customBuildpack struct {
+	URL string `json:"url"`
+
+	// Ref - the branch, tag or commit after "#" in the URL, if any
+	Ref string `json:"ref,omitempty"`
+}
+
+// isCustomBuildpack returns true if name is a URL rather than the name of
+// an installed buildpack
+func isCustomBuildpack(name string) bool {
+	return strings.Contains(name, "://") || strings.HasPrefix(name, "git@")
+}
+
+func newCustomBuildpack(name string) *customBuildpack {
+	rv := &customBuildpack{URL: name}
+	if i := strings.Index(name, "#"); i != -1 {
+		rv.URL, rv.Ref = name[:i], name[i+1:]
+	}
+	return rv
+}
+
+func (cb *customBuildpack) String() string {
+	if cb.Ref == "" {
+		return cb.URL + " (unpinned)"
+	}
+	return cb.URL + " @ " + cb.Ref
+}
+
+// customBuildpacksMessage joins custom buildpacks into a single message
+func customBuildpacksMessage(cbs []*customBuildpack) string {
+	var rv []string
+	for _, cb := range cbs {
+		rv = append(rv, cb.String())
+	}
+	return strings.Join(rv, ", ")
+}
+
+// needsAttention returns true if any problems were found with the app
+func (info *AppBuildpackInfo) needsAttention() bool {
+	return len(info.Reasons) != 0
+}
+
+// inFlight returns true if the app was deploying or staging when checked,
+// and there are no problems with it other than those of the droplet being
+// replaced
+func (info *AppBuildpackInfo) inFlight() bool {
+	return len(info.Reasons) == 1 && info.Reasons[0].Code == reasonDeploymentInProgress
+}
+
+// hasDropletReasons returns true if any problems were found with the app's
+// current droplet
+func (info *AppBuildpackInfo) hasDropletReasons() bool {
+	for _, r := range info.Reasons {
+		if dropletReasons.contains(r.Code) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceDropletReasons replaces the problems found with the app's current
+// droplet with inFlight, as the droplet is about to be replaced, keeping
+// any others, eg policy violations
+func (info *AppBuildpackInfo) replaceDropletReasons(inFlight *reason) {
+	reasons := []*reason{inFlight}
+	for _, r := range info.Reasons {
+		if !dropletReasons.contains(r.Code) {
+			reasons = append(reasons, r)
+		}
+	}
+	info.Reasons = reasons
+}
+
+// skipped returns true if info is left out of the report by opts
+func (info *AppBuildpackInfo) skipped(opts *Options) bool {
+	return (opts.AttentionOnly && !info.needsAttention()) || (opts.SkipInFlight && info.inFlight()) ||
+		(len(opts.Buildpacks) != 0 && !info.usesAny(opts.Buildpacks))
+}
+
+// usesAny returns true if the app was staged with, or requests, any of the
+// named buildpacks
+func (info *AppBuildpackInfo) usesAny(names stringList) bool {
+	for _, name := range info.BuildpackNames {
+		if names.contains(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// crashed returns the number of crashed instances, or 0 if unknown
+func (info *AppBuildpackInfo) crashed() int64 {
+	if info.Health == nil {
+		return 0
+	}
+	return int64(info.Health.Crashed)
+}
+
+// memory returns TotalMemory as a number of MB
+func (info *AppBuildpackInfo) memory() int64 {
+	rv, _ := strconv.ParseInt(info.TotalMemory, 10, 64)
+	return rv
+}
+
+// addSidecars records the app's sidecars, adding the memory they reserve to
+// its total and to the breakdown by process
+func (info *AppBuildpackInfo) addSidecars(sidecars []*Sidecar) {
+	info.Sidecars = sidecars
+	var total int64
+	for _, s := range sidecars {
+		if s.TotalMemory == 0 {
+			continue
+		}
+		total += s.TotalMemory
+		// copied, as the breakdown is shared with the app's resource
+		pm := make(map[string]int64, len(info.ProcessMemory)+1)
+		for k, v := range info.ProcessMemory {
+			pm[k] = v
+		}
+		pm[s.Name+" (sidecar)"] = s.TotalMemory
+		info.ProcessMemory = pm
+	}
+	if total != 0 {
+		info.TotalMemory = strconv.FormatInt(info.memory()+total, 10)
+	}
+}
+
+// sidecars returns the app's sidecars and the memory each reserves per
+// instance, eg "envoy (web) 64 MB"
+func (info *AppBuildpackInfo) sidecars(unit string) string {
+	var rv []string
+	for _, s := range info.Sidecars {
+		v := s.Name + " (" + strings.Join(s.ProcessTypes, ", ") + ")"
+		if s.MemoryInMB != 0 {
+			v += " " + formatMemory(s.MemoryInMB, unit)
+		}
+		rv = append(rv, v)
+	}
+	return strings.Join(rv, "; ")
+}
+
+// buildpackList returns the app's buildpacks in the order they are applied.
+// With multiple buildpacks, all but the last only supply dependencies, so
+// each is marked as a supply or the final buildpack.
+func (info *AppBuildpackInfo) buildpackList() string {
+	if len(info.Buildpacks) < 2 {
+		return strings.Join(info.Buildpacks, ", ")
+	}
+	var rv []string
+	for i, bp := range info.Buildpacks {
+		role := "supply"
+		if i == len(info.Buildpacks)-1 {
+			role = "final"
+		}
+		rv = append(rv, fmt.Sprintf("%s (%s)", bp, role))
+	}
+	return strings.Join(rv, ", ")
+}
+
+// lastStaged returns the date the droplet was staged, if known
+func (info *AppBuildpackInfo) lastStaged() string {
+	if info.LastStaged == nil {
+		return ""
+	}
+	return info.LastStaged.Format("2006-01-02")
+}
+
+// processMemory returns the memory of each type of process in unit, eg
+// "web: 2 GB, worker: 512 MB"
+func (info *AppBuildpackInfo) processMemory(unit string) string {
+	var types []string
+	for t := range info.ProcessMemory {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	var rv []string
+	for _, t := range types {
+		rv = append(rv, fmt.Sprintf("%s: %s", t, formatMemory(info.ProcessMemory[t], unit)))
+	}
+	return strings.Join(rv, ", ")
+}
+
+// revisions returns the version, date and buildpacks of each of the app's
+// recent revisions, eg "v3 2024-01-02 (java v4.50); v2 2023-11-30 (java v4.48)"
+func (info *AppBuildpackInfo) revisions() string {
+	var rv []string
+	for _, r := range info.Revisions {
+		s := fmt.Sprintf("v%d %s", r.Version, r.CreatedAt.Format("2006-01-02"))
+		if len(r.Buildpacks) > 0 {
+			s += " (" + strings.Join(r.Buildpacks, ", ") + ")"
+		}
+		rv = append(rv, s)
+	}
+	return strings.Join(rv, "; ")
+}
+
+// tasks returns the app's most recent tasks with the memory each reserved,
+// eg "migrate 1 GB SUCCEEDED 2024-01-02"
+func (info *AppBuildpackInfo) tasks(unit string) string {
+	var rv []string
+	for _, t := range info.Tasks {
+		rv = append(rv, fmt.Sprintf("%s %s %s %s", t.Name, formatMemory(t.MemoryInMB, unit), t.State, t.CreatedAt.Format("2006-01-02")))
+	}
+	return strings.Join(rv, "; ")
+}
+
+// lastEvent returns who last changed the app and when, eg
+// "restaged by alice 2024-01-02"
+func (info *AppBuildpackInfo) lastEvent() string {
+	if info.LastEvent == nil {
+		return ""
+	}
+	e := info.LastEvent
+	return fmt.Sprintf("%s by %s %s", e.Action, e.Actor, e.CreatedAt.Format("2006-01-02"))
+}
+
+// name returns the app's org/space/app, prefixed by its foundation if set
+func (info *AppBuildpackInfo) name() string {
+	rv := info.Organization + "/" + info.Space + "/" + info.Application
+	if info.Foundation != "" {
+		rv = info.Foundation + ": " + rv
+	}
+	return rv
+}
+
+// messages returns the reasons the app needs attention, or "OK". Docker
+// apps that need no attention are marked as such, as buildpacks don't apply.
+func (info *AppBuildpackInfo) messages() string {
+	if info.Lifecycle == lifecycleDocker && !info.needsAttention() {
+		return "docker (n/a)"
+	}
+	return reasonsMessage(info.Reasons)
+}
+
+// buildpackKey identifies an installed buildpack. The same name may be
+// installed once per stack, or once with no stack to apply to all stacks.
+type buildpackKey struct {
+	name, stack string
+}
+
+// installedBuildpacks are the installed buildpacks, by name and stack
+type installedBuildpacks map[buildpackKey]*Resource
+
+// find returns the installed buildpack with name for stack, falling back to
+// one that has no stack
+func (ib installedBuildpacks) find(name, stack string) (*Resource, bool) {
+	bp, found := ib[buildpackKey{name: name, stack: stack}]
+	if !found {
+		bp, found = ib[buildpackKey{name: name}]
+	}
+	return bp, found
+}
+
+// hasName returns true if a buildpack called name is installed for any stack
+func (ib installedBuildpacks) hasName(name string) bool {
+	for k := range ib {
+		if k.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// appUsageInfo looks up the current droplet for app and compares the buildpacks
+// it was staged with against the installed buildpacks, which are either
+// enabled or disabled
+func appUsageInfo(fd Client, buildpacks, disabled installedBuildpacks, org, space, app *Resource) *AppBuildpackInfo {
+	var bps, names []string
+	var reasons []*reason
+	var staged []stagedBuildpack
+	var lastStaged *time.Time
+	staleness := 0
+	lifecycle := app.Entity.Lifecycle
+	dockerImage := app.Entity.DockerImage
+
+	stack := app.Entity.Stack
+
+	dropletAnswer, err := fd.Droplet(app)
+	if err != nil {
+		switch {
+		case isNotFound(err) && app.Entity.State != appStateStarted:
+			// stopped apps that have never been staged are not a problem
+		case isNotFound(err):
+			reasons = append(reasons, newReason(reasonDropletMissing, "app has no current droplet"))
+		case isPermissionDenied(err):
+			reasons = append(reasons, newReason(reasonDropletMissing, "not permitted to read current droplet"))
+		default:
+			reasons = append(reasons, newReason(reasonDropletMissing, "current droplet could not be retrieved (%s)", err))
+		}
+	} else if lifecycle == lifecycleDocker || dropletAnswer.Image != "" {
+		// docker apps don't use buildpacks, so there is nothing to check
+		lifecycle = lifecycleDocker
+		if dropletAnswer.Image != "" {
+			dockerImage = dropletAnswer.Image
+		}
+	} else {
+		lastStaged = &dropletAnswer.CreatedAt
+		if dropletAnswer.Stack != "" {
+			stack = dropletAnswer.Stack
+		}
+		if len(dropletAnswer.Buildpacks) == 0 {
+			reasons = append(reasons, newReason(reasonNoBuildpackRecorded, "current droplet does not record any buildpacks"))
+		}
+		// the droplet lists the buildpacks in the order they were applied,
+		// which is kept
+		for _, bp := range dropletAnswer.Buildpacks {
+			names = append(names, bp.Name)
+			if bp.Version == "" {
+				bps = append(bps, bp.Name)
+				reasons = append(reasons, newReason(reasonVersionUnknown, "version of %s is unknown", bp.Name))
+			} else {
+				bps = append(bps, fmt.Sprintf("%s v%s", bp.Name, bp.Version))
+				staged = append(staged, stagedBuildpack{name: bp.Name, version: bp.Version})
+
+				bpr, found := buildpacks.find(bp.Name, stack)
+				if isCustomBuildpack(bp.Name) {
+					// reported as CUSTOM_BUILDPACK below
+				} else if !found {
+					if _, found := disabled.find(bp.Name, stack); found {
+						reasons = append(reasons, newReason(reasonBuildpackDisabled, "%s is installed for %s, but disabled", bp.Name, stack))
+					} else if buildpacks.hasName(bp.Name) || disabled.hasName(bp.Name) {
+						reasons = append(reasons, newReason(reasonBuildpackNotInstalled, "%s is not an installed buildpack for %s", bp.Name, stack))
+					} else {
+						reasons = append(reasons, newReason(reasonBuildpackDeleted, "%s is no longer installed for any stack", bp.Name))
+					}
+				} else {
+					if !strings.HasSuffix(bpr.Entity.Filename, fmt.Sprintf("v%s.zip", bp.Version)) {
+						reasons = append(reasons, newReason(reasonOutdatedVersion, "staged with %s v%s, but %s is installed", bp.Name, bp.Version, bpr.Entity.Filename))
+					}
+					if dropletAnswer.CreatedAt.Before(bpr.Metadata.UpdatedAt) {
+						days := int(bpr.Metadata.UpdatedAt.Sub(dropletAnswer.CreatedAt).Hours() / 24)
+						if days > staleness {
+							staleness = days
+						}
+						reasons = append(reasons, newReason(reasonRestageRequired, "droplet was staged %d days before %s was updated", days, bp.Name))
+					}
+				}
+			}
+		}
+	}
+
+	if len(bps) == 0 {
+		if app.Entity.Buildpack != "" {
+			// requested buildpacks are joined in the order they are applied
+			bps = strings.Split(app.Entity.Buildpack, ", ")
+			names = strings.Split(app.Entity.Buildpack, ", ")
+		} else {
+			if app.Entity.DetectedBuildpack != "" {
+				bps = append(bps, app.Entity.DetectedBuildpack)
+				names = append(names, app.Entity.DetectedBuildpack)
+			}
+		}
+	}
+
+	var guids map[string]string
+	for _, name := range names {
+		bpr, found := buildpacks.find(name, stack)
+		if !found {
+			bpr, found = disabled.find(name, stack)
+		}
+		if found {
+			if guids == nil {
+				guids = make(map[string]string)
+			}
+			guids[name] = bpr.Metadata.Guid
+		}
+	}
+
+	// custom buildpacks are requested by the app, and may also be recorded by the droplet
+	var custom []*customBuildpack
+	seen := make(map[string]bool)
+	for _, name := range append(strings.Split(app.Entity.Buildpack, ", "), names...) {
+		if isCustomBuildpack(name) && !seen[name] && lifecycle != lifecycleDocker {
+			seen[name] = true
+			cb := newCustomBuildpack(name)
+			custom = append(custom, cb)
+			if cb.Ref == "" {
+				reasons = append(reasons, newReason(reasonCustomBuildpack, "%s is a custom buildpack, not pinned to a ref", cb.URL))
+			} else {
+				reasons = append(reasons, newReason(reasonCustomBuildpack, "%s is a custom buildpack, pinned to %s", cb.URL, cb.Ref))
+			}
+		}
+	}
+
+	return &AppBuildpackInfo{
+		Organization:     org.Entity.Name,
+		Space:            space.Entity.Name,
+		Application:      app.Entity.Name,
+		OrgGUID:          org.Metadata.Guid,
+		SpaceGUID:        space.Metadata.Guid,
+		AppGUID:          app.Metadata.Guid,
+		State:            app.Entity.State,
+		Lifecycle:        lifecycle,
+		DockerImage:      dockerImage,
+		Buildpacks:       bps,
+		BuildpackNames:   names,
+		BuildpackGUIDs:   guids,
+		AutoDetected:     lifecycle != lifecycleDocker && app.Entity.Buildpack == "",
+		CustomBuildpacks: custom,
+		LastStaged:       lastStaged,
+		ProcessMemory:    app.Entity.ProcessMemory,
+		TotalMemory:      strconv.FormatInt(app.totalMemory(), 10),
+		StalenessDays:    staleness,
+		Reasons:          reasons,
+		staged:           staged,
+		Stack:            stack,
+	}
+}
+
+// ErrInterrupted is returned when collecting is interrupted, eg by Ctrl-C,
+// along with any apps collected before then
+var ErrInterrupted = errors.New("interrupted")
+
+// collectUsageInfo walks all orgs, spaces and apps selected by opts and returns
+// buildpack usage information for each app. If emit is not nil, it is also
+// called with each app's information as soon as it is available, in no
+// particular order. If client.Context is done before all apps are collected
+// it returns the apps collected so far and ErrInterrupted.
+func collectUsageInfo(client *simpleClient, fd Client, opts *Options, emit func(*AppBuildpackInfo) error) ([]*AppBuildpackInfo, error) {
+	if opts.Resume != nil {
+		// saved however collecting ends, so that a failed run can be resumed
+		defer func() {
+			err := opts.Resume.Save()
+			if err != nil {
+				logf(levelWarn, nil, "saving resume state: %s", err)
+			}
+		}()
+	}
+
+	endPhase := client.phase("buildpacks")
+	buildpacks := make(installedBuildpacks)
+	disabled := make(installedBuildpacks)
+	err := fd.Buildpacks(func(bp *Resource) error {
+		key := buildpackKey{name: bp.Entity.Name, stack: bp.Entity.Stack}
+		if bp.Entity.Enabled {
+			buildpacks[key] = bp
+		} else {
+			disabled[key] = bp
+		}
+		return nil
+	})
+	endPhase()
+	if err != nil {
+		return nil, interruptedOr(client, err)
+	}
+	if opts.CheckPivnet != nil {
+		opts.CheckPivnet.checkInstalled(buildpacks)
+	}
+
+	apps, err := walkApps(client, fd, opts)
+	if err != nil {
+		// none of the apps listed so far have been checked yet
+		return nil, err
+	}
+
+	// apps in spaces completed by a previous run aren't checked again
+	var resumed []*AppBuildpackInfo
+	if opts.Resume != nil {
+		opts.Resume.start(apps)
+		resumed = opts.Resume.resumed()
+		for _, info := range resumed {
+			if emit != nil && !info.skipped(opts) {
+				err = emit(info)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var contacts map[string][]string
+	if opts.IncludeContacts {
+		endPhase := client.phase("contacts")
+		contacts, err = spaceContacts(client, fd, apps)
+		endPhase()
+		if err != nil {
+			return nil, interruptedOr(client, err)
+		}
+	}
+
+	lookups, err := lookupApps(client, fd, opts, apps)
+	if err != nil {
+		return nil, err
+	}
+
+	endPhase = client.phase("droplets")
+	var appResources []*Resource
+	for _, a := range apps {
+		appResources = append(appResources, a.app)
+	}
+	err = fd.PrefetchDroplets(appResources)
+	if err != nil {
+		endPhase()
+		return nil, interruptedOr(client, err)
+	}
+	appInfo := make([]*AppBuildpackInfo, len(apps))
+	err = client.Parallel(len(apps), func(i int) error {
+		span := client.Tracer.start("app", apps[i].attributes()...)
+		appInfo[i] = appUsageInfo(fd, buildpacks, disabled, apps[i].org, apps[i].space, apps[i].app)
+		span.finish(nil)
+		if client.interrupted() {
+			// the droplet may not have been fetched, so leave the app out
+			appInfo[i] = nil
+			return ErrInterrupted
+		}
+		appInfo[i].Contacts = contacts[apps[i].space.Metadata.Guid]
+		for _, set := range lookups[i] {
+			set(appInfo[i])
+		}
+		for _, key := range opts.MetadataColumns {
+			if v := apps[i].metadata.value(key); v != "" {
+				if appInfo[i].Metadata == nil {
+					appInfo[i].Metadata = make(map[string]string)
+				}
+				appInfo[i].Metadata[key] = v
+			}
+		}
+		if opts.CheckLatest != nil {
+			appInfo[i].Reasons = append(appInfo[i].Reasons, opts.CheckLatest.check(appInfo[i].staged)...)
+		}
+		if opts.CheckPivnet != nil {
+			appInfo[i].Reasons = append(appInfo[i].Reasons, opts.CheckPivnet.check(appInfo[i].staged)...)
+		}
+		if opts.Advisories != nil {
+			ids, reasons := opts.Advisories.check(appInfo[i].staged)
+			appInfo[i].Vulnerabilities = ids
+			appInfo[i].Reasons = append(appInfo[i].Reasons, reasons...)
+		}
+		if opts.DeprecatedStacks.contains(appInfo[i].Stack) {
+			appInfo[i].Reasons = append(appInfo[i].Reasons, newReason(reasonStackDeprecated, "%s is deprecated", appInfo[i].Stack))
+		}
+		if opts.FlagAutodetect && appInfo[i].AutoDetected {
+			appInfo[i].Reasons = append(appInfo[i].Reasons, newReason(reasonAutoDetected, "no buildpack is requested, so changes to the buildpack order can change the one detected"))
+		}
+		if opts.MaxDropletAge != 0 {
+			appInfo[i].Reasons = append(appInfo[i].Reasons, checkDropletAge(appInfo[i], opts.MaxDropletAge)...)
+		}
+		if opts.Policy != nil {
+			appInfo[i].Reasons = append(appInfo[i].Reasons, opts.Policy.check(appInfo[i])...)
+		}
+		// only apps with problems with their droplet are checked, unless
+		// in-flight apps are skipped, as the droplet may be being replaced
+		if appInfo[i].hasDropletReasons() || opts.SkipInFlight {
+			inFlight, err := fd.InFlight(apps[i].app)
+			switch {
+			case err != nil && client.interrupted():
+				return err
+			case err != nil && !isPermissionDenied(err):
+				logf(levelWarn, logFields{"app": apps[i].app.Entity.Name, "guid": apps[i].app.Metadata.Guid},
+					"couldn't check for a deployment or build in progress for app %s, so its droplet is reported as is: %s", apps[i].app.Entity.Name, err)
+			case inFlight != "":
+				appInfo[i].replaceDropletReasons(newReason(reasonDeploymentInProgress, "%s, so the droplet may be about to change", inFlight))
+			}
+		}
+		// anonymized before being saved by -resume, so resumed rows are too
+		if opts.Anonymize {
+			appInfo[i].anonymize()
+		}
+		if opts.Resume != nil {
+			opts.Resume.appDone(apps[i].space.Metadata.Guid, appInfo[i])
+		}
+		if emit != nil && !appInfo[i].skipped(opts) {
+			return emit(appInfo[i])
+		}
+		return nil
+	})
+	endPhase()
+	err = interruptedOr(client, err)
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	var allInfo []*AppBuildpackInfo
+	for _, info := range append(resumed, appInfo...) {
+		if info == nil {
+			continue
+		}
+		if info.skipped(opts) {
+			continue
+		}
+		allInfo = append(allInfo, info)
+	}
+
+	return allInfo, err
+}
+
+// Collect returns buildpack usage information for each app listed by client
+// and selected by opts, sorted by opts.SortBy, for embedding the report in
+// other tools. If ctx is done before all apps are collected, it returns the
+// apps collected so far and ErrInterrupted. Orgs and spaces skipped because
+// the user isn't permitted to read them are summarized in a warning.
+func Collect(ctx context.Context, client Client, opts *Options) ([]*AppBuildpackInfo, error) {
+	sc, fd := withContext(ctx, client)
+	allInfo, err := collectUsageInfo(sc, fd, opts, nil)
+	sc.logInaccessible()
+	Sort(allInfo, opts)
+	return allInfo, err
+}
+
+// withContext returns a client for running fd's requests in parallel, with
+// the concurrency, retries and rate limit of fd if it was made by NewClient,
+// and fd making its requests with ctx. Other Clients can't be cancelled, so
+// are only run in parallel until ctx is done.
+func withContext(ctx context.Context, fd Client) (*simpleClient, Client) {
+	switch fd := fd.(type) {
+	case *v2Foundation:
+		if sc, ok := fd.client.(*simpleClient); ok {
+			sc = sc.withContext(ctx)
+			return sc, &v2Foundation{client: sc}
+		}
+	case *v3Foundation:
+		if sc, ok := fd.client.(*simpleClient); ok {
+			sc = sc.withContext(ctx)
+			return sc, &v3Foundation{client: sc}
+		}
+	}
+	return &simpleClient{Quiet: true, Concurrency: defaultConcurrency, Context: ctx}, fd
+}
+
+// interruptedOr returns ErrInterrupted if client.Context is done, as err is
+// then most likely a result of that, otherwise err
+func interruptedOr(client *simpleClient, err error) error {
+	if err != nil && client.interrupted() {
+		return ErrInterrupted
+	}
+	return err
+}
+
+// spaceContacts looks up the contacts for each space containing apps, by
+// space guid. Spaces whose roles we aren't permitted to read have none.
+func spaceContacts(client *simpleClient, fd Client, apps []appInSpace) (map[string][]string, error) {
+	var spaces []*Resource
+	seen := make(map[string]bool)
+	for _, a := range apps {
+		if !seen[a.space.Metadata.Guid] {
+			seen[a.space.Metadata.Guid] = true
+			spaces = append(spaces, a.space)
+		}
+	}
+
+	contacts := make([][]string, len(spaces))
+	err := client.Parallel(len(spaces), func(i int) error {
+		c, err := fd.Contacts(spaces[i])
+		if err != nil && !isPermissionDenied(err) {
+			return err
+		}
+		contacts[i] = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string][]string)
+	for i, space := range spaces {
+		rv[space.Metadata.Guid] = contacts[i]
+	}
+	return rv, nil
+}
+
+// appLookup is an optional column looked up for each app, in its own phase
+// before the apps are checked. Apps whose column the user isn't permitted to
+// see are left without it.
+type appLookup struct {
+	phase string
+
+	// include - whether opts asks for the column
+	include func(opts *Options) bool
+
+	// lookup - looks up the column for app, returning a func that sets it
+	// on the app's information once checked
+	lookup func(fd Client, app *Resource) (func(info *AppBuildpackInfo), error)
+}
+
+// appLookups are the optional columns looked up for each app, in order
+var appLookups = []appLookup{
+	{"routes", func(opts *Options) bool { return opts.IncludeRoutes }, func(fd Client, app *Resource) (func(*AppBuildpackInfo), error) {
+		routes, err := fd.Routes(app)
+		return func(info *AppBuildpackInfo) { info.Routes = routes }, err
+	}},
+	{"services", func(opts *Options) bool { return opts.IncludeServices }, func(fd Client, app *Resource) (func(*AppBuildpackInfo), error) {
+		services, err := fd.Services(app)
+		return func(info *AppBuildpackInfo) { info.Services = services }, err
+	}},
+	{"revisions", func(opts *Options) bool { return opts.IncludeRevisions }, func(fd Client, app *Resource) (func(*AppBuildpackInfo), error) {
+		revisions, err := fd.Revisions(app)
+		return func(info *AppBuildpackInfo) { info.Revisions = revisions }, err
+	}},
+	{"health", func(opts *Options) bool { return opts.IncludeHealth }, func(fd Client, app *Resource) (func(*AppBuildpackInfo), error) {
+		health, err := fd.Health(app)
+		return func(info *AppBuildpackInfo) { info.Health = health }, err
+	}},
+	{"tasks", func(opts *Options) bool { return opts.IncludeTasks }, func(fd Client, app *Resource) (func(*AppBuildpackInfo), error) {
+		tasks, err := fd.Tasks(app)
+		return func(info *AppBuildpackInfo) { info.Tasks = tasks }, err
+	}},
+	{"sidecars", func(opts *Options) bool { return opts.IncludeSidecars }, func(fd Client, app *Resource) (func(*AppBuildpackInfo), error) {
+		sidecars, err := fd.Sidecars(app)
+		return func(info *AppBuildpackInfo) { info.addSidecars(sidecars) }, err
+	}},
+	{"events", func(opts *Options) bool { return opts.IncludeEvents }, func(fd Client, app *Resource) (func(*AppBuildpackInfo), error) {
+		event, err := fd.LastEvent(app)
+		return func(info *AppBuildpackInfo) { info.LastEvent = event }, err
+	}},
+}
+
+// lookupApps looks up the appLookups included by opts for each of apps,
+// returning the funcs that set them by app index
+func lookupApps(client *simpleClient, fd Client, opts *Options, apps []appInSpace) ([][]func(*AppBuildpackInfo), error) {
+	rv := make([][]func(*AppBuildpackInfo), len(apps))
+	for _, l := range appLookups {
+		if !l.include(opts) {
+			continue
+		}
+		endPhase := client.phase(l.phase)
+		err := client.Parallel(len(apps), func(i int) error {
+			set, err := l.lookup(fd, apps[i].app)
+			if err != nil && !isPermissionDenied(err) {
+				return err
+			}
+			rv[i] = append(rv[i], set)
+			return nil
+		})
+		endPhase()
+		if err != nil {
+			return nil, interruptedOr(client, err)
+		}
+	}
+	return rv, nil
+}
+
+// checkDropletAge flags apps whose droplet was staged more than maxAge ago,
+// as it will contain old dependencies whatever buildpack version staged it
+func checkDropletAge(info *AppBuildpackInfo, maxAge time.Duration) []*reason {
+	if info.LastStaged == nil {
+		return nil
+	}
+	age := time.Since(*info.LastStaged)
+	if age <= maxAge {
+		return nil
+	}
+	return []*reason{newReason(reasonDropletTooOld, "droplet was staged %d days ago, more than the maximum of %d days", int(age.Hours()/24), int(maxAge.Hours()/24))}
+}
+
+// parseAge parses a duration, which may also be given in days, eg "90d"
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,295 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/svrc-pivotal/cf-report-buildpacks/pkg/report/reporttest"
+)
+
+// reasonCodes returns the codes of reasons, in order
+func reasonCodes(reasons []*reason) []string {
+	var rv []string
+	for _, r := range reasons {
+		rv = append(rv, r.Code)
+	}
+	return rv
+}
+
+// collectFake collects the report from srv with opts, failing the test on
+// any error
+func collectFake(t *testing.T, srv *reporttest.Server, opts *Options) []*AppBuildpackInfo {
+	t.Helper()
+	client, err := NewClient(srv.Connection(), "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allInfo, err := Collect(context.Background(), client, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return allInfo
+}
+
+func TestReplaceDropletReasons(t *testing.T) {
+	info := &AppBuildpackInfo{Reasons: []*reason{
+		newReason(reasonOutdatedVersion, "outdated"),
+		newReason(reasonPolicyNotAllowed, "not allowed"),
+		newReason(reasonDropletMissing, "missing"),
+	}}
+	if !info.hasDropletReasons() {
+		t.Fatal("hasDropletReasons() = false, want true")
+	}
+	info.replaceDropletReasons(newReason(reasonDeploymentInProgress, "deploying"))
+
+	got := reasonCodes(info.Reasons)
+	want := []string{reasonDeploymentInProgress, reasonPolicyNotAllowed}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got reasons %v, want %v", got, want)
+	}
+	if info.inFlight() {
+		t.Error("inFlight() = true for an app with a policy violation, want false")
+	}
+	if info.skipped(&Options{SkipInFlight: true}) {
+		t.Error("an app with a policy violation was skipped by -skip-in-flight")
+	}
+}
+
+func TestCollectInFlight(t *testing.T) {
+	srv := reporttest.NewServer(reporttest.Foundation)
+	defer srv.Close()
+	srv.Handle("/v3/deployments?status_values=ACTIVE&app_guids=a1", `{"resources":[{"strategy":"rolling","status":{"reason":"DEPLOYING"}}]}`)
+
+	allInfo := collectFake(t, srv, &Options{})
+	if len(allInfo) != 1 {
+		t.Fatalf("got %d apps, want app1", len(allInfo))
+	}
+	if got := reasonCodes(allInfo[0].Reasons); len(got) != 1 || got[0] != reasonDeploymentInProgress {
+		t.Errorf("got reasons %v, want only %s", got, reasonDeploymentInProgress)
+	}
+
+	allInfo = collectFake(t, srv, &Options{SkipInFlight: true})
+	if len(allInfo) != 0 {
+		t.Errorf("got %d apps, want app1 skipped as in flight", len(allInfo))
+	}
+}
+
+func TestCollectInFlightError(t *testing.T) {
+	srv := reporttest.NewServer(reporttest.Foundation)
+	defer srv.Close()
+	// older APIs have no deployments
+	srv.Handle("/v3/deployments?status_values=ACTIVE&app_guids=a1", "")
+
+	allInfo := collectFake(t, srv, &Options{})
+	if len(allInfo) != 1 {
+		t.Fatalf("got %d apps, want app1", len(allInfo))
+	}
+	if got := reasonCodes(allInfo[0].Reasons); len(got) != 1 || got[0] != reasonOutdatedVersion {
+		t.Errorf("got reasons %v, want only %s", got, reasonOutdatedVersion)
+	}
+}
+
+func TestCollectCancelled(t *testing.T) {
+	srv := reporttest.NewServer(reporttest.Foundation)
+	defer srv.Close()
+	client, err := NewClient(srv.Connection(), "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(srv.Requests())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Collect(ctx, client, &Options{})
+	if err != ErrInterrupted {
+		t.Errorf("got error %v, want ErrInterrupted", err)
+	}
+	if requests := srv.Requests()[before:]; len(requests) != 0 {
+		t.Errorf("requests were made once cancelled: %q", requests)
+	}
+}
+
+func TestWithContextKeepsSettings(t *testing.T) {
+	sc := &simpleClient{API: "https://api.example.com", Concurrency: 3, Retries: 5, RateLimit: newRateLimiter(10), ResultsPerPage: 20}
+	ctx := context.Background()
+	got, fd := withContext(ctx, &v3Foundation{client: sc})
+	if got.Concurrency != 3 || got.Retries != 5 || got.RateLimit != sc.RateLimit || got.ResultsPerPage != 20 || got.Context != ctx {
+		t.Errorf("settings weren't kept: %+v", got)
+	}
+	if fd.(*v3Foundation).client != got {
+		t.Error("the foundation doesn't make its requests with the new client")
+	}
+}
+
+// installed returns an installed buildpack with filename, last updated on
+// updated
+func installed(filename, updated string) *Resource {
+	bp := &Resource{}
+	bp.Entity.Filename = filename
+	bp.Metadata.UpdatedAt, _ = time.Parse(time.RFC3339, updated)
+	return bp
+}
+
+func TestAppUsageInfoReasons(t *testing.T) {
+	buildpacks := installedBuildpacks{
+		{name: "java_buildpack", stack: "cflinuxfs4"}: installed("java-buildpack-v4.1.zip", "2020-01-01T00:00:00Z"),
+		{name: "go_buildpack", stack: "cflinuxfs3"}:   installed("go-buildpack-v1.0.zip", "2020-01-01T00:00:00Z"),
+		// installed for all stacks
+		{name: "nodejs_buildpack"}: installed("nodejs-buildpack-cflinuxfs4-v2.0.zip", "2020-01-01T00:00:00Z"),
+	}
+	disabled := installedBuildpacks{
+		{name: "ruby_buildpack", stack: "cflinuxfs4"}: installed("ruby-buildpack-v1.0.zip", "2020-01-01T00:00:00Z"),
+	}
+
+	for _, tc := range []struct {
+		name, state, droplet string
+		want                 []string
+	}{
+		{"current", appStateStarted, `"buildpacks":[{"name":"java_buildpack","version":"4.1"}]`, nil},
+		{"any stack", appStateStarted, `"buildpacks":[{"name":"nodejs_buildpack","version":"2.0"}]`, nil},
+		{"outdated", appStateStarted, `"buildpacks":[{"name":"java_buildpack","version":"4.0"}]`, []string{reasonOutdatedVersion}},
+		{"other stack", appStateStarted, `"buildpacks":[{"name":"go_buildpack","version":"1.0"}]`, []string{reasonBuildpackNotInstalled}},
+		{"disabled", appStateStarted, `"buildpacks":[{"name":"ruby_buildpack","version":"1.0"}]`, []string{reasonBuildpackDisabled}},
+		{"deleted", appStateStarted, `"buildpacks":[{"name":"php_buildpack","version":"1.0"}]`, []string{reasonBuildpackDeleted}},
+		{"no version", appStateStarted, `"buildpacks":[{"name":"java_buildpack"}]`, []string{reasonVersionUnknown}},
+		{"no buildpacks", appStateStarted, `"buildpacks":[]`, []string{reasonNoBuildpackRecorded}},
+		{"no droplet", appStateStarted, "", []string{reasonDropletMissing}},
+		{"stopped, no droplet", "STOPPED", "", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			responses := map[string]string{}
+			if tc.droplet != "" {
+				responses["/v3/apps/a1/droplets/current"] = `{"created_at":"2021-01-01T00:00:00Z","stack":"cflinuxfs4",` + tc.droplet + `}`
+			}
+			srv := reporttest.NewServer(responses)
+			defer srv.Close()
+
+			app := testApps(1)[0]
+			app.Entity.State = tc.state
+			info := appUsageInfo(&v3Foundation{client: newTestClient(t, srv)}, buildpacks, disabled, &Resource{}, &Resource{}, app)
+			if got := reasonCodes(info.Reasons); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("got reasons %v, want %v", got, tc.want)
+			}
+			if info.needsAttention() != (len(tc.want) != 0) {
+				t.Errorf("needsAttention() = %v with reasons %v", info.needsAttention(), tc.want)
+			}
+		})
+	}
+}
+
+func TestAppUsageInfoRestageRequired(t *testing.T) {
+	srv := reporttest.NewServer(map[string]string{
+		"/v3/apps/a1/droplets/current": `{"created_at":"2019-12-22T00:00:00Z","stack":"cflinuxfs4","buildpacks":[{"name":"java_buildpack","version":"4.1"}]}`,
+	})
+	defer srv.Close()
+	buildpacks := installedBuildpacks{
+		{name: "java_buildpack", stack: "cflinuxfs4"}: installed("java-buildpack-v4.1.zip", "2020-01-01T00:00:00Z"),
+	}
+
+	info := appUsageInfo(&v3Foundation{client: newTestClient(t, srv)}, buildpacks, nil, &Resource{}, &Resource{}, testApps(1)[0])
+	if got := reasonCodes(info.Reasons); len(got) != 1 || got[0] != reasonRestageRequired {
+		t.Errorf("got reasons %v, want only %s", got, reasonRestageRequired)
+	}
+	if info.StalenessDays != 10 {
+		t.Errorf("got staleness %d days, want 10", info.StalenessDays)
+	}
+	if got := strings.Join(info.Buildpacks, ","); got != "java_buildpack v4.1" {
+		t.Errorf("got buildpacks %s, want java_buildpack v4.1", got)
+	}
+}
+
+func TestCollectFoundation(t *testing.T) {
+	srv := reporttest.NewServer(reporttest.Foundation)
+	defer srv.Close()
+
+	allInfo := collectFake(t, srv, &Options{})
+	if len(allInfo) != 1 {
+		t.Fatalf("got %d apps, want app1", len(allInfo))
+	}
+	info := allInfo[0]
+	if info.Organization != "org1" || info.Space != "space1" || info.Application != "app1" || info.AppGUID != "a1" {
+		t.Errorf("got %s/%s/%s (%s), want org1/space1/app1 (a1)", info.Organization, info.Space, info.Application, info.AppGUID)
+	}
+	if got := strings.Join(info.Buildpacks, ","); got != "java_buildpack v4.0" {
+		t.Errorf("got buildpacks %s, want java_buildpack v4.0", got)
+	}
+	if info.TotalMemory != "2048" {
+		t.Errorf("got total memory %s, want 2048", info.TotalMemory)
+	}
+	if got := reasonCodes(info.Reasons); len(got) != 1 || got[0] != reasonOutdatedVersion {
+		t.Errorf("got reasons %v, want only %s", got, reasonOutdatedVersion)
+	}
+
+	// every request the report makes should be one the fixture knows about,
+	// so that drift between the two fails here
+	if unhandled := srv.Unhandled(); len(unhandled) != 0 {
+		t.Errorf("requests not served by reporttest.Foundation: %q", unhandled)
+	}
+}
+
+func TestCollectLookups(t *testing.T) {
+	srv := reporttest.NewServer(reporttest.Foundation)
+	defer srv.Close()
+	srv.Handle("/v2/apps/a1/routes", `{"resources":[{"entity":{"host":"app1","domain_url":"/v2/domains/dm1"}}]}`)
+	srv.Handle("/v2/domains/dm1", `{"entity":{"name":"apps.example.com"}}`)
+	srv.Handle("/v2/apps/a1/service_bindings", `{"resources":[]}`)
+
+	allInfo := collectFake(t, srv, &Options{IncludeRoutes: true, IncludeServices: true})
+	if len(allInfo) != 1 {
+		t.Fatalf("got %d apps, want app1", len(allInfo))
+	}
+	if got := strings.Join(allInfo[0].Routes, ","); got != "app1.apps.example.com" {
+		t.Errorf("got routes %s, want app1.apps.example.com", got)
+	}
+
+	// a lookup the user isn't permitted to make leaves the column empty
+	srv.Fail("/v2/apps/a1/routes", http.StatusForbidden, 1)
+	allInfo = collectFake(t, srv, &Options{IncludeRoutes: true})
+	if len(allInfo) != 1 || allInfo[0].Routes != nil {
+		t.Errorf("got %+v, want app1 without routes", allInfo)
+	}
+
+	// other errors fail the report
+	srv.Fail("/v2/apps/a1/routes", http.StatusBadRequest, 1)
+	client, err := NewClient(srv.Connection(), "auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Collect(context.Background(), client, &Options{IncludeRoutes: true}); err == nil {
+		t.Error("got no error for a failed lookup")
+	}
+}
+
+func TestCollectLogsInaccessible(t *testing.T) {
+	srv := reporttest.NewServer(reporttest.Foundation)
+	defer srv.Close()
+	// listing a single org's spaces walks them, rather than listing all apps
+	srv.Fail("/v2/organizations/o1/spaces", http.StatusForbidden, 1)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	allInfo := collectFake(t, srv, &Options{Orgs: stringList{"org1"}})
+	if len(allInfo) != 0 {
+		t.Errorf("got %d apps, want none from the inaccessible org", len(allInfo))
+	}
+	if !strings.Contains(logged.String(), "1 orgs and 0 spaces were skipped") {
+		t.Errorf("the skipped org wasn't summarized:\n%s", logged.String())
+	}
+}
+
+func TestWithContextSharesInaccessible(t *testing.T) {
+	sc := &simpleClient{}
+	child := sc.withContext(context.Background())
+	child.skipInaccessible("space", &Resource{}, nil)
+	if got := sc.inaccessibleCounts().byKind["space"]; got != 1 {
+		t.Errorf("parent counted %d inaccessible spaces, want 1", got)
+	}
+}
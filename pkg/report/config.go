@@ -0,0 +1,144 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// envPrefix prefixes the environment variables that set default flags, eg
+// REPORT_BUILDPACKS_CONCURRENCY for -concurrency
+const envPrefix = "REPORT_BUILDPACKS_"
+
+// defaultConfigPath returns the path of the config file read if -config
+// isn't set, in the cf CLI's plugin directory
+func defaultConfigPath() string {
+	home := os.Getenv("CF_PLUGIN_HOME")
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	return filepath.Join(home, ".cf", "plugins", "report-buildpacks.json")
+}
+
+// envName returns the environment variable that sets the flag name
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// applyDefaults sets the flags in fs that weren't given on the command line
+// from the environment, and then from the config file named by the config
+// flag. A missing config file is only an error if it was named explicitly.
+func applyDefaults(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, found := os.LookupEnv(envName(f.Name))
+		if err != nil || given[f.Name] || !found {
+			return
+		}
+		given[f.Name] = true
+		if err = fs.Set(f.Name, v); err != nil {
+			err = fmt.Errorf("%s: %s", envName(f.Name), err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	path := fs.Lookup("config").Value.String()
+	config, err := loadConfig(path)
+	if os.IsNotExist(err) && !given["config"] {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for name, values := range config {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		if given[name] {
+			continue
+		}
+		for _, v := range values {
+			if err := fs.Set(name, v); err != nil {
+				return fmt.Errorf("%s: %s: %s", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readJSONFile decodes the JSON file at path into v. It is used for all the
+// config files, so that they report mistakes the same way: syntax errors and
+// values of the wrong type with the line they are on, and fields that aren't
+// known by name.
+func readJSONFile(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	err = d.Decode(v)
+	if err == nil && d.More() {
+		err = errors.New("unexpected data after the top-level value")
+	}
+	var offset int64
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	return fmt.Errorf("%s:%d: %s", path, 1+bytes.Count(b[:offset], []byte("\n")), err)
+}
+
+// loadConfig reads default flags from a JSON file keyed by flag name, eg
+//
+//	{"concurrency": 20, "output-csv": true, "exclude-orgs": ["system", "sandbox"]}
+//
+// Lists set repeatable flags once for each value.
+func loadConfig(path string) (map[string][]string, error) {
+	var raw map[string]interface{}
+	err := readJSONFile(path, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string][]string)
+	for name, v := range raw {
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case float64:
+				config[name] = append(config[name], strconv.FormatFloat(v, 'f', -1, 64))
+			case string, bool:
+				config[name] = append(config[name], fmt.Sprint(v))
+			default:
+				return nil, fmt.Errorf("%s: %s must be a string, number, boolean or list of them", path, name)
+			}
+		}
+	}
+	return config, nil
+}
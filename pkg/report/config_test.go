@@ -0,0 +1,49 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes content to name in a temporary directory, returning its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeFile(t, "config.json", `{"concurrency": 20, "output-csv": true, "exclude-orgs": ["system", "sandbox"]}`)
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"concurrency": "20", "output-csv": "true", "exclude-orgs": "system,sandbox"} {
+		if got := strings.Join(config[name], ","); got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestReadJSONFileErrors(t *testing.T) {
+	for content, want := range map[string]string{
+		"{\n\"org\": foo}":      ".json:2: invalid character",
+		"org: foo\n":            ".json:1: invalid character",
+		`{"name": 1}`:           ".json:1: json: cannot unmarshal number",
+		`{"name": "a", "x": 1}`: `unknown field "x"`,
+		`{"name": "a"} {}`:      "unexpected data",
+	} {
+		var v struct {
+			Name string `json:"name"`
+		}
+		err := readJSONFile(writeFile(t, "f.json", content), &v)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want an error containing %q", content, err, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// cycloneDXSpecVersion is the version of the CycloneDX specification that
+// -output-cyclonedx follows
+const cycloneDXSpecVersion = "1.5"
+
+// cdxBOM is a CycloneDX software bill of materials, where each app is a
+// component that depends on the buildpacks it was staged with
+type cdxBOM struct {
+	BOMFormat    string           `json:"bomFormat"`
+	SpecVersion  string           `json:"specVersion"`
+	SerialNumber string           `json:"serialNumber"`
+	Version      int              `json:"version"`
+	Metadata     cdxMetadata      `json:"metadata"`
+	Components   []*cdxComponent  `json:"components"`
+	Dependencies []*cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp  string        `json:"timestamp"`
+	Tools      cdxTools      `json:"tools"`
+	Component  *cdxComponent `json:"component,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTools struct {
+	Components []*cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Group              string                 `json:"group,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty          `json:"properties,omitempty"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// appComponent returns the component for the app in info
+func appComponent(info *AppBuildpackInfo) *cdxComponent {
+	ref := "app:" + info.AppGUID
+	if info.AppGUID == "" {
+		ref = "app:" + info.name()
+	}
+	c := &cdxComponent{
+		Type:   "application",
+		BOMRef: ref,
+		Group:  info.Organization + "/" + info.Space,
+		Name:   info.Application,
+		Properties: []cdxProperty{
+			{Name: "cf:organization", Value: info.Organization},
+			{Name: "cf:space", Value: info.Space},
+			{Name: "cf:state", Value: info.State},
+		},
+	}
+	if info.Foundation != "" {
+		c.Group = info.Foundation + "/" + c.Group
+		c.Properties = append(c.Properties, cdxProperty{Name: "cf:foundation", Value: info.Foundation})
+	}
+	if info.Stack != "" {
+		c.Properties = append(c.Properties, cdxProperty{Name: "cf:stack", Value: info.Stack})
+	}
+	for _, r := range info.Reasons {
+		c.Properties = append(c.Properties, cdxProperty{Name: "cf:reason", Value: r.Code})
+	}
+	return c
+}
+
+// appDependencies returns the components the app in info depends on: the
+// buildpacks it was staged with, or its image if it is a docker app
+func appDependencies(info *AppBuildpackInfo) []*cdxComponent {
+	if info.DockerImage != "" {
+		return []*cdxComponent{{Type: "container", BOMRef: "image:" + info.DockerImage, Name: info.DockerImage}}
+	}
+
+	versions := make(map[string]string)
+	for _, s := range info.staged {
+		versions[s.name] = s.version
+	}
+	var rv []*cdxComponent
+	for _, name := range info.BuildpackNames {
+		if strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://") {
+			// custom buildpacks are added below, with their refs as versions
+			continue
+		}
+		c := &cdxComponent{Type: "framework", BOMRef: "buildpack:" + name, Name: name, Version: versions[name]}
+		if c.Version != "" {
+			c.BOMRef += "@" + c.Version
+		}
+		rv = append(rv, c)
+	}
+	for _, cb := range info.CustomBuildpacks {
+		c := &cdxComponent{
+			Type:               "framework",
+			BOMRef:             "buildpack:" + cb.URL,
+			Name:               cb.URL,
+			Version:            cb.Ref,
+			ExternalReferences: []cdxExternalReference{{Type: "vcs", URL: cb.URL}},
+		}
+		if c.Version != "" {
+			c.BOMRef += "@" + c.Version
+		}
+		rv = append(rv, c)
+	}
+	return rv
+}
+
+// renderCycloneDX writes allInfo to out as a CycloneDX BOM in JSON
+func renderCycloneDX(out io.Writer, allInfo []*AppBuildpackInfo, opts *Options) error {
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	bom := &cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: "urn:uuid:" + id,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cdxTools{
+				Components: []*cdxComponent{{Type: "application", Name: "cf-report-buildpacks"}},
+			},
+		},
+		Components:   []*cdxComponent{},
+		Dependencies: []*cdxDependency{},
+	}
+	if opts.API != "" {
+		bom.Metadata.Component = &cdxComponent{Type: "platform", Name: opts.API}
+	}
+	if opts.Partial != "" {
+		bom.Metadata.Properties = []cdxProperty{{Name: "cf:partial", Value: opts.Partial}}
+	}
+
+	// buildpacks and images are listed once, however many apps use them
+	seen := make(map[string]bool)
+	for _, info := range allInfo {
+		app := appComponent(info)
+		bom.Components = append(bom.Components, app)
+		dep := &cdxDependency{Ref: app.BOMRef, DependsOn: []string{}}
+		for _, c := range appDependencies(info) {
+			dep.DependsOn = append(dep.DependsOn, c.BOMRef)
+			if !seen[c.BOMRef] {
+				seen[c.BOMRef] = true
+				bom.Components = append(bom.Components, c)
+			}
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+
+	enc := json.NewEncoder(out)
+	if opts.JSONIndent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(bom)
+}
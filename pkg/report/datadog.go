@@ -0,0 +1,115 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultDatadogSite is the Datadog site metrics are submitted to if
+// $DD_SITE is not set
+const defaultDatadogSite = "datadoghq.com"
+
+// ddSeries is a metric submitted to the Datadog API
+type ddSeries struct {
+	Metric string       `json:"metric"`
+	Points [][2]float64 `json:"points"`
+	Type   string       `json:"type"`
+	Tags   []string     `json:"tags"`
+}
+
+// ddKey identifies the apps in an org using a buildpack
+type ddKey struct {
+	foundation, org, buildpack string
+}
+
+// ddGroup counts the apps in an org using a buildpack
+type ddGroup struct {
+	ddKey
+
+	apps, outdated, attention int
+	memory                    int64
+}
+
+// datadogSeriesURL returns the URL to submit metrics to for site, which may
+// be a site such as datadoghq.eu or the URL of a proxy
+func datadogSeriesURL(site string) string {
+	if strings.Contains(site, "://") {
+		return strings.TrimSuffix(site, "/") + "/api/v1/series"
+	}
+	return "https://api." + site + "/api/v1/series"
+}
+
+// datadogSeries returns gauges of the apps, their memory and how many are
+// outdated or need attention, for each buildpack in each org, at runTime
+func datadogSeries(allInfo []*AppBuildpackInfo, runTime time.Time) []*ddSeries {
+	byKey := make(map[ddKey]*ddGroup)
+	for _, info := range allInfo {
+		for _, name := range summaryNames(info) {
+			k := ddKey{foundation: info.Foundation, org: info.Organization, buildpack: name}
+			g, found := byKey[k]
+			if !found {
+				g = &ddGroup{ddKey: k}
+				byKey[k] = g
+			}
+			g.apps++
+			g.memory += info.memory()
+			if info.needsRestage() {
+				g.outdated++
+			}
+			if info.needsAttention() {
+				g.attention++
+			}
+		}
+	}
+	var groups []*ddGroup
+	for _, g := range byKey {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if a.foundation != b.foundation {
+			return a.foundation < b.foundation
+		}
+		if a.org != b.org {
+			return a.org < b.org
+		}
+		return a.buildpack < b.buildpack
+	})
+
+	ts := float64(runTime.Unix())
+	var rv []*ddSeries
+	for _, g := range groups {
+		tags := []string{"org:" + g.org, "buildpack:" + g.buildpack}
+		if g.foundation != "" {
+			tags = append([]string{"foundation:" + g.foundation}, tags...)
+		}
+		for _, m := range []struct {
+			name  string
+			value float64
+		}{
+			{"cf.buildpack.apps", float64(g.apps)},
+			{"cf.buildpack.memory_mb", float64(g.memory)},
+			{"cf.buildpack.apps_outdated", float64(g.outdated)},
+			{"cf.buildpack.apps_needing_attention", float64(g.attention)},
+		} {
+			rv = append(rv, &ddSeries{Metric: m.name, Points: [][2]float64{{ts, m.value}}, Type: "gauge", Tags: tags})
+		}
+	}
+	return rv
+}
+
+// exportDatadog submits per buildpack gauges for allInfo at runTime to the
+// Datadog site with apiKey
+func exportDatadog(site, apiKey string, allInfo []*AppBuildpackInfo, runTime time.Time) error {
+	series := datadogSeries(allInfo, runTime)
+	if len(series) == 0 {
+		return nil
+	}
+	err := postJSON(datadogSeriesURL(site), map[string]string{"DD-API-KEY": apiKey}, map[string]interface{}{"series": series})
+	if err != nil {
+		return fmt.Errorf("exporting to Datadog: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// changes reported between two runs of report-buildpacks
+const (
+	changeAdded            = "ADDED"
+	changeRemoved          = "REMOVED"
+	changeBuildpackChanged = "BUILDPACK_CHANGED"
+	changeOutdated         = "BECAME_OUTDATED"
+	changeRemediated       = "REMEDIATED"
+)
+
+// changeKinds are the changes that may be reported, as accepted by -change
+var changeKinds = []string{changeAdded, changeRemoved, changeBuildpackChanged, changeOutdated, changeRemediated}
+
+// validateChangeKind returns an error if change is set and not one of
+// changeKinds
+func validateChangeKind(change string) error {
+	if change == "" {
+		return nil
+	}
+	for _, k := range changeKinds {
+		if k == change {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown -change %q, expected one of %s", change, strings.Join(changeKinds, ", "))
+}
+
+// usageChange is a change to one app between two reports
+type usageChange struct {
+	Foundation   string `json:"foundation,omitempty"`
+	Organization string `json:"organization"`
+	Space        string `json:"space"`
+	Application  string `json:"application"`
+	Change       string `json:"change"`
+	Old          string `json:"old,omitempty"`
+	New          string `json:"new,omitempty"`
+}
+
+// appKey identifies an app across reports, which don't include guids
+type appKey struct {
+	foundation, org, space, app string
+}
+
+func usageInfoKey(info *AppBuildpackInfo) appKey {
+	return appKey{foundation: info.Foundation, org: info.Organization, space: info.Space, app: info.Application}
+}
+
+// loadUsageInfo reads a report written by -output-json or -stream
+func loadUsageInfo(path string) ([]*AppBuildpackInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var allInfo []*AppBuildpackInfo
+	dec := json.NewDecoder(f)
+	for {
+		var raw json.RawMessage
+		err = dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading report %s: %s", path, err)
+		}
+
+		// -output-json writes the rows wrapped in a jsonReport, or as a
+		// single array before it was versioned, and -stream writes one
+		// object per line
+		var report struct {
+			SchemaVersion int                 `json:"schema_version"`
+			Rows          []*AppBuildpackInfo `json:"rows"`
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			err = json.Unmarshal(raw, &report.Rows)
+		} else {
+			err = json.Unmarshal(raw, &report)
+			if err == nil && report.SchemaVersion == 0 {
+				var info AppBuildpackInfo
+				err = json.Unmarshal(raw, &info)
+				report.Rows = []*AppBuildpackInfo{&info}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading report %s: %s", path, err)
+		}
+		if report.SchemaVersion > jsonSchemaVersion {
+			return nil, fmt.Errorf("reading report %s: schema version %d is newer than this version of the plugin supports", path, report.SchemaVersion)
+		}
+		allInfo = append(allInfo, report.Rows...)
+	}
+	return allInfo, nil
+}
+
+// diffUsageInfo returns the changes to apps from oldInfo to newInfo, sorted
+// by org, space and app
+func diffUsageInfo(oldInfo, newInfo []*AppBuildpackInfo) []*usageChange {
+	oldByKey := make(map[appKey]*AppBuildpackInfo)
+	for _, info := range oldInfo {
+		oldByKey[usageInfoKey(info)] = info
+	}
+	newByKey := make(map[appKey]*AppBuildpackInfo)
+	for _, info := range newInfo {
+		newByKey[usageInfoKey(info)] = info
+	}
+
+	var changes []*usageChange
+	add := func(k appKey, change, o, n string) {
+		changes = append(changes, &usageChange{
+			Foundation:   k.foundation,
+			Organization: k.org,
+			Space:        k.space,
+			Application:  k.app,
+			Change:       change,
+			Old:          o,
+			New:          n,
+		})
+	}
+
+	for k, o := range oldByKey {
+		if _, found := newByKey[k]; !found {
+			add(k, changeRemoved, strings.Join(o.Buildpacks, ", "), "")
+		}
+	}
+	for k, n := range newByKey {
+		o, found := oldByKey[k]
+		if !found {
+			add(k, changeAdded, "", strings.Join(n.Buildpacks, ", "))
+			continue
+		}
+		oldBps, newBps := strings.Join(o.Buildpacks, ", "), strings.Join(n.Buildpacks, ", ")
+		if oldBps != newBps {
+			add(k, changeBuildpackChanged, oldBps, newBps)
+		}
+		switch {
+		case !o.needsRestage() && n.needsRestage():
+			add(k, changeOutdated, reasonsMessage(o.Reasons), reasonsMessage(n.Reasons))
+		case o.needsRestage() && !n.needsRestage():
+			add(k, changeRemediated, reasonsMessage(o.Reasons), reasonsMessage(n.Reasons))
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if c := strings.Compare(a.Foundation, b.Foundation); c != 0 {
+			return c < 0
+		}
+		if c := compareNames(a.Organization, a.Space, a.Application, b.Organization, b.Space, b.Application); c != 0 {
+			return c < 0
+		}
+		return a.Change < b.Change
+	})
+	return changes
+}
+
+// reportDiff renders the changes between the reports saved at oldPath and
+// newPath to out
+func reportDiff(out io.Writer, oldPath, newPath string, opts *Options) error {
+	oldInfo, err := loadUsageInfo(oldPath)
+	if err != nil {
+		return err
+	}
+	newInfo, err := loadUsageInfo(newPath)
+	if err != nil {
+		return err
+	}
+
+	changes := diffUsageInfo(oldInfo, newInfo)
+	if opts.OutputJSON {
+		return renderJSON(out, changes, opts)
+	}
+
+	header := []string{"Organization", "Space", "Application", "Change", "Old", "New"}
+	foundations := hasFoundation(oldInfo) || hasFoundation(newInfo)
+	if foundations {
+		header = append([]string{"Foundation"}, header...)
+	}
+	var rows [][]string
+	for _, c := range changes {
+		row := []string{c.Organization, c.Space, c.Application, c.Change, c.Old, c.New}
+		if foundations {
+			row = append([]string{c.Foundation}, row...)
+		}
+		rows = append(rows, row)
+	}
+	return renderRows(out, header, rows, opts)
+}
@@ -0,0 +1,131 @@
+package report
+
+import (
+	"io"
+	"strings"
+)
+
+// defaultRegistry is the registry of docker images that don't name one
+const defaultRegistry = "docker.io"
+
+type dockerUsageInfo struct {
+	Organization string `json:"organization"`
+	Space        string `json:"space"`
+	Application  string `json:"application"`
+	State        string `json:"state"`
+	DockerImage  string `json:"docker_image"`
+	Registry     string `json:"registry"`
+
+	// Credentials - whether the image is pulled with credentials, and the
+	// username if so
+	Credentials      bool   `json:"credentials"`
+	RegistryUsername string `json:"registry_username,omitempty"`
+}
+
+// dockerRegistry returns the registry image is pulled from, which is the
+// first part of its name if that is a hostname, eg registry.example.com:5000
+// in registry.example.com:5000/team/app:1.0
+func dockerRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return defaultRegistry
+	}
+	host := image[:i]
+	if host != "localhost" && !strings.ContainsAny(host, ".:") {
+		return defaultRegistry
+	}
+	return host
+}
+
+// reportDocker lists every docker app selected by opts with its image,
+// renders them to out and returns the rows reported on
+func (c *reportBuildpacks) reportDocker(client *simpleClient, fd Client, out io.Writer, opts *Options) ([]*dockerUsageInfo, error) {
+	apps, err := walkApps(client, fd, opts)
+	if err == ErrInterrupted {
+		opts.Partial = partialNote
+	} else if err != nil {
+		return nil, err
+	}
+
+	var docker []appInSpace
+	for _, a := range apps {
+		if a.app.Entity.Lifecycle == lifecycleDocker {
+			docker = append(docker, a)
+		}
+	}
+
+	endPhase := client.phase("docker")
+	packages := make([]*DockerPackage, len(docker))
+	perr := client.Parallel(len(docker), func(i int) error {
+		dp, err := fd.DockerPackage(docker[i].app)
+		if err != nil && !isPermissionDenied(err) {
+			return err
+		}
+		packages[i] = dp
+		return nil
+	})
+	endPhase()
+	perr = interruptedOr(client, perr)
+	if perr == ErrInterrupted {
+		opts.Partial = partialNote
+		err = perr
+	} else if perr != nil {
+		return nil, perr
+	}
+
+	var allInfo []*dockerUsageInfo
+	for i, a := range docker {
+		info := &dockerUsageInfo{
+			Organization: a.org.Entity.Name,
+			Space:        a.space.Entity.Name,
+			Application:  a.app.Entity.Name,
+			State:        a.app.Entity.State,
+			DockerImage:  a.app.Entity.DockerImage,
+		}
+		if dp := packages[i]; dp != nil {
+			if dp.Image != "" {
+				info.DockerImage = dp.Image
+			}
+			info.Credentials = dp.Username != ""
+			info.RegistryUsername = dp.Username
+		}
+		if info.DockerImage != "" {
+			info.Registry = dockerRegistry(info.DockerImage)
+		}
+		allInfo = append(allInfo, info)
+	}
+
+	sortDockerUsageInfo(allInfo, opts)
+
+	rerr := renderDockerUsageInfo(out, allInfo, opts)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return allInfo, err
+}
+
+// renderDockerUsageInfo writes allInfo to out in the format selected by opts
+func renderDockerUsageInfo(out io.Writer, allInfo []*dockerUsageInfo, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, allInfo, opts)
+	}
+
+	var rows [][]string
+	for _, info := range allInfo {
+		credentials := "no"
+		if info.Credentials {
+			credentials = "yes (" + info.RegistryUsername + ")"
+		}
+		rows = append(rows, []string{
+			info.Organization,
+			info.Space,
+			info.Application,
+			info.State,
+			info.DockerImage,
+			info.Registry,
+			credentials,
+		})
+	}
+	return renderRows(out, []string{"Organization", "Space", "Application", "App State", "Docker Image", "Registry", "Credentials"}, rows, opts)
+}
@@ -0,0 +1,110 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// dropletChunk is how many apps' droplets are listed by each request, which
+// keeps URLs well within the limits of proxies in front of the API
+const dropletChunk = 50
+
+// dropletCache holds current droplets listed in bulk, so each app's droplet
+// needn't be fetched separately. It is used by both foundations, as droplets
+// are only available from the v3 API.
+type dropletCache struct {
+	mu       sync.Mutex
+	droplets map[string]*Droplet
+}
+
+// prefetch lists the droplets of apps in chunks, and keeps the current one
+// of each, picked by the guid of the app's current_droplet relationship. The
+// droplets API can't select current droplets itself, and apps listed without
+// the relationship are left to be fetched one at a time. If the API can't
+// list a chunk, the droplets of its apps are also fetched one at a time,
+// while the remaining chunks are still listed, and a warning is logged once
+// all chunks have been tried.
+func (dc *dropletCache) prefetch(client CloudControllerClient, apps []*Resource) error {
+	current := make(map[string]string)
+	var guids []string
+	for _, app := range apps {
+		if app.Entity.DropletGuid != "" {
+			current[app.Metadata.Guid] = app.Entity.DropletGuid
+			guids = append(guids, app.Metadata.Guid)
+		}
+	}
+
+	failed := 0
+	var failure error
+	for start := 0; start < len(guids); start += dropletChunk {
+		end := start + dropletChunk
+		if end > len(guids) {
+			end = len(guids)
+		}
+		chunk := guids[start:end]
+
+		found := make(map[string]*Droplet)
+		err := client.ListV3("/v3/droplets?states=STAGED&app_guids="+url.QueryEscape(strings.Join(chunk, ",")), func(raw json.RawMessage) error {
+			var d struct {
+				Droplet
+				Guid          string `json:"guid"`
+				Relationships struct {
+					App struct {
+						Data struct {
+							Guid string `json:"guid"`
+						} `json:"data"`
+					} `json:"app"`
+				} `json:"relationships"`
+			}
+			err := json.Unmarshal(raw, &d)
+			if err != nil {
+				return err
+			}
+			appGuid := d.Relationships.App.Data.Guid
+			if d.Guid == current[appGuid] {
+				droplet := d.Droplet
+				found[appGuid] = &droplet
+			}
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			failed += len(chunk)
+			failure = err
+			continue
+		}
+
+		dc.mu.Lock()
+		if dc.droplets == nil {
+			dc.droplets = make(map[string]*Droplet)
+		}
+		for appGuid, d := range found {
+			dc.droplets[appGuid] = d
+		}
+		dc.mu.Unlock()
+	}
+	if failure != nil {
+		logf(levelWarn, nil, "listing droplets in bulk failed, fetching them for each of %d apps instead: %s", failed, failure)
+	}
+	return nil
+}
+
+// get returns the current droplet of the app with appGuid, from the cache
+// if it was prefetched, or else from the API. Apps without a current droplet
+// aren't listed, so are fetched to get the same not found error as before.
+func (dc *dropletCache) get(client CloudControllerClient, appGuid string) (*Droplet, error) {
+	dc.mu.Lock()
+	d, found := dc.droplets[appGuid]
+	delete(dc.droplets, appGuid)
+	dc.mu.Unlock()
+	if found {
+		return d, nil
+	}
+	return client.CurrentDroplet(appGuid)
+}
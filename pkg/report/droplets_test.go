@@ -0,0 +1,148 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/svrc-pivotal/cf-report-buildpacks/pkg/report/reporttest"
+)
+
+// testApps returns n apps, with guids a1 to an, whose current droplets are
+// d1 to dn
+func testApps(n int) []*Resource {
+	var apps []*Resource
+	for i := 1; i <= n; i++ {
+		app := &Resource{}
+		app.Metadata.Guid = fmt.Sprintf("a%d", i)
+		app.Entity.DropletGuid = fmt.Sprintf("d%d", i)
+		apps = append(apps, app)
+	}
+	return apps
+}
+
+// dropletJSON is a droplet of the app with appGuid, as listed, with its guid
+// as its stack too so it can be told apart once fetched
+func dropletJSON(guid, appGuid string) string {
+	return fmt.Sprintf(`{"guid":%q,"stack":%q,"relationships":{"app":{"data":{"guid":%q}}}}`, guid, guid, appGuid)
+}
+
+// droplets lists the droplets of the apps with guids, as listed by prefetch
+func droplets(guids string, resources ...string) (string, string) {
+	return "/v3/droplets?states=STAGED&app_guids=" + guids, `{"pagination":{},"resources":[` + strings.Join(resources, ",") + `]}`
+}
+
+func TestDropletCachePrefetch(t *testing.T) {
+	apps := testApps(3)
+	// a3 was listed without its current droplet, so isn't listed in bulk
+	apps[2].Entity.DropletGuid = ""
+
+	// a1 has an older droplet as well, and a2's current droplet isn't listed
+	uri, body := droplets("a1,a2", dropletJSON("d0", "a1"), dropletJSON("d1", "a1"))
+	srv := reporttest.NewServer(map[string]string{
+		uri:                            body,
+		"/v3/apps/a2/droplets/current": `{"stack":"d2"}`,
+	})
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	var dc dropletCache
+	err := dc.prefetch(client, apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := dc.get(client, "a1")
+	if err != nil || d.Stack != "d1" {
+		t.Errorf("a1: got %+v, %v, want prefetched d1", d, err)
+	}
+	d, err = dc.get(client, "a2")
+	if err != nil || d.Stack != "d2" {
+		t.Errorf("a2: got %+v, %v, want d2 fetched for the app", d, err)
+	}
+	_, err = dc.get(client, "a3")
+	if !isNotFound(err) {
+		t.Errorf("a3: got %v, want not found", err)
+	}
+
+	if unhandled := srv.Unhandled(); len(unhandled) != 1 || unhandled[0] != "GET /v3/apps/a3/droplets/current" {
+		t.Errorf("got unhandled requests %q, want only a3's droplet", unhandled)
+	}
+}
+
+func TestDropletCachePrefetchFailedChunks(t *testing.T) {
+	apps := testApps(2*dropletChunk + 1)
+
+	// only the last chunk can be listed
+	last, current := apps[2*dropletChunk].Metadata.Guid, apps[2*dropletChunk].Entity.DropletGuid
+	uri, body := droplets(last, dropletJSON(current, last))
+	srv := reporttest.NewServer(map[string]string{
+		uri:                            body,
+		"/v3/apps/a1/droplets/current": `{"stack":"d1"}`,
+	})
+	defer srv.Close()
+	client := newTestClient(t, srv)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	var dc dropletCache
+	err := dc.prefetch(client, apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := dc.get(client, last)
+	if err != nil || d.Stack != current {
+		t.Errorf("%s: got %+v, %v, want prefetched %s", last, d, err, current)
+	}
+	d, err = dc.get(client, "a1")
+	if err != nil || d.Stack != "d1" {
+		t.Errorf("a1: got %+v, %v, want d1 fetched for the app", d, err)
+	}
+	if n := strings.Count(logged.String(), "listing droplets in bulk failed"); n != 1 {
+		t.Errorf("warned %d times, want once:\n%s", n, logged.String())
+	}
+	if want := fmt.Sprintf("each of %d apps", 2*dropletChunk); !strings.Contains(logged.String(), want) {
+		t.Errorf("warning doesn't say %q:\n%s", want, logged.String())
+	}
+}
+
+func TestDropletsRejectsCurrent(t *testing.T) {
+	// only the droplets of a single app can be filtered by current
+	uri, body := droplets("a1")
+	srv := reporttest.NewServer(map[string]string{uri + "&current=true": body})
+	defer srv.Close()
+
+	err := newTestClient(t, srv).Get(uri+"&current=true", nil)
+	if ae, ok := err.(*apiError); !ok || ae.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v, want 400 as from the API", err)
+	}
+}
+
+func TestV3AppDropletGuid(t *testing.T) {
+	var vr v3Resource
+	err := json.Unmarshal([]byte(`{"guid":"a1","relationships":{"current_droplet":{"data":{"guid":"d1"}}}}`), &vr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v3App(&vr, nil).Entity.DropletGuid; got != "d1" {
+		t.Errorf("got droplet guid %q, want d1", got)
+	}
+
+	// apps that have never been staged have a null relationship
+	vr = v3Resource{}
+	err = json.Unmarshal([]byte(`{"guid":"a2","relationships":{"current_droplet":{"data":null}}}`), &vr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v3App(&vr, nil).Entity.DropletGuid; got != "" {
+		t.Errorf("got droplet guid %q, want none", got)
+	}
+}
@@ -0,0 +1,124 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// esBatchSize is how many rows are indexed per bulk request
+const esBatchSize = 1000
+
+// esDocument is a row indexed by -export-elasticsearch, with the time of the
+// run so that runs can be told apart in Kibana
+type esDocument struct {
+	Timestamp string `json:"@timestamp"`
+	*AppBuildpackInfo
+}
+
+// esBulkResponse is the part of a bulk API response needed to find out
+// whether any rows failed to be indexed
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// bulkURL returns the bulk API URL for u, which must include the index, eg
+// https://es.example.com:9200/buildpacks
+func bulkURL(u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	index := strings.Trim(parsed.Path, "/")
+	if parsed.Host == "" || index == "" || strings.Contains(index, "/") {
+		return "", fmt.Errorf("-export-elasticsearch must be the URL of an index, eg https://es.example.com:9200/buildpacks")
+	}
+	parsed.Path = "/" + index + "/_bulk"
+	return parsed.String(), nil
+}
+
+// exportElasticsearch indexes each row of allInfo, stamped with runTime, in
+// the index at u with the bulk API. Credentials may be given in u, or as an
+// API key.
+func exportElasticsearch(u, apiKey string, allInfo []*AppBuildpackInfo, runTime time.Time) error {
+	bu, err := bulkURL(u)
+	if err != nil {
+		return err
+	}
+	timestamp := runTime.UTC().Format(time.RFC3339)
+	for start := 0; start < len(allInfo); start += esBatchSize {
+		end := start + esBatchSize
+		if end > len(allInfo) {
+			end = len(allInfo)
+		}
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, info := range allInfo[start:end] {
+			body.WriteString(`{"index":{}}` + "\n")
+			err = enc.Encode(&esDocument{Timestamp: timestamp, AppBuildpackInfo: info})
+			if err != nil {
+				return err
+			}
+		}
+		err = postBulk(bu, apiKey, &body)
+		if err != nil {
+			return fmt.Errorf("exporting to Elasticsearch: %s", err)
+		}
+	}
+	return nil
+}
+
+// postBulk POSTs a bulk request body to u, returning an error if the request
+// or any of its items failed
+func postBulk(u, apiKey string, body *bytes.Buffer) error {
+	req, err := http.NewRequest(http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+	}
+	resp, err := externalClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// don't include the URL, it may include credentials
+		return newAPIError(http.MethodPost, req.URL.Host, resp)
+	}
+
+	var br esBulkResponse
+	err = json.NewDecoder(resp.Body).Decode(&br)
+	if err != nil {
+		return fmt.Errorf("reading bulk response: %s", err)
+	}
+	if !br.Errors {
+		return nil
+	}
+	failed := 0
+	reason := ""
+	for _, item := range br.Items {
+		for _, result := range item {
+			if result.Error != nil {
+				failed++
+				if reason == "" {
+					reason = result.Error.Type + ": " + result.Error.Reason
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%d of %d rows were not indexed, eg %s", failed, len(br.Items), reason)
+}
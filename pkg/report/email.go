@@ -0,0 +1,146 @@
+package report
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// emailOptions controls emailing the report once it is collected. SMTP
+// settings default to the REPORT_SMTP_* environment variables.
+type emailOptions struct {
+	// To - addresses to send the report to, if not set no email is sent
+	To stringList
+
+	// From - address the report is sent from
+	From string
+
+	// Format - format of the attached report, html or csv
+	Format string
+
+	// SMTPAddr - host:port of the SMTP server
+	SMTPAddr string
+
+	// Username and Password - if Username is set, used to authenticate to the SMTP server
+	Username string
+	Password string
+}
+
+// emailFormats are the values accepted by -email-format
+var emailFormats = map[string]string{
+	"html": "text/html; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+}
+
+// validate returns an error if eopts can't be used to send email
+func (eopts *emailOptions) validate() error {
+	if len(eopts.To) == 0 {
+		return nil
+	}
+	if _, found := emailFormats[eopts.Format]; !found {
+		return fmt.Errorf("unknown email format %q, expected html or csv", eopts.Format)
+	}
+	if eopts.SMTPAddr == "" || eopts.From == "" {
+		return fmt.Errorf("-email-to requires -smtp-addr and -email-from, or REPORT_SMTP_ADDR and REPORT_SMTP_FROM")
+	}
+	return nil
+}
+
+// emailReport renders allInfo in eopts.Format and emails it as an attachment
+func emailReport(eopts *emailOptions, allInfo []*AppBuildpackInfo, opts *Options) error {
+	ro := *opts
+	ro.OutputHTML = eopts.Format == "html"
+	ro.OutputCSV = eopts.Format == "csv"
+	var report bytes.Buffer
+	err := Render(&report, allInfo, &ro)
+	if err != nil {
+		return err
+	}
+
+	attention := 0
+	for _, info := range allInfo {
+		if info.needsAttention() {
+			attention++
+		}
+	}
+
+	date := time.Now().UTC().Format("2006-01-02")
+	msg, err := emailMessage(eopts, fmt.Sprintf("Cloud Foundry buildpack report %s", date),
+		fmt.Sprintf("%d of %d apps need attention. The full report is attached.\r\n", attention, len(allInfo)),
+		fmt.Sprintf("report-buildpacks-%s.%s", date, eopts.Format), report.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if eopts.Username != "" {
+		host, _, err := net.SplitHostPort(eopts.SMTPAddr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", eopts.Username, eopts.Password, host)
+	}
+	err = smtp.SendMail(eopts.SMTPAddr, auth, eopts.From, eopts.To, msg)
+	if err != nil {
+		return fmt.Errorf("emailing report: %s", err)
+	}
+	return nil
+}
+
+// emailMessage builds a multipart message with body as text and attachment
+// attached as filename
+func emailMessage(eopts *emailOptions, subject, body, filename string, attachment []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", eopts.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(eopts.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	w, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write([]byte(body))
+	if err != nil {
+		return nil, err
+	}
+
+	w, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {emailFormats[eopts.Format]},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", filename)},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// base64 lines may be at most 76 characters, ie 57 bytes of input
+	for len(attachment) > 0 {
+		n := 57
+		if len(attachment) < n {
+			n = len(attachment)
+		}
+		_, err = fmt.Fprintf(w, "%s\r\n", base64.StdEncoding.EncodeToString(attachment[:n]))
+		if err != nil {
+			return nil, err
+		}
+		attachment = attachment[n:]
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,75 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody is how much of a response body is kept in an apiError
+const maxErrorBody = 512
+
+// apiError is returned when the API responds with a non-2xx status code
+type apiError struct {
+	Method     string
+	URL        string
+	StatusCode int
+
+	// Body - the start of the response body, which usually describes the error
+	Body string
+}
+
+// newAPIError reads up to maxErrorBody bytes of resp's body into an apiError
+func newAPIError(method, u string, resp *http.Response) *apiError {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody+1))
+	body := strings.TrimSpace(string(b))
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody] + "..."
+	}
+	return &apiError{
+		Method:     method,
+		URL:        u,
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+}
+
+func (ae *apiError) Error() string {
+	rv := fmt.Sprintf("%s %s: %s (%s)", ae.Method, ae.URL, http.StatusText(ae.StatusCode), ae.kind())
+	if ae.Body != "" {
+		rv += ": " + ae.Body
+	}
+	return rv
+}
+
+// kind classifies the error, so that callers and users can tell permission
+// problems apart from missing resources and server problems
+func (ae *apiError) kind() string {
+	switch {
+	case ae.StatusCode == http.StatusUnauthorized:
+		return "unauthorized"
+	case ae.StatusCode == http.StatusForbidden:
+		return "permission denied"
+	case ae.StatusCode == http.StatusNotFound:
+		return "not found"
+	case ae.StatusCode == http.StatusTooManyRequests:
+		return "rate limited"
+	case ae.StatusCode/100 == 5:
+		return "server error"
+	default:
+		return fmt.Sprintf("status %d", ae.StatusCode)
+	}
+}
+
+// isPermissionDenied returns true if err is an apiError for a 401 or 403 response
+func isPermissionDenied(err error) bool {
+	ae, ok := err.(*apiError)
+	return ok && (ae.StatusCode == http.StatusUnauthorized || ae.StatusCode == http.StatusForbidden)
+}
+
+// isNotFound returns true if err is an apiError for a 404 response
+func isNotFound(err error) bool {
+	ae, ok := err.(*apiError)
+	return ok && ae.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stringList is a flag.Value that may be repeated, or given a comma-separated
+// list, ie "-org a -org b" and "-org a,b" are equivalent
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			*sl = append(*sl, s)
+		}
+	}
+	return nil
+}
+
+// contains returns true if s is in sl
+func (sl stringList) contains(s string) bool {
+	for _, v := range sl {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// headerList is a flag.Value that may be repeated, each value being a
+// "Name: value" HTTP header
+type headerList map[string]string
+
+func (hl headerList) String() string {
+	var rv []string
+	for k, v := range hl {
+		rv = append(rv, k+": "+v)
+	}
+	return strings.Join(rv, ", ")
+}
+
+func (hl headerList) Set(v string) error {
+	i := strings.Index(v, ":")
+	if i <= 0 {
+		return fmt.Errorf("expected \"Name: value\", got %q", v)
+	}
+	hl[strings.TrimSpace(v[:i])] = strings.TrimSpace(v[i+1:])
+	return nil
+}
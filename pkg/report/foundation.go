@@ -0,0 +1,1879 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resource captures fields that we care about when
+// retrieving data from CloudFoundry
+type Resource struct {
+	Metadata struct {
+		Guid      string    `json:"guid"`       // app
+		UpdatedAt time.Time `json:"updated_at"` // buildpack
+	} `json:"metadata"`
+	Entity struct {
+		Name               string // org, space
+		SpacesURL          string `json:"spaces_url"`           // org
+		UsersURL           string `json:"users_url"`            // org
+		ManagersURL        string `json:"managers_url"`         // org, space
+		BillingManagersURL string `json:"billing_managers_url"` // org
+		AuditorsURL        string `json:"auditors_url"`         // org, space
+		DevelopersURL      string `json:"developers_url"`       // space
+		AppsURL            string `json:"apps_url"`             // space
+		DetectedBuildpack  string `json:"detected_buildpack"`   // app
+		Buildpack          string `json:"buildpack"`            // app
+		Memory             int64  `json:"memory"`               // app
+		Instances          int64  `json:"instances"`            // app
+		StackGuid          string `json:"stack_guid"`           // app
+		State              string `json:"state"`                // app
+		DockerImage        string `json:"docker_image"`         // app
+		Lifecycle          string `json:"-"`                    // app, lifecycleBuildpack or lifecycleDocker
+		Stack              string `json:"stack"`                // buildpack, app (filled in from StackGuid)
+
+		Admin            bool      // user
+		Username         string    // user
+		Filename         string    `json:"filename"`           // buildpack
+		Enabled          bool      `json:"enabled"`            // buildpack
+		Locked           bool      `json:"locked"`             // buildpack
+		Position         int       `json:"position"`           // buildpack
+		PackageUpdatedAt time.Time `json:"package_updated_at"` // app
+		Host             string    `json:"host"`               // route
+		Path             string    `json:"path"`               // route
+		Port             *int      `json:"port"`               // route, TCP routes only
+		DomainURL        string    `json:"domain_url"`         // route
+
+		ServiceInstanceURL string `json:"service_instance_url"` // service binding
+		AppGuid            string `json:"app_guid"`             // service binding
+		Type               string `json:"type"`                 // service instance
+		ServicePlanURL     string `json:"service_plan_url"`     // service instance
+		ServiceBindingsURL string `json:"service_bindings_url"` // service instance
+		ServiceURL         string `json:"service_url"`          // service plan
+		Label              string `json:"label"`                // service
+
+		LastOperation     *lastOperation     `json:"last_operation"`     // service instance
+		DockerCredentials *dockerCredentials `json:"docker_credentials"` // app
+
+		QuotaURL         string `json:"quota_definition_url"`       // org
+		SpaceQuotaURL    string `json:"space_quota_definition_url"` // space
+		MemoryLimit      int64  `json:"memory_limit"`               // quota
+		AppInstanceLimit int64  `json:"app_instance_limit"`         // quota
+
+		// ProcessMemory - memory reserved by all instances of each type of
+		// process, eg web and worker, in MB
+		ProcessMemory map[string]int64 `json:"process_memory,omitempty"` // app
+
+		// ProcessInstances - instances of all processes
+		ProcessInstances int64 `json:"process_instances,omitempty"` // app
+
+		// AppMetadata - labels and annotations, if listed with the v3 API
+		AppMetadata *AppMetadata `json:"-"` // app
+
+		// DropletGuid - the guid of the current droplet, if the v3 API
+		// listed the app with its current_droplet relationship
+		DropletGuid string `json:"-"` // app
+
+		// Space and Organization - inlined in v2 app listings by AllApps,
+		// and cleared once extracted
+		Space        *Resource `json:"space,omitempty"`        // app
+		Organization *Resource `json:"organization,omitempty"` // space
+	} `json:"entity"`
+}
+
+// totalMemory returns the memory reserved by all processes of the app in
+// MB, or by its web process if processes have not been listed
+func (r *Resource) totalMemory() int64 {
+	if r.Entity.ProcessMemory == nil {
+		return r.Entity.Memory * r.Entity.Instances
+	}
+	var rv int64
+	for _, m := range r.Entity.ProcessMemory {
+		rv += m
+	}
+	return rv
+}
+
+// totalInstances returns the instances of all processes of the app, or of
+// its web process if processes have not been listed
+func (r *Resource) totalInstances() int64 {
+	if r.Entity.ProcessMemory == nil {
+		return r.Entity.Instances
+	}
+	return r.Entity.ProcessInstances
+}
+
+// App lifecycle types
+const (
+	lifecycleBuildpack = "buildpack"
+	lifecycleDocker    = "docker"
+)
+
+// Droplet captures the fields of an app's current droplet that we care about
+type Droplet struct {
+	CreatedAt  time.Time `json:"created_at"`
+	Image      string    `json:"image"` // docker apps only
+	Stack      string    `json:"stack"`
+	Buildpacks []struct {
+		Name          string `json:"name"`
+		BuildpackName string `json:"buildpack_name"`
+		Version       string `json:"version"`
+	} `json:"buildpacks"`
+}
+
+// DockerPackage captures the fields of a docker app's package that we care
+// about
+type DockerPackage struct {
+	Image string `json:"image"`
+
+	// Username - the user the image is pulled from a private registry as, if
+	// credentials are used
+	Username string `json:"username,omitempty"`
+}
+
+// Role is a role a user has in an org or space
+type Role struct {
+	// Type - a v3 role type, eg organization_manager or space_developer
+	Type string `json:"type"`
+
+	// Username - the user's username, or their guid if they don't have one,
+	// as for UAA clients
+	Username string `json:"username"`
+}
+
+// OrgIsolationSegments are the names of the isolation segments an org is
+// entitled to, and of its default segment if it has one
+type OrgIsolationSegments struct {
+	Entitled []string `json:"entitled,omitempty"`
+	Default  string   `json:"default,omitempty"`
+}
+
+// Quota captures the limits of an org or space quota that we care about. A
+// nil limit is unlimited.
+type Quota struct {
+	Name string `json:"name"`
+
+	// MemoryLimit - total memory of all app instances, in MB
+	MemoryLimit *int64 `json:"memory_limit,omitempty"`
+
+	// InstanceLimit - total instances of all apps
+	InstanceLimit *int64 `json:"instance_limit,omitempty"`
+}
+
+// v2Unlimited is how the v2 API says a quota has no limit
+const v2Unlimited = -1
+
+// limit returns v as a Quota limit
+func limit(v int64) *int64 {
+	if v == v2Unlimited {
+		return nil
+	}
+	return &v
+}
+
+// dockerCredentials are the credentials a v2 app's image is pulled with, of
+// which the API only returns the username
+type dockerCredentials struct {
+	Username string `json:"username"`
+}
+
+// ServiceInstance captures the fields of a service instance that we care
+// about, with the names of its plan and offering looked up
+type ServiceInstance struct {
+	Guid string `json:"guid"`
+	Name string `json:"name"`
+
+	// Type - serviceManaged or serviceUserProvided
+	Type string `json:"type"`
+
+	// Offering and Plan - the service and plan of a managed instance, eg
+	// postgres and small
+	Offering string `json:"offering,omitempty"`
+	Plan     string `json:"plan,omitempty"`
+
+	// AppGuids - guids of the apps the instance is bound to
+	AppGuids []string `json:"app_guids,omitempty"`
+
+	// LastOperation - eg "create succeeded", and when it last changed
+	LastOperation   string     `json:"last_operation,omitempty"`
+	LastOperationAt *time.Time `json:"last_operation_at,omitempty"`
+}
+
+// Service instance types
+const (
+	serviceManaged      = "managed"
+	serviceUserProvided = "user-provided"
+)
+
+// lastOperation is the last operation on a service instance, which v2 and v3
+// return in the same shape
+type lastOperation struct {
+	Type      string    `json:"type"`
+	State     string    `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// set sets the LastOperation of si to op, if there was one
+func (op *lastOperation) set(si *ServiceInstance) {
+	if op == nil || op.Type == "" {
+		return
+	}
+	si.LastOperation = op.Type + " " + op.State
+	if !op.UpdatedAt.IsZero() {
+		updatedAt := op.UpdatedAt
+		si.LastOperationAt = &updatedAt
+	}
+}
+
+// Revision captures the fields of an app revision that we care about, with
+// the buildpacks its droplet was staged with looked up
+type Revision struct {
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	Description string    `json:"description,omitempty"`
+
+	// Buildpacks - the buildpacks and versions the droplet was staged with,
+	// eg "java v4.50", if the droplet still exists
+	Buildpacks []string `json:"buildpacks,omitempty"`
+}
+
+// AppHealth captures how an app's health is checked, and the state of its
+// instances
+type AppHealth struct {
+	// HealthCheckType - of the web process, eg port, process or http
+	HealthCheckType string `json:"health_check_type,omitempty"`
+
+	// Running and Crashed - the number of instances of all processes in
+	// each state
+	Running int `json:"running"`
+	Crashed int `json:"crashed"`
+}
+
+// maxTasks is how many of an app's most recent tasks are listed
+const maxTasks = 5
+
+// Task is a one-off or scheduled process run with an app's droplet
+type Task struct {
+	Name       string    `json:"name"`
+	State      string    `json:"state"`
+	MemoryInMB int64     `json:"memory_in_mb"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Sidecar is an additional process run alongside some of an app's
+// processes, in the same containers
+type Sidecar struct {
+	Name         string   `json:"name"`
+	ProcessTypes []string `json:"process_types"`
+
+	// MemoryInMB - memory reserved by each instance of the sidecar, or 0 if
+	// it doesn't reserve any
+	MemoryInMB int64 `json:"memory_in_mb,omitempty"`
+
+	// TotalMemory - memory reserved by the sidecar across all instances of
+	// the processes it runs alongside, in MB
+	TotalMemory int64 `json:"total_memory,omitempty"`
+}
+
+// AppEvent is an audit event recording a change to an app
+type AppEvent struct {
+	// Action - one of the appEvents values, eg "restaged"
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// appEvents are the audit event types reported by -include-events, and the
+// action each records
+var appEvents = map[string]string{
+	"audit.app.package.upload": "pushed",
+	"audit.app.restage":        "restaged",
+	"audit.app.restart":        "restarted",
+	"audit.app.start":          "started",
+}
+
+// maxRevisions is how many of an app's most recent revisions are listed
+const maxRevisions = 5
+
+// CloudControllerClient makes requests to the CloudController API for a
+// Client. It is implemented by the client that calls the API the cf CLI is
+// logged in to, and can be faked to test reporting without a foundation.
+type CloudControllerClient interface {
+	// Get fetches r, a path relative to the API, and decodes the JSON
+	// response into rv
+	Get(r string, rv interface{}) error
+
+	// Do sends a request with body encoded as JSON, decoding any response
+	// into rv if not nil
+	Do(method, r string, body, rv interface{}) error
+
+	// List calls f with each resource in every page of the v2 list at r
+	List(r string, f func(*Resource) error) error
+
+	// ListV3 calls f with each resource in every page of the v3 list at r
+	ListV3(r string, f func(json.RawMessage) error) error
+
+	// CurrentDroplet fetches the current droplet of the app with appGuid
+	CurrentDroplet(appGuid string) (*Droplet, error)
+}
+
+// errAllAppsUnsupported is returned by Client.AllApps if apps must be listed
+// space by space instead
+var errAllAppsUnsupported = errors.New("listing all apps at once is not supported")
+
+// Client lists the buildpacks, orgs, spaces and apps of a CloudFoundry
+// installation, using whichever version of the API it was created for.
+// Resources are returned in the v2 shape regardless.
+type Client interface {
+	Buildpacks(f func(*Resource) error) error
+	Orgs(f func(*Resource) error) error
+	Spaces(org *Resource, f func(*Resource) error) error
+	Apps(space *Resource, f func(*Resource) error) error
+
+	// AllApps lists every app along with its org and space, in far fewer
+	// requests than listing the apps of each space. It returns
+	// errAllAppsUnsupported if the foundation can't list them this way.
+	AllApps(f func(org, space, app *Resource) error) error
+
+	// Org fetches the org with guid, and Space the space with guid in org,
+	// without listing the others, which non-admins may not be able to do
+	Org(guid string) (*Resource, error)
+	Space(org *Resource, guid string) (*Resource, error)
+
+	// Contacts returns the usernames of the developers and managers of space
+	Contacts(space *Resource) ([]string, error)
+
+	// Routes returns the URLs of the routes mapped to app
+	Routes(app *Resource) ([]string, error)
+
+	// Services returns the names of the service instances bound to app
+	Services(app *Resource) ([]string, error)
+
+	// OrgRoles returns the roles users have in org
+	OrgRoles(org *Resource) ([]*Role, error)
+
+	// SpaceRoles returns the roles users have in space
+	SpaceRoles(space *Resource) ([]*Role, error)
+
+	// OrgIsolationSegments returns the isolation segments org is entitled
+	// to, and its default
+	OrgIsolationSegments(org *Resource) (*OrgIsolationSegments, error)
+
+	// SpaceIsolationSegment returns the name of the isolation segment space
+	// is assigned to, or "" if it isn't
+	SpaceIsolationSegment(space *Resource) (string, error)
+
+	// OrgQuota returns the quota of org
+	OrgQuota(org *Resource) (*Quota, error)
+
+	// SpaceQuota returns the quota of space, or nil if it has none
+	SpaceQuota(space *Resource) (*Quota, error)
+
+	// Revisions returns the most recent revisions of app, newest first
+	Revisions(app *Resource) ([]*Revision, error)
+
+	// Health returns the health check type of app, and its running and
+	// crashed instances
+	Health(app *Resource) (*AppHealth, error)
+
+	// Tasks returns the most recent tasks of app, newest first
+	Tasks(app *Resource) ([]*Task, error)
+
+	// Sidecars returns the sidecars of app
+	Sidecars(app *Resource) ([]*Sidecar, error)
+
+	// LastEvent returns the most recent push, restage, restart or start of
+	// app, or nil if there is none
+	LastEvent(app *Resource) (*AppEvent, error)
+
+	// AppMetadata returns the labels and annotations of app
+	AppMetadata(app *Resource) (*AppMetadata, error)
+
+	// InFlight describes the deployment or build in progress for app, eg
+	// "a rolling deployment is DEPLOYING", or returns "" if there is none
+	InFlight(app *Resource) (string, error)
+
+	// DockerPackage returns the image of the docker app, and the registry
+	// username if any
+	DockerPackage(app *Resource) (*DockerPackage, error)
+
+	// ServiceInstances lists the service instances in space, including user
+	// provided ones
+	ServiceInstances(space *Resource, f func(*ServiceInstance) error) error
+
+	// PrefetchDroplets lists the current droplets of apps in bulk, so that
+	// Droplet needn't fetch each one
+	PrefetchDroplets(apps []*Resource) error
+
+	// Droplet returns the current droplet of app
+	Droplet(app *Resource) (*Droplet, error)
+
+	// Restage restages the app with appGuid and starts it with the new droplet
+	Restage(appGuid string) error
+
+	// Annotate sets annotations on the app with appGuid. Empty values remove
+	// an annotation.
+	Annotate(appGuid string, annotations map[string]string) error
+}
+
+// NewClient returns a Client for the API conn is logged in to, listing with
+// apiVersion as newFoundation does. plugin.CliConnection is a Connection.
+func NewClient(conn Connection, apiVersion string) (Client, error) {
+	client, err := newSimpleClient(conn, true, defaultConcurrency, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return newFoundation(client, apiVersion)
+}
+
+// NewClientWith returns a Client that makes its requests with cc, eg a fake
+// of the API for tests, listing with apiVersion as newFoundation does
+func NewClientWith(cc CloudControllerClient, apiVersion string) (Client, error) {
+	return newFoundation(cc, apiVersion)
+}
+
+// newFoundation returns a foundation for apiVersion, which is one of
+// "2", "3" or "auto". If "auto", the root endpoint is queried and the v2
+// API is used if it is still advertised
+func newFoundation(client CloudControllerClient, apiVersion string) (Client, error) {
+	switch apiVersion {
+	case "2":
+		return &v2Foundation{client: client}, nil
+	case "3":
+		return &v3Foundation{client: client}, nil
+	case "auto":
+		var root struct {
+			Links struct {
+				CloudControllerV2 *struct {
+					Href string `json:"href"`
+				} `json:"cloud_controller_v2"`
+			} `json:"links"`
+		}
+		err := client.Get("/", &root)
+		if err != nil {
+			return nil, err
+		}
+		if root.Links.CloudControllerV2 == nil {
+			return &v3Foundation{client: client}, nil
+		}
+		return &v2Foundation{client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown API version %q, expected 2, 3 or auto", apiVersion)
+	}
+}
+
+// v2Foundation lists resources with the v2 API
+type v2Foundation struct {
+	client CloudControllerClient
+
+	// current droplets listed in bulk by PrefetchDroplets
+	droplets dropletCache
+
+	// stack names by guid, loaded on first use
+	stacksOnce sync.Once
+	stacks     map[string]string
+	stacksErr  error
+
+	// domains, service plans and services by URL, as they are shared by
+	// many routes and service instances
+	cacheMu sync.Mutex
+	cache   map[string]*Resource
+}
+
+func (v2 *v2Foundation) Buildpacks(f func(*Resource) error) error {
+	return v2.client.List("/v2/buildpacks", f)
+}
+
+func (v2 *v2Foundation) Orgs(f func(*Resource) error) error {
+	return v2.client.List("/v2/organizations", f)
+}
+
+func (v2 *v2Foundation) Spaces(org *Resource, f func(*Resource) error) error {
+	return v2.client.List(org.Entity.SpacesURL, f)
+}
+
+func (v2 *v2Foundation) Org(guid string) (*Resource, error) {
+	rv := &Resource{}
+	err := v2.client.Get("/v2/organizations/"+url.PathEscape(guid), rv)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func (v2 *v2Foundation) Space(org *Resource, guid string) (*Resource, error) {
+	rv := &Resource{}
+	err := v2.client.Get("/v2/spaces/"+url.PathEscape(guid), rv)
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// Apps lists the apps in space. v2 apps only reference their stack by guid,
+// so the stack name is filled in from a listing of all stacks. Memory of
+// processes other than web is only available from the v3 API.
+func (v2 *v2Foundation) Apps(space *Resource, f func(*Resource) error) error {
+	err := v2.loadStacks()
+	if err != nil {
+		return err
+	}
+
+	processes, err := spaceProcesses(v2.client, space)
+	if err != nil {
+		return err
+	}
+
+	return v2.client.List(space.Entity.AppsURL, func(app *Resource) error {
+		v2.fillApp(app, processes[app.Metadata.Guid])
+		return f(app)
+	})
+}
+
+// AllApps lists every app with its space and org inlined, rather than
+// listing the orgs, then the spaces of each, then the apps of each space.
+// The processes of all apps are listed at once too.
+func (v2 *v2Foundation) AllApps(f func(org, space, app *Resource) error) error {
+	err := v2.loadStacks()
+	if err != nil {
+		return err
+	}
+
+	processes, err := allProcesses(v2.client)
+	if err != nil {
+		return err
+	}
+
+	// each app has its own copy of its space and org, so share the first
+	// seen, as later phases look them up by guid
+	orgs := make(map[string]*Resource)
+	spaces := make(map[string]*Resource)
+	return v2.client.List("/v2/apps?inline-relations-depth=2&include-relations=space,organization", func(app *Resource) error {
+		space := app.Entity.Space
+		app.Entity.Space = nil
+		if space == nil || space.Entity.Organization == nil {
+			return fmt.Errorf("the space and org of app %s were not inlined", app.Entity.Name)
+		}
+		org := space.Entity.Organization
+		space.Entity.Organization = nil
+		if s, found := spaces[space.Metadata.Guid]; found {
+			space = s
+		} else {
+			spaces[space.Metadata.Guid] = space
+		}
+		if o, found := orgs[org.Metadata.Guid]; found {
+			org = o
+		} else {
+			orgs[org.Metadata.Guid] = org
+		}
+
+		v2.fillApp(app, processes[app.Metadata.Guid])
+		return f(org, space, app)
+	})
+}
+
+// loadStacks lists all stacks on first use, as v2 apps only reference their
+// stack by guid
+func (v2 *v2Foundation) loadStacks() error {
+	v2.stacksOnce.Do(func() {
+		v2.stacks = make(map[string]string)
+		v2.stacksErr = v2.client.List("/v2/stacks", func(stack *Resource) error {
+			v2.stacks[stack.Metadata.Guid] = stack.Entity.Name
+			return nil
+		})
+	})
+	return v2.stacksErr
+}
+
+// fillApp fills in the fields of app that the v2 API doesn't return, from
+// its processes and the stacks listed by loadStacks
+func (v2 *v2Foundation) fillApp(app *Resource, processes []*v3Resource) {
+	app.Entity.ProcessMemory = processMemory(processes)
+	app.Entity.ProcessInstances = processInstances(processes)
+	app.Entity.Stack = v2.stacks[app.Entity.StackGuid]
+	app.Entity.Lifecycle = lifecycleBuildpack
+	if app.Entity.DockerImage != "" {
+		app.Entity.Lifecycle = lifecycleDocker
+	}
+}
+
+func (v2 *v2Foundation) Contacts(space *Resource) ([]string, error) {
+	var rv []string
+	for _, r := range []string{space.Entity.DevelopersURL, space.Entity.ManagersURL} {
+		err := v2.client.List(r, func(user *Resource) error {
+			rv = append(rv, user.Entity.Username)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return uniqueContacts(rv), nil
+}
+
+// Routes lists the routes mapped to app, looking up the name of each route's
+// domain
+func (v2 *v2Foundation) Routes(app *Resource) ([]string, error) {
+	var rv []string
+	err := v2.client.List("/v2/apps/"+url.PathEscape(app.Metadata.Guid)+"/routes", func(route *Resource) error {
+		domain, err := v2.cached(route.Entity.DomainURL)
+		if err != nil {
+			return err
+		}
+		u := domain.Entity.Name
+		if route.Entity.Host != "" {
+			u = route.Entity.Host + "." + u
+		}
+		if route.Entity.Port != nil {
+			u += ":" + strconv.Itoa(*route.Entity.Port)
+		}
+		rv = append(rv, u+route.Entity.Path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+// Services lists the service bindings of app, and looks up the name of the
+// service instance of each
+func (v2 *v2Foundation) Services(app *Resource) ([]string, error) {
+	var urls []string
+	err := v2.client.List("/v2/apps/"+url.PathEscape(app.Metadata.Guid)+"/service_bindings", func(binding *Resource) error {
+		urls = append(urls, binding.Entity.ServiceInstanceURL)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	for _, u := range urls {
+		var instance Resource
+		err = v2.client.Get(u, &instance)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, instance.Entity.Name)
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+func (v2 *v2Foundation) OrgRoles(org *Resource) ([]*Role, error) {
+	return v2.roles(map[string]string{
+		"organization_user":            org.Entity.UsersURL,
+		"organization_manager":         org.Entity.ManagersURL,
+		"organization_billing_manager": org.Entity.BillingManagersURL,
+		"organization_auditor":         org.Entity.AuditorsURL,
+	})
+}
+
+func (v2 *v2Foundation) SpaceRoles(space *Resource) ([]*Role, error) {
+	return v2.roles(map[string]string{
+		"space_developer": space.Entity.DevelopersURL,
+		"space_manager":   space.Entity.ManagersURL,
+		"space_auditor":   space.Entity.AuditorsURL,
+	})
+}
+
+// roles lists the users at the URL for each type of role
+func (v2 *v2Foundation) roles(urls map[string]string) ([]*Role, error) {
+	var rv []*Role
+	for t, u := range urls {
+		if u == "" {
+			continue
+		}
+		err := v2.client.List(u, func(user *Resource) error {
+			username := user.Entity.Username
+			if username == "" {
+				username = user.Metadata.Guid
+			}
+			rv = append(rv, &Role{Type: t, Username: username})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rv, nil
+}
+
+// OrgIsolationSegments looks up the org's isolation segments with the v3
+// API, as v2 has no endpoints for them
+func (v2 *v2Foundation) OrgIsolationSegments(org *Resource) (*OrgIsolationSegments, error) {
+	return orgIsolationSegments(v2.client, org)
+}
+
+func (v2 *v2Foundation) SpaceIsolationSegment(space *Resource) (string, error) {
+	return spaceIsolationSegment(v2.client, space)
+}
+
+func (v2 *v2Foundation) OrgQuota(org *Resource) (*Quota, error) {
+	return v2.quota(org.Entity.QuotaURL)
+}
+
+func (v2 *v2Foundation) SpaceQuota(space *Resource) (*Quota, error) {
+	if space.Entity.SpaceQuotaURL == "" {
+		return nil, nil
+	}
+	return v2.quota(space.Entity.SpaceQuotaURL)
+}
+
+// quota returns the quota definition at u, as quotas are shared by many orgs
+// and spaces
+func (v2 *v2Foundation) quota(u string) (*Quota, error) {
+	q, err := v2.cached(u)
+	if err != nil {
+		return nil, err
+	}
+	return &Quota{Name: q.Entity.Name, MemoryLimit: limit(q.Entity.MemoryLimit), InstanceLimit: limit(q.Entity.AppInstanceLimit)}, nil
+}
+
+// Revisions lists the app's revisions with the v3 API, as v2 has no
+// endpoint for them
+func (v2 *v2Foundation) Revisions(app *Resource) ([]*Revision, error) {
+	return listRevisions(v2.client, app.Metadata.Guid)
+}
+
+// Health looks up the app's processes and their stats with the v3 API, which
+// has the health check type of each process rather than only of web
+func (v2 *v2Foundation) Health(app *Resource) (*AppHealth, error) {
+	return appHealth(v2.client, app.Metadata.Guid)
+}
+
+// Tasks lists the app's tasks with the v3 API, as v2 has no endpoint for
+// them
+func (v2 *v2Foundation) Tasks(app *Resource) ([]*Task, error) {
+	return listTasks(v2.client, app.Metadata.Guid)
+}
+
+// Sidecars lists the app's sidecars with the v3 API, as v2 has no endpoint
+// for them
+func (v2 *v2Foundation) Sidecars(app *Resource) ([]*Sidecar, error) {
+	return appSidecars(v2.client, app.Metadata.Guid)
+}
+
+// LastEvent looks up audit events with the v3 API, whose actors are named
+// more consistently than v2's
+func (v2 *v2Foundation) LastEvent(app *Resource) (*AppEvent, error) {
+	return lastAppEvent(v2.client, app.Metadata.Guid)
+}
+
+// AppMetadata fetches the app with the v3 API, as v2 has no labels or
+// annotations
+func (v2 *v2Foundation) AppMetadata(app *Resource) (*AppMetadata, error) {
+	return appMetadata(v2.client, app.Metadata.Guid)
+}
+
+// InFlight looks for deployments and builds with the v3 API, as v2 has no
+// endpoints for them
+func (v2 *v2Foundation) InFlight(app *Resource) (string, error) {
+	return inFlight(v2.client, app.Metadata.Guid)
+}
+
+// DockerPackage returns the image and credentials of app, which v2 lists
+// with the app
+func (v2 *v2Foundation) DockerPackage(app *Resource) (*DockerPackage, error) {
+	rv := &DockerPackage{Image: app.Entity.DockerImage}
+	if app.Entity.DockerCredentials != nil {
+		rv.Username = app.Entity.DockerCredentials.Username
+	}
+	return rv, nil
+}
+
+func (v2 *v2Foundation) ServiceInstances(space *Resource, f func(*ServiceInstance) error) error {
+	var instances []*Resource
+	err := v2.client.List("/v2/spaces/"+url.PathEscape(space.Metadata.Guid)+"/service_instances?return_user_provided_service_instances=true", func(instance *Resource) error {
+		instances = append(instances, instance)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		si := &ServiceInstance{Guid: instance.Metadata.Guid, Name: instance.Entity.Name, Type: serviceManaged}
+		if instance.Entity.Type == "user_provided_service_instance" {
+			si.Type = serviceUserProvided
+		}
+		instance.Entity.LastOperation.set(si)
+
+		if instance.Entity.ServicePlanURL != "" {
+			plan, err := v2.cached(instance.Entity.ServicePlanURL)
+			if err != nil {
+				return err
+			}
+			si.Plan = plan.Entity.Name
+			service, err := v2.cached(plan.Entity.ServiceURL)
+			if err != nil {
+				return err
+			}
+			si.Offering = service.Entity.Label
+		}
+
+		err = v2.client.List(instance.Entity.ServiceBindingsURL, func(binding *Resource) error {
+			si.AppGuids = append(si.AppGuids, binding.Entity.AppGuid)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = f(si)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cached returns the resource at u, fetching it if it hasn't been seen before
+func (v2 *v2Foundation) cached(u string) (*Resource, error) {
+	v2.cacheMu.Lock()
+	r, found := v2.cache[u]
+	v2.cacheMu.Unlock()
+	if found {
+		return r, nil
+	}
+
+	r = &Resource{}
+	err := v2.client.Get(u, r)
+	if err != nil {
+		return nil, err
+	}
+
+	v2.cacheMu.Lock()
+	if v2.cache == nil {
+		v2.cache = make(map[string]*Resource)
+	}
+	v2.cache[u] = r
+	v2.cacheMu.Unlock()
+	return r, nil
+}
+
+// uniqueContacts sorts usernames and removes duplicates and blanks, which
+// are users such as UAA clients that don't have a username
+func uniqueContacts(usernames []string) []string {
+	sort.Strings(usernames)
+	var rv []string
+	for i, u := range usernames {
+		if u != "" && (i == 0 || u != usernames[i-1]) {
+			rv = append(rv, u)
+		}
+	}
+	return rv
+}
+
+func (v2 *v2Foundation) PrefetchDroplets(apps []*Resource) error {
+	return v2.droplets.prefetch(v2.client, apps)
+}
+
+func (v2 *v2Foundation) Droplet(app *Resource) (*Droplet, error) {
+	return v2.droplets.get(v2.client, app.Metadata.Guid)
+}
+
+func (v2 *v2Foundation) Restage(appGuid string) error {
+	return v2.client.Do(http.MethodPost, fmt.Sprintf("/v2/apps/%s/restage", appGuid), nil, nil)
+}
+
+// Annotate updates the app with the v3 API, as v2 has no annotations
+func (v2 *v2Foundation) Annotate(appGuid string, annotations map[string]string) error {
+	return annotateApp(v2.client, appGuid, annotations)
+}
+
+// v3Resource captures fields that we care about when
+// retrieving data from the v3 API
+type v3Resource struct {
+	Guid      string    `json:"guid"`       // all
+	Name      string    `json:"name"`       // all
+	UpdatedAt time.Time `json:"updated_at"` // buildpack
+	Filename  string    `json:"filename"`   // buildpack
+	Enabled   bool      `json:"enabled"`    // buildpack
+	Locked    bool      `json:"locked"`     // buildpack
+	Position  int       `json:"position"`   // buildpack
+	Stack     string    `json:"stack"`      // buildpack
+	State     string    `json:"state"`      // app
+	Lifecycle struct {
+		Type string `json:"type"`
+		Data struct {
+			Buildpacks []string `json:"buildpacks"`
+			Stack      string   `json:"stack"`
+		} `json:"data"`
+	} `json:"lifecycle"` // app
+
+	Username string `json:"username"` // user
+	URL      string `json:"url"`      // route
+
+	LastOperation *lastOperation `json:"last_operation"` // service instance
+
+	Apps struct {
+		TotalMemoryInMB *int64 `json:"total_memory_in_mb"`
+		TotalInstances  *int64 `json:"total_instances"`
+	} `json:"apps"` // quota
+
+	HealthCheck struct {
+		Type string `json:"type"`
+	} `json:"health_check"` // process
+
+	Metadata AppMetadata `json:"metadata"` // app
+
+	Type          string `json:"type"`         // process, role, service instance
+	Instances     int64  `json:"instances"`    // process
+	MemoryInMB    int64  `json:"memory_in_mb"` // process
+	Relationships struct {
+		App struct {
+			Data struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"app"` // process
+		User struct {
+			Data struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"user"` // role
+		ServiceInstance struct {
+			Data struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"service_instance"` // service credential binding
+		ServicePlan struct {
+			Data struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"service_plan"` // service instance
+		ServiceOffering struct {
+			Data struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"service_offering"` // service plan
+		Space struct {
+			Data struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"space"` // app
+		CurrentDroplet struct {
+			Data *struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"current_droplet"` // app
+		Organization struct {
+			Data struct {
+				Guid string `json:"guid"`
+			} `json:"data"`
+		} `json:"organization"` // space
+	} `json:"relationships"` // app, space, process, role, service credential binding, service instance, service plan
+}
+
+// v3Foundation lists resources with the v3 API
+type v3Foundation struct {
+	client CloudControllerClient
+
+	// current droplets listed in bulk by PrefetchDroplets
+	droplets dropletCache
+
+	// usernames by guid, as users are often contacts for many spaces
+	usersMu sync.Mutex
+	users   map[string]string
+
+	// service plans and offerings by path, as they are shared by many
+	// service instances
+	cacheMu sync.Mutex
+	cache   map[string]*v3Resource
+}
+
+// list calls f with each v3 resource found at r
+func (v3 *v3Foundation) list(r string, f func(*v3Resource) error) error {
+	return v3.client.ListV3(r, func(raw json.RawMessage) error {
+		var vr v3Resource
+		err := json.Unmarshal(raw, &vr)
+		if err != nil {
+			return err
+		}
+		return f(&vr)
+	})
+}
+
+func (v3 *v3Foundation) Buildpacks(f func(*Resource) error) error {
+	return v3.list("/v3/buildpacks", func(vr *v3Resource) error {
+		rv := &Resource{}
+		rv.Metadata.Guid = vr.Guid
+		rv.Metadata.UpdatedAt = vr.UpdatedAt
+		rv.Entity.Name = vr.Name
+		rv.Entity.Filename = vr.Filename
+		rv.Entity.Enabled = vr.Enabled
+		rv.Entity.Locked = vr.Locked
+		rv.Entity.Position = vr.Position
+		rv.Entity.Stack = vr.Stack
+		return f(rv)
+	})
+}
+
+func (v3 *v3Foundation) Orgs(f func(*Resource) error) error {
+	return v3.list("/v3/organizations", func(vr *v3Resource) error {
+		rv := &Resource{}
+		rv.Metadata.Guid = vr.Guid
+		rv.Entity.Name = vr.Name
+		return f(rv)
+	})
+}
+
+func (v3 *v3Foundation) Spaces(org *Resource, f func(*Resource) error) error {
+	return v3.list("/v3/spaces?organization_guids="+url.QueryEscape(org.Metadata.Guid), func(vr *v3Resource) error {
+		rv := &Resource{}
+		rv.Metadata.Guid = vr.Guid
+		rv.Entity.Name = vr.Name
+		return f(rv)
+	})
+}
+
+func (v3 *v3Foundation) Org(guid string) (*Resource, error) {
+	var vr v3Resource
+	err := v3.client.Get("/v3/organizations/"+url.PathEscape(guid), &vr)
+	if err != nil {
+		return nil, err
+	}
+	rv := &Resource{}
+	rv.Metadata.Guid = vr.Guid
+	rv.Entity.Name = vr.Name
+	return rv, nil
+}
+
+func (v3 *v3Foundation) Space(org *Resource, guid string) (*Resource, error) {
+	var vr v3Resource
+	err := v3.client.Get("/v3/spaces/"+url.PathEscape(guid), &vr)
+	if err != nil {
+		return nil, err
+	}
+	rv := &Resource{}
+	rv.Metadata.Guid = vr.Guid
+	rv.Entity.Name = vr.Name
+	return rv, nil
+}
+
+// Apps lists the apps in space. Memory and instances in v3 belong to processes
+// rather than apps, so these are filled in from the processes of each app.
+func (v3 *v3Foundation) Apps(space *Resource, f func(*Resource) error) error {
+	processes, err := spaceProcesses(v3.client, space)
+	if err != nil {
+		return err
+	}
+
+	return v3.list("/v3/apps?space_guids="+url.QueryEscape(space.Metadata.Guid), func(vr *v3Resource) error {
+		return f(v3App(vr, processes[vr.Guid]))
+	})
+}
+
+// AllApps lists every app with its space and org included, rather than
+// listing the orgs, then the spaces of each, then the apps of each space.
+// The processes of all apps are listed at once too.
+func (v3 *v3Foundation) AllApps(f func(org, space, app *Resource) error) error {
+	processes, err := allProcesses(v3.client)
+	if err != nil {
+		return err
+	}
+
+	orgs := make(map[string]*Resource)
+	spaces := make(map[string]spaceInOrg)
+	r := withPageSize(v3.client, "/v3/apps?include=space.organization")
+	for r != "" {
+		var page struct {
+			Pagination struct {
+				Next *struct {
+					Href string `json:"href"`
+				} `json:"next"`
+			} `json:"pagination"`
+			Resources []*v3Resource `json:"resources"`
+			Included  struct {
+				Spaces        []*v3Resource `json:"spaces"`
+				Organizations []*v3Resource `json:"organizations"`
+			} `json:"included"`
+		}
+		err := v3.client.Get(r, &page)
+		if err != nil {
+			return err
+		}
+
+		// orgs first, as spaces refer to them
+		for _, vr := range page.Included.Organizations {
+			if _, found := orgs[vr.Guid]; !found {
+				org := &Resource{}
+				org.Metadata.Guid = vr.Guid
+				org.Entity.Name = vr.Name
+				orgs[vr.Guid] = org
+			}
+		}
+		for _, vr := range page.Included.Spaces {
+			if _, found := spaces[vr.Guid]; !found {
+				space := &Resource{}
+				space.Metadata.Guid = vr.Guid
+				space.Entity.Name = vr.Name
+				spaces[vr.Guid] = spaceInOrg{org: orgs[vr.Relationships.Organization.Data.Guid], space: space}
+			}
+		}
+		for _, vr := range page.Resources {
+			s := spaces[vr.Relationships.Space.Data.Guid]
+			if s.org == nil || s.space == nil {
+				return fmt.Errorf("the space and org of app %s were not included", vr.Name)
+			}
+			err = f(s.org, s.space, v3App(vr, processes[vr.Guid]))
+			if err != nil {
+				return err
+			}
+		}
+
+		r = ""
+		if page.Pagination.Next != nil {
+			r = page.Pagination.Next.Href
+		}
+	}
+	return nil
+}
+
+// v3App converts vr to the v2 shape, filling in memory and instances from
+// the app's processes
+func v3App(vr *v3Resource, processes []*v3Resource) *Resource {
+	rv := &Resource{}
+	rv.Metadata.Guid = vr.Guid
+	rv.Entity.Name = vr.Name
+	rv.Entity.Buildpack = strings.Join(vr.Lifecycle.Data.Buildpacks, ", ")
+	rv.Entity.Stack = vr.Lifecycle.Data.Stack
+	rv.Entity.State = vr.State
+	rv.Entity.Lifecycle = vr.Lifecycle.Type
+	for _, p := range processes {
+		if p.Type == "web" {
+			rv.Entity.Memory = p.MemoryInMB
+			rv.Entity.Instances = p.Instances
+		}
+	}
+	rv.Entity.ProcessMemory = processMemory(processes)
+	rv.Entity.ProcessInstances = processInstances(processes)
+	rv.Entity.AppMetadata = &vr.Metadata
+	if vr.Relationships.CurrentDroplet.Data != nil {
+		rv.Entity.DropletGuid = vr.Relationships.CurrentDroplet.Data.Guid
+	}
+	return rv
+}
+
+// spaceProcesses lists the processes of all apps in space, by app guid
+func spaceProcesses(client CloudControllerClient, space *Resource) (map[string][]*v3Resource, error) {
+	return listProcesses(client, "/v3/processes?space_guids="+url.QueryEscape(space.Metadata.Guid))
+}
+
+// allProcesses lists the processes of every app, by app guid
+func allProcesses(client CloudControllerClient) (map[string][]*v3Resource, error) {
+	return listProcesses(client, "/v3/processes")
+}
+
+// listProcesses lists the processes at r, by app guid
+func listProcesses(client CloudControllerClient, r string) (map[string][]*v3Resource, error) {
+	rv := make(map[string][]*v3Resource)
+	err := client.ListV3(r, func(raw json.RawMessage) error {
+		var vr v3Resource
+		err := json.Unmarshal(raw, &vr)
+		if err != nil {
+			return err
+		}
+		rv[vr.Relationships.App.Data.Guid] = append(rv[vr.Relationships.App.Data.Guid], &vr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// listRevisions fetches the most recent revisions of the app with appGuid,
+// and the droplet of each to see which buildpacks it was staged with
+func listRevisions(client CloudControllerClient, appGuid string) ([]*Revision, error) {
+	var revisions struct {
+		Resources []struct {
+			Revision
+			Droplet struct {
+				Guid string `json:"guid"`
+			} `json:"droplet"`
+		} `json:"resources"`
+	}
+	err := client.Get(fmt.Sprintf("/v3/apps/%s/revisions?order_by=-created_at&per_page=%d", url.PathEscape(appGuid), maxRevisions), &revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	// consecutive revisions often share a droplet, eg after changing env
+	droplets := make(map[string]*Droplet)
+	var rv []*Revision
+	for _, r := range revisions.Resources {
+		rev := r.Revision
+		d, found := droplets[r.Droplet.Guid]
+		if !found && r.Droplet.Guid != "" {
+			d = &Droplet{}
+			err = client.Get("/v3/droplets/"+url.PathEscape(r.Droplet.Guid), d)
+			if isNotFound(err) {
+				// expired droplets are deleted
+				d, err = nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			droplets[r.Droplet.Guid] = d
+		}
+		if d != nil {
+			for _, bp := range d.Buildpacks {
+				name := bp.BuildpackName
+				if name == "" {
+					name = bp.Name
+				}
+				if bp.Version != "" {
+					name += " v" + bp.Version
+				}
+				rev.Buildpacks = append(rev.Buildpacks, name)
+			}
+		}
+		rv = append(rv, &rev)
+	}
+	return rv, nil
+}
+
+// lastAppEvent fetches the most recent of the appEvents for the app with
+// appGuid
+func lastAppEvent(client CloudControllerClient, appGuid string) (*AppEvent, error) {
+	var types []string
+	for t := range appEvents {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	var events struct {
+		Resources []struct {
+			Type  string `json:"type"`
+			Actor struct {
+				Name string `json:"name"`
+				Guid string `json:"guid"`
+			} `json:"actor"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"resources"`
+	}
+	err := client.Get("/v3/audit_events?order_by=-created_at&per_page=1&types="+strings.Join(types, ",")+"&target_guids="+url.QueryEscape(appGuid), &events)
+	if err != nil {
+		return nil, err
+	}
+	if len(events.Resources) == 0 {
+		return nil, nil
+	}
+	e := events.Resources[0]
+	rv := &AppEvent{Action: appEvents[e.Type], Actor: e.Actor.Name, CreatedAt: e.CreatedAt}
+	if rv.Actor == "" {
+		rv.Actor = e.Actor.Guid
+	}
+	return rv, nil
+}
+
+// appMetadata fetches the labels and annotations of the app with appGuid
+func appMetadata(client CloudControllerClient, appGuid string) (*AppMetadata, error) {
+	var app v3Resource
+	err := client.Get("/v3/apps/"+url.PathEscape(appGuid), &app)
+	if err != nil {
+		return nil, err
+	}
+	return &app.Metadata, nil
+}
+
+// appHealth fetches the processes of the app with appGuid, and the stats of
+// those with instances, to count how many are running and crashed
+func appHealth(client CloudControllerClient, appGuid string) (*AppHealth, error) {
+	var processes []*v3Resource
+	err := client.ListV3("/v3/apps/"+url.PathEscape(appGuid)+"/processes", func(raw json.RawMessage) error {
+		var vr v3Resource
+		err := json.Unmarshal(raw, &vr)
+		if err != nil {
+			return err
+		}
+		processes = append(processes, &vr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &AppHealth{}
+	for _, p := range processes {
+		if p.Type == "web" {
+			rv.HealthCheckType = p.HealthCheck.Type
+		}
+		if p.Instances == 0 {
+			continue
+		}
+		var stats struct {
+			Resources []struct {
+				State string `json:"state"`
+			} `json:"resources"`
+		}
+		err = client.Get("/v3/processes/"+url.PathEscape(p.Guid)+"/stats", &stats)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stats.Resources {
+			switch s.State {
+			case "RUNNING":
+				rv.Running++
+			case "CRASHED":
+				rv.Crashed++
+			}
+		}
+	}
+	return rv, nil
+}
+
+// listTasks fetches the most recent tasks of the app with appGuid
+func listTasks(client CloudControllerClient, appGuid string) ([]*Task, error) {
+	var tasks struct {
+		Resources []*Task `json:"resources"`
+	}
+	err := client.Get(fmt.Sprintf("/v3/apps/%s/tasks?order_by=-created_at&per_page=%d", url.PathEscape(appGuid), maxTasks), &tasks)
+	if err != nil {
+		return nil, err
+	}
+	return tasks.Resources, nil
+}
+
+// appSidecars lists the sidecars of the app with appGuid, and if any reserve
+// memory, its processes, to total the memory reserved across their instances
+func appSidecars(client CloudControllerClient, appGuid string) ([]*Sidecar, error) {
+	var sidecars []*Sidecar
+	err := client.ListV3("/v3/apps/"+url.PathEscape(appGuid)+"/sidecars", func(raw json.RawMessage) error {
+		var s struct {
+			Name         string   `json:"name"`
+			ProcessTypes []string `json:"process_types"`
+			MemoryInMB   *int64   `json:"memory_in_mb"`
+		}
+		err := json.Unmarshal(raw, &s)
+		if err != nil {
+			return err
+		}
+		sidecar := &Sidecar{Name: s.Name, ProcessTypes: s.ProcessTypes}
+		if s.MemoryInMB != nil {
+			sidecar.MemoryInMB = *s.MemoryInMB
+		}
+		sidecars = append(sidecars, sidecar)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := false
+	for _, s := range sidecars {
+		reserved = reserved || s.MemoryInMB != 0
+	}
+	if !reserved {
+		return sidecars, nil
+	}
+
+	instances := make(map[string]int64)
+	err = client.ListV3("/v3/apps/"+url.PathEscape(appGuid)+"/processes", func(raw json.RawMessage) error {
+		var vr v3Resource
+		err := json.Unmarshal(raw, &vr)
+		if err != nil {
+			return err
+		}
+		instances[vr.Type] = vr.Instances
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sidecars {
+		for _, t := range s.ProcessTypes {
+			s.TotalMemory += s.MemoryInMB * instances[t]
+		}
+	}
+	return sidecars, nil
+}
+
+// inFlight describes the active deployment or staging build of the app with
+// appGuid, or returns "" if it has neither
+func inFlight(client CloudControllerClient, appGuid string) (string, error) {
+	var deployments struct {
+		Resources []struct {
+			Strategy string `json:"strategy"`
+			Status   struct {
+				Reason string `json:"reason"`
+			} `json:"status"`
+		} `json:"resources"`
+	}
+	err := client.Get("/v3/deployments?status_values=ACTIVE&app_guids="+url.QueryEscape(appGuid), &deployments)
+	if err != nil {
+		return "", err
+	}
+	if len(deployments.Resources) != 0 {
+		d := deployments.Resources[0]
+		strategy := d.Strategy
+		if strategy == "" {
+			strategy = "rolling"
+		}
+		return fmt.Sprintf("a %s deployment is %s", strategy, d.Status.Reason), nil
+	}
+
+	var builds struct {
+		Resources []struct{} `json:"resources"`
+	}
+	err = client.Get("/v3/builds?states=STAGING&app_guids="+url.QueryEscape(appGuid), &builds)
+	if err != nil {
+		return "", err
+	}
+	if len(builds.Resources) != 0 {
+		return "a build is STAGING", nil
+	}
+	return "", nil
+}
+
+// v3Relationship is a to-one relationship, whose data is null if there is
+// no related resource
+type v3Relationship struct {
+	Data *struct {
+		Guid string `json:"guid"`
+	} `json:"data"`
+}
+
+// orgIsolationSegments lists the isolation segments org is entitled to, and
+// looks up its default
+func orgIsolationSegments(client CloudControllerClient, org *Resource) (*OrgIsolationSegments, error) {
+	rv := &OrgIsolationSegments{}
+	names := make(map[string]string)
+	err := client.ListV3("/v3/isolation_segments?organization_guids="+url.QueryEscape(org.Metadata.Guid), func(raw json.RawMessage) error {
+		var vr v3Resource
+		err := json.Unmarshal(raw, &vr)
+		if err != nil {
+			return err
+		}
+		names[vr.Guid] = vr.Name
+		rv.Entitled = append(rv.Entitled, vr.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rv.Entitled)
+
+	var def v3Relationship
+	err = client.Get("/v3/organizations/"+url.PathEscape(org.Metadata.Guid)+"/relationships/default_isolation_segment", &def)
+	if err != nil {
+		return nil, err
+	}
+	if def.Data != nil {
+		name, found := names[def.Data.Guid]
+		if !found {
+			name, err = isolationSegmentName(client, def.Data.Guid)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rv.Default = name
+	}
+	return rv, nil
+}
+
+// spaceIsolationSegment looks up the isolation segment space is assigned to
+func spaceIsolationSegment(client CloudControllerClient, space *Resource) (string, error) {
+	var rel v3Relationship
+	err := client.Get("/v3/spaces/"+url.PathEscape(space.Metadata.Guid)+"/relationships/isolation_segment", &rel)
+	if err != nil || rel.Data == nil {
+		return "", err
+	}
+	return isolationSegmentName(client, rel.Data.Guid)
+}
+
+// isolationSegmentName fetches the name of the isolation segment with guid,
+// or returns guid if the user can't see it
+func isolationSegmentName(client CloudControllerClient, guid string) (string, error) {
+	var vr v3Resource
+	err := client.Get("/v3/isolation_segments/"+url.PathEscape(guid), &vr)
+	if isNotFound(err) || isPermissionDenied(err) {
+		return guid, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return vr.Name, nil
+}
+
+// processMemory returns the memory reserved by all instances of each type of process
+func processMemory(processes []*v3Resource) map[string]int64 {
+	if len(processes) == 0 {
+		return nil
+	}
+	rv := make(map[string]int64)
+	for _, p := range processes {
+		rv[p.Type] += p.MemoryInMB * p.Instances
+	}
+	return rv
+}
+
+// processInstances returns the instances of all processes
+func processInstances(processes []*v3Resource) int64 {
+	var rv int64
+	for _, p := range processes {
+		rv += p.Instances
+	}
+	return rv
+}
+
+// Contacts lists the developer and manager roles in space, and looks up the
+// username of each user with one
+func (v3 *v3Foundation) Contacts(space *Resource) ([]string, error) {
+	var guids []string
+	err := v3.list("/v3/roles?types=space_developer,space_manager&space_guids="+url.QueryEscape(space.Metadata.Guid), func(vr *v3Resource) error {
+		guids = append(guids, vr.Relationships.User.Data.Guid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	for _, guid := range guids {
+		username, err := v3.username(guid)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, username)
+	}
+	return uniqueContacts(rv), nil
+}
+
+// username returns the username of the user with guid, fetching it if it
+// hasn't been seen before
+func (v3 *v3Foundation) username(guid string) (string, error) {
+	v3.usersMu.Lock()
+	username, found := v3.users[guid]
+	v3.usersMu.Unlock()
+	if found {
+		return username, nil
+	}
+
+	var user v3Resource
+	err := v3.client.Get("/v3/users/"+url.PathEscape(guid), &user)
+	if err != nil {
+		return "", err
+	}
+
+	v3.usersMu.Lock()
+	if v3.users == nil {
+		v3.users = make(map[string]string)
+	}
+	v3.users[guid] = user.Username
+	v3.usersMu.Unlock()
+	return user.Username, nil
+}
+
+// Routes lists the routes mapped to app
+func (v3 *v3Foundation) Routes(app *Resource) ([]string, error) {
+	var rv []string
+	err := v3.list("/v3/apps/"+url.PathEscape(app.Metadata.Guid)+"/routes", func(vr *v3Resource) error {
+		rv = append(rv, vr.URL)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+// Services lists the app's service credential bindings, and looks up the
+// name of the service instance of each
+func (v3 *v3Foundation) Services(app *Resource) ([]string, error) {
+	var guids []string
+	err := v3.list("/v3/service_credential_bindings?type=app&app_guids="+url.QueryEscape(app.Metadata.Guid), func(vr *v3Resource) error {
+		guids = append(guids, vr.Relationships.ServiceInstance.Data.Guid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	for _, guid := range guids {
+		var instance v3Resource
+		err = v3.client.Get("/v3/service_instances/"+url.PathEscape(guid), &instance)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, instance.Name)
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+func (v3 *v3Foundation) OrgRoles(org *Resource) ([]*Role, error) {
+	return v3.roles("/v3/roles?types=organization_user,organization_manager,organization_billing_manager,organization_auditor&organization_guids=" + url.QueryEscape(org.Metadata.Guid))
+}
+
+func (v3 *v3Foundation) SpaceRoles(space *Resource) ([]*Role, error) {
+	return v3.roles("/v3/roles?space_guids=" + url.QueryEscape(space.Metadata.Guid))
+}
+
+// roles lists the roles at r, and looks up the username of each user with one
+func (v3 *v3Foundation) roles(r string) ([]*Role, error) {
+	var roles []*v3Resource
+	err := v3.list(r, func(vr *v3Resource) error {
+		roles = append(roles, vr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []*Role
+	for _, vr := range roles {
+		guid := vr.Relationships.User.Data.Guid
+		username, err := v3.username(guid)
+		if err != nil {
+			return nil, err
+		}
+		if username == "" {
+			username = guid
+		}
+		rv = append(rv, &Role{Type: vr.Type, Username: username})
+	}
+	return rv, nil
+}
+
+func (v3 *v3Foundation) OrgIsolationSegments(org *Resource) (*OrgIsolationSegments, error) {
+	return orgIsolationSegments(v3.client, org)
+}
+
+func (v3 *v3Foundation) SpaceIsolationSegment(space *Resource) (string, error) {
+	return spaceIsolationSegment(v3.client, space)
+}
+
+func (v3 *v3Foundation) OrgQuota(org *Resource) (*Quota, error) {
+	return v3.quota("/v3/organization_quotas?organization_guids=" + url.QueryEscape(org.Metadata.Guid))
+}
+
+func (v3 *v3Foundation) SpaceQuota(space *Resource) (*Quota, error) {
+	return v3.quota("/v3/space_quotas?space_guids=" + url.QueryEscape(space.Metadata.Guid))
+}
+
+// quota returns the quota listed at r, or nil if there is none
+func (v3 *v3Foundation) quota(r string) (*Quota, error) {
+	var rv *Quota
+	err := v3.list(r, func(vr *v3Resource) error {
+		rv = &Quota{Name: vr.Name, MemoryLimit: vr.Apps.TotalMemoryInMB, InstanceLimit: vr.Apps.TotalInstances}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+func (v3 *v3Foundation) Revisions(app *Resource) ([]*Revision, error) {
+	return listRevisions(v3.client, app.Metadata.Guid)
+}
+
+func (v3 *v3Foundation) Health(app *Resource) (*AppHealth, error) {
+	return appHealth(v3.client, app.Metadata.Guid)
+}
+
+func (v3 *v3Foundation) Tasks(app *Resource) ([]*Task, error) {
+	return listTasks(v3.client, app.Metadata.Guid)
+}
+
+func (v3 *v3Foundation) Sidecars(app *Resource) ([]*Sidecar, error) {
+	return appSidecars(v3.client, app.Metadata.Guid)
+}
+
+func (v3 *v3Foundation) LastEvent(app *Resource) (*AppEvent, error) {
+	return lastAppEvent(v3.client, app.Metadata.Guid)
+}
+
+// AppMetadata returns the metadata the app was listed with, or else fetches
+// it
+func (v3 *v3Foundation) AppMetadata(app *Resource) (*AppMetadata, error) {
+	if app.Entity.AppMetadata != nil {
+		return app.Entity.AppMetadata, nil
+	}
+	return appMetadata(v3.client, app.Metadata.Guid)
+}
+
+func (v3 *v3Foundation) InFlight(app *Resource) (string, error) {
+	return inFlight(v3.client, app.Metadata.Guid)
+}
+
+// DockerPackage fetches the most recent docker package of app
+func (v3 *v3Foundation) DockerPackage(app *Resource) (*DockerPackage, error) {
+	var packages struct {
+		Resources []struct {
+			Data DockerPackage `json:"data"`
+		} `json:"resources"`
+	}
+	err := v3.client.Get("/v3/packages?types=docker&order_by=-created_at&per_page=1&app_guids="+url.QueryEscape(app.Metadata.Guid), &packages)
+	if err != nil {
+		return nil, err
+	}
+	if len(packages.Resources) == 0 {
+		return &DockerPackage{}, nil
+	}
+	return &packages.Resources[0].Data, nil
+}
+
+func (v3 *v3Foundation) ServiceInstances(space *Resource, f func(*ServiceInstance) error) error {
+	var instances []*v3Resource
+	err := v3.list("/v3/service_instances?space_guids="+url.QueryEscape(space.Metadata.Guid), func(vr *v3Resource) error {
+		instances = append(instances, vr)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		si := &ServiceInstance{Guid: instance.Guid, Name: instance.Name, Type: instance.Type}
+		instance.LastOperation.set(si)
+
+		if guid := instance.Relationships.ServicePlan.Data.Guid; guid != "" {
+			plan, err := v3.cached("/v3/service_plans/" + url.PathEscape(guid))
+			if err != nil {
+				return err
+			}
+			si.Plan = plan.Name
+			offering, err := v3.cached("/v3/service_offerings/" + url.PathEscape(plan.Relationships.ServiceOffering.Data.Guid))
+			if err != nil {
+				return err
+			}
+			si.Offering = offering.Name
+		}
+
+		err = v3.list("/v3/service_credential_bindings?type=app&service_instance_guids="+url.QueryEscape(instance.Guid), func(vr *v3Resource) error {
+			si.AppGuids = append(si.AppGuids, vr.Relationships.App.Data.Guid)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = f(si)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cached returns the resource at r, fetching it if it hasn't been seen before
+func (v3 *v3Foundation) cached(r string) (*v3Resource, error) {
+	v3.cacheMu.Lock()
+	vr, found := v3.cache[r]
+	v3.cacheMu.Unlock()
+	if found {
+		return vr, nil
+	}
+
+	vr = &v3Resource{}
+	err := v3.client.Get(r, vr)
+	if err != nil {
+		return nil, err
+	}
+
+	v3.cacheMu.Lock()
+	if v3.cache == nil {
+		v3.cache = make(map[string]*v3Resource)
+	}
+	v3.cache[r] = vr
+	v3.cacheMu.Unlock()
+	return vr, nil
+}
+
+func (v3 *v3Foundation) PrefetchDroplets(apps []*Resource) error {
+	return v3.droplets.prefetch(v3.client, apps)
+}
+
+func (v3 *v3Foundation) Droplet(app *Resource) (*Droplet, error) {
+	return v3.droplets.get(v3.client, app.Metadata.Guid)
+}
+
+func (v3 *v3Foundation) Annotate(appGuid string, annotations map[string]string) error {
+	return annotateApp(v3.client, appGuid, annotations)
+}
+
+// annotateApp sets annotations on the app with appGuid, leaving its other
+// metadata as it is
+func annotateApp(client CloudControllerClient, appGuid string, annotations map[string]string) error {
+	// empty values are sent as null, which removes the annotation
+	values := make(map[string]*string)
+	for k, v := range annotations {
+		if v != "" {
+			v := v
+			values[k] = &v
+		} else {
+			values[k] = nil
+		}
+	}
+	return client.Do(http.MethodPatch, "/v3/apps/"+url.PathEscape(appGuid), map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": values},
+	}, nil)
+}
+
+// v3BuildPollInterval is how often Restage checks whether a v3 build has finished staging
+var v3BuildPollInterval = 5 * time.Second
+
+// Restage stages the most recent package of the app, waits for staging to
+// finish, then makes the new droplet current and restarts the app
+func (v3 *v3Foundation) Restage(appGuid string) error {
+	var packages struct {
+		Resources []struct {
+			Guid string `json:"guid"`
+		} `json:"resources"`
+	}
+	err := v3.client.Get("/v3/packages?states=READY&order_by=-created_at&per_page=1&app_guids="+url.QueryEscape(appGuid), &packages)
+	if err != nil {
+		return err
+	}
+	if len(packages.Resources) == 0 {
+		return errors.New("app has no package to stage")
+	}
+
+	var build struct {
+		Guid    string `json:"guid"`
+		State   string `json:"state"`
+		Error   string `json:"error"`
+		Droplet *struct {
+			Guid string `json:"guid"`
+		} `json:"droplet"`
+	}
+	err = v3.client.Do(http.MethodPost, "/v3/builds", map[string]interface{}{
+		"package": map[string]string{"guid": packages.Resources[0].Guid},
+	}, &build)
+	if err != nil {
+		return err
+	}
+	for build.State == "STAGING" {
+		time.Sleep(v3BuildPollInterval)
+		err = v3.client.Get("/v3/builds/"+build.Guid, &build)
+		if err != nil {
+			return err
+		}
+	}
+	if build.State != "STAGED" || build.Droplet == nil {
+		return fmt.Errorf("staging failed: %s", build.Error)
+	}
+
+	err = v3.client.Do(http.MethodPatch, fmt.Sprintf("/v3/apps/%s/relationships/current_droplet", appGuid), map[string]interface{}{
+		"data": map[string]string{"guid": build.Droplet.Guid},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	return v3.client.Do(http.MethodPost, fmt.Sprintf("/v3/apps/%s/actions/restart", appGuid), nil, nil)
+}
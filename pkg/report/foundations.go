@@ -0,0 +1,133 @@
+package report
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// foundationConfig is a foundation to report on, and the credentials to log
+// in to it with. Credentials given as "$NAME" are read from the environment
+// variable NAME, so they needn't be kept in the config file.
+type foundationConfig struct {
+	// Name - shown in the Foundation column
+	Name string `json:"name"`
+
+	// API - the API URL, eg https://api.system.example.com
+	API string `json:"api"`
+
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	RefreshToken      string `json:"refresh_token"`
+	ClientID          string `json:"client_id"`
+	ClientSecret      string `json:"client_secret"`
+	SkipSSLValidation bool   `json:"skip_ssl_validation"`
+}
+
+// loadFoundations reads the foundations to report on from a JSON file, eg
+//
+//	{"foundations": [{"name": "prod", "api": "https://api.sys.example.com",
+//	  "client_id": "reporter", "client_secret": "$PROD_SECRET"}]}
+func loadFoundations(path string) ([]*foundationConfig, error) {
+	var config struct {
+		Foundations []*foundationConfig `json:"foundations"`
+	}
+	err := readJSONFile(path, &config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Foundations) == 0 {
+		return nil, fmt.Errorf("no foundations in %s", path)
+	}
+
+	names := make(map[string]bool)
+	for _, fc := range config.Foundations {
+		if fc.Name == "" || fc.API == "" {
+			return nil, fmt.Errorf("every foundation in %s must have a name and api", path)
+		}
+		if names[fc.Name] {
+			return nil, fmt.Errorf("foundation %s is in %s more than once", fc.Name, path)
+		}
+		names[fc.Name] = true
+
+		for _, v := range []*string{&fc.Username, &fc.Password, &fc.RefreshToken, &fc.ClientID, &fc.ClientSecret} {
+			if strings.HasPrefix(*v, "$") {
+				*v = os.Getenv((*v)[1:])
+			}
+		}
+	}
+	return config.Foundations, nil
+}
+
+// connection returns a connection that logs in to the foundation
+func (fc *foundationConfig) connection() *standaloneConnection {
+	api := strings.TrimSuffix(fc.API, "/")
+	if api != "" && !strings.HasPrefix(api, "https://") && !strings.HasPrefix(api, "http://") {
+		api = "https://" + api
+	}
+	clientID := fc.ClientID
+	if fc.ClientSecret == "" && clientID == "" {
+		// the client the cf CLI logs in with
+		clientID = "cf"
+	}
+	return &standaloneConnection{
+		api:          api,
+		skipSSL:      fc.SkipSSLValidation,
+		clientID:     clientID,
+		secret:       fc.ClientSecret,
+		username:     fc.Username,
+		password:     fc.Password,
+		refreshToken: fc.RefreshToken,
+		Client:       http.DefaultClient,
+	}
+}
+
+// hasFoundation returns true if the rows were collected by -foundations, so a
+// Foundation column is needed
+func hasFoundation(allInfo []*AppBuildpackInfo) bool {
+	for _, info := range allInfo {
+		if info.Foundation != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// collectFoundations collects usage information from each foundation in
+// turn, connecting to each with connect, and returns the combined rows. emit
+// is as for collectUsageInfo.
+func collectFoundations(foundations []*foundationConfig, connect func(Connection) (*simpleClient, Client, error), opts *Options, emit func(*AppBuildpackInfo) error) ([]*AppBuildpackInfo, error) {
+	var allInfo []*AppBuildpackInfo
+	for _, fc := range foundations {
+		client, fd, err := connect(fc.connection())
+		if err != nil {
+			return nil, fmt.Errorf("foundation %s: %s", fc.Name, err)
+		}
+		name := fc.Name
+		if opts.Anonymize {
+			name = anonymousName("foundation", fc.Name)
+		}
+
+		var femit func(*AppBuildpackInfo) error
+		if emit != nil {
+			femit = func(info *AppBuildpackInfo) error {
+				info.Foundation = name
+				return emit(info)
+			}
+		}
+		fInfo, err := collectUsageInfo(client, fd, opts, femit)
+		client.logInaccessible()
+		for _, info := range fInfo {
+			info.Foundation = name
+		}
+		allInfo = append(allInfo, fInfo...)
+		if err == ErrInterrupted {
+			return allInfo, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("foundation %s: %s", fc.Name, err)
+		}
+	}
+	return allInfo, nil
+}
@@ -0,0 +1,28 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadFoundations(t *testing.T) {
+	t.Setenv("TEST_PROD_SECRET", "s3cret")
+	path := writeFile(t, "foundations.json", `{
+  "foundations": [
+    {"name": "prod", "api": "https://api.sys.prod.example.com",
+     "client_id": "reporter", "client_secret": "$TEST_PROD_SECRET"}
+  ]
+}`)
+	foundations, err := loadFoundations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foundations) != 1 || foundations[0].Name != "prod" || foundations[0].ClientSecret != "s3cret" {
+		t.Errorf("got %+v, want prod with its secret read from the environment", foundations[0])
+	}
+
+	path = writeFile(t, "foundations.json", `{"foundations": [{"name": "prod", "api": "a"}, {"name": "prod", "api": "b"}]}`)
+	if _, err := loadFoundations(path); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("got %v, want the duplicate foundation rejected", err)
+	}
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// groupByKeys are the values accepted by -group-by
+var groupByKeys = []string{"org", "space", "buildpack"}
+
+// validateGroupBy returns an error if groupBy is set and not one of groupByKeys
+func validateGroupBy(groupBy string) error {
+	if groupBy == "" {
+		return nil
+	}
+	for _, k := range groupByKeys {
+		if k == groupBy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown -group-by %q, expected one of %s", groupBy, strings.Join(groupByKeys, ", "))
+}
+
+// usageGroup aggregates usage information for all apps in an org or space
+type usageGroup struct {
+	Foundation     string `json:"foundation,omitempty"`
+	Organization   string `json:"organization"`
+	Space          string `json:"space,omitempty"`
+	Apps           int    `json:"apps"`
+	TotalMemory    int64  `json:"total_memory"`
+	NeedsAttention int    `json:"needs_attention"`
+}
+
+// groupUsageInfo groups allInfo by org, or by space if groupBy is "space",
+// sorted by name
+func groupUsageInfo(allInfo []*AppBuildpackInfo, groupBy string) []*usageGroup {
+	byKey := make(map[appKey]*usageGroup)
+	for _, info := range allInfo {
+		k := appKey{foundation: info.Foundation, org: info.Organization}
+		if groupBy == "space" {
+			k.space = info.Space
+		}
+		g, found := byKey[k]
+		if !found {
+			g = &usageGroup{Foundation: k.foundation, Organization: k.org, Space: k.space}
+			byKey[k] = g
+		}
+		g.Apps++
+		g.TotalMemory += info.memory()
+		if info.needsAttention() {
+			g.NeedsAttention++
+		}
+	}
+
+	var rv []*usageGroup
+	for _, g := range byKey {
+		rv = append(rv, g)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		a, b := rv[i], rv[j]
+		if c := strings.Compare(a.Foundation, b.Foundation); c != 0 {
+			return c < 0
+		}
+		return compareNames(a.Organization, a.Space, "", b.Organization, b.Space, "") < 0
+	})
+	return rv
+}
+
+// renderGroups writes groups to out in the format selected by opts
+func renderGroups(out io.Writer, groups []*usageGroup, groupBy string, foundations bool, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, groups, opts)
+	}
+
+	var header []string
+	if foundations {
+		header = append(header, "Foundation")
+	}
+	header = append(header, "Organization")
+	if groupBy == "space" {
+		header = append(header, "Space")
+	}
+	header = append(header, "Apps", memoryHeader("Total Memory", opts.MemoryUnit), "Needs Attention")
+
+	var rows [][]string
+	for _, g := range groups {
+		var r []string
+		if foundations {
+			r = append(r, g.Foundation)
+		}
+		r = append(r, g.Organization)
+		if groupBy == "space" {
+			r = append(r, g.Space)
+		}
+		r = append(r, strconv.Itoa(g.Apps), formatMemory(g.TotalMemory, opts.MemoryUnit), strconv.Itoa(g.NeedsAttention))
+		rows = append(rows, r)
+	}
+	return renderRows(out, header, rows, opts)
+}
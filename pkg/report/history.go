@@ -0,0 +1,131 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// historyRun is a line appended to a -history-file file for each run
+type historyRun struct {
+	RunID     string              `json:"run_id"`
+	Timestamp time.Time           `json:"timestamp"`
+	API       string              `json:"api,omitempty"`
+	Rows      []*AppBuildpackInfo `json:"rows"`
+}
+
+// historyChange is a change to an app between two runs in a history file
+type historyChange struct {
+	Timestamp time.Time `json:"timestamp"`
+	RunID     string    `json:"run_id"`
+	*usageChange
+}
+
+// appendHistory appends the rows of the run with ID runID at runTime to the
+// history file at path, creating it if need be
+func appendHistory(path string, runID string, runTime time.Time, api string, allInfo []*AppBuildpackInfo) error {
+	if allInfo == nil {
+		allInfo = []*AppBuildpackInfo{}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(&historyRun{RunID: runID, Timestamp: runTime.UTC(), API: api, Rows: allInfo})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readHistory calls f with each run in the history file at path in turn, in
+// the order they were appended, ie oldest first, so that the whole history
+// needn't be held in memory
+func readHistory(path string, f func(*historyRun) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	for {
+		var run historyRun
+		err = dec.Decode(&run)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading history %s: %s", path, err)
+		}
+		err = f(&run)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// historyChanges returns the changes between each run in the history file
+// at path since the given time and the run before it against the same API,
+// oldest first. Only the previous run against each API is kept in memory.
+// If change is set only changes of that kind are returned.
+func historyChanges(path string, since time.Time, change string) ([]*historyChange, error) {
+	var rv []*historyChange
+	previous := make(map[string]*historyRun)
+	err := readHistory(path, func(run *historyRun) error {
+		prev := previous[run.API]
+		previous[run.API] = run
+		if prev == nil || run.Timestamp.Before(since) {
+			return nil
+		}
+		for _, c := range diffUsageInfo(prev.Rows, run.Rows) {
+			if change == "" || c.Change == change {
+				rv = append(rv, &historyChange{Timestamp: run.Timestamp, RunID: run.RunID, usageChange: c})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// reportHistory renders the changes recorded in the history file at path
+// since the given time to out
+func reportHistory(out io.Writer, path string, since time.Time, change string, opts *Options) error {
+	changes, err := historyChanges(path, since, change)
+	if err != nil {
+		return err
+	}
+
+	if opts.OutputJSON {
+		if changes == nil {
+			changes = []*historyChange{}
+		}
+		return renderJSON(out, changes, opts)
+	}
+
+	foundations := false
+	for _, c := range changes {
+		if c.Foundation != "" {
+			foundations = true
+		}
+	}
+	header := []string{"Time", "Organization", "Space", "Application", "Change", "Old", "New"}
+	if foundations {
+		header = append([]string{"Time", "Foundation"}, header[1:]...)
+	}
+	var rows [][]string
+	for _, c := range changes {
+		row := []string{c.Timestamp.Format(time.RFC3339), c.Organization, c.Space, c.Application, c.Change, c.Old, c.New}
+		if foundations {
+			row = append([]string{row[0], c.Foundation}, row[1:]...)
+		}
+		rows = append(rows, row)
+	}
+	return renderRows(out, header, rows, opts)
+}
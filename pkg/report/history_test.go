@@ -0,0 +1,60 @@
+package report
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// historyRow is an app staged with buildpacks
+func historyRow(app string, buildpacks ...string) *AppBuildpackInfo {
+	return &AppBuildpackInfo{Organization: "org1", Space: "space1", Application: app, Buildpacks: buildpacks}
+}
+
+func TestHistoryChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, run := range []struct {
+		api  string
+		rows []*AppBuildpackInfo
+	}{
+		{"https://api.a", []*AppBuildpackInfo{historyRow("app1", "java_buildpack v4.0")}},
+		{"https://api.b", []*AppBuildpackInfo{historyRow("app1", "go_buildpack v1.0")}},
+		{"https://api.a", []*AppBuildpackInfo{historyRow("app1", "java_buildpack v4.1")}},
+		{"https://api.b", []*AppBuildpackInfo{historyRow("app1", "go_buildpack v1.0"), historyRow("app2", "go_buildpack v1.0")}},
+		{"https://api.a", []*AppBuildpackInfo{historyRow("app1", "java_buildpack v4.2")}},
+	} {
+		err := appendHistory(path, string(rune('a'+i)), start.Add(time.Duration(i)*24*time.Hour), run.api, run.rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes, err := historyChanges(path, time.Time{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.RunID+" "+c.Application+" "+c.Change)
+	}
+	want := []string{"c app1 BUILDPACK_CHANGED", "d app2 ADDED", "e app1 BUILDPACK_CHANGED"}
+	if len(got) != len(want) {
+		t.Fatalf("got changes %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got changes %q, want %q", got, want)
+			break
+		}
+	}
+
+	// the run before since is still compared against
+	changes, err = historyChanges(path, start.Add(4*24*time.Hour), changeBuildpackChanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].RunID != "e" || changes[0].Old != "java_buildpack v4.1" {
+		t.Errorf("got %d changes since the last run, want e from java_buildpack v4.1", len(changes))
+	}
+}
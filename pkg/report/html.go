@@ -0,0 +1,129 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+// htmlChart is a bar chart shown above the table in HTML output
+type htmlChart struct {
+	Title string
+	Bars  []htmlBar
+}
+
+type htmlBar struct {
+	Label string
+	Value int64
+}
+
+// maxBarWidth is the width in pixels of the longest bar in a chart
+const maxBarWidth = 200
+
+// Width returns the width in pixels of b, relative to the longest bar in c
+func (c *htmlChart) Width(b htmlBar) float64 {
+	var max int64
+	for _, o := range c.Bars {
+		if o.Value > max {
+			max = o.Value
+		}
+	}
+	if max == 0 {
+		return 0
+	}
+	return float64(b.Value) * maxBarWidth / float64(max)
+}
+
+// renderHTML writes a standalone HTML page to out, with charts followed by a
+// table of header and rows that can be sorted and filtered in the browser. If
+// partial is set it is shown as a warning at the top of the page.
+func renderHTML(out io.Writer, header []string, rows [][]string, charts []*htmlChart, partial string) error {
+	return htmlTemplate.Execute(out, struct {
+		GeneratedAt time.Time
+		Partial     string
+		Header      []string
+		Rows        [][]string
+		Charts      []*htmlChart
+	}{
+		GeneratedAt: time.Now().UTC(),
+		Partial:     partial,
+		Header:      header,
+		Rows:        rows,
+		Charts:      charts,
+	})
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Cloud Foundry report</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #eee; cursor: pointer; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+tr:nth-child(even) td { background: #f8f8f8; }
+.chart { display: inline-block; vertical-align: top; margin: 0 2em 2em 0; min-width: 300px; }
+.bar { display: flex; align-items: center; margin: 2px 0; }
+.bar .label { width: 200px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+.bar .fill { background: #4a90d9; height: 14px; margin-right: 4px; }
+#filter { margin: 1em 0; padding: 4px; width: 300px; }
+.partial { color: #b00; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Cloud Foundry report</h1>
+<p>Generated at {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+{{if .Partial}}<p class="partial">{{.Partial}}</p>
+{{end}}{{range $c := .Charts}}
+<div class="chart">
+<h3>{{$c.Title}}</h3>
+{{range $c.Bars}}<div class="bar"><span class="label" title="{{.Label}}">{{.Label}}</span><span class="fill" style="width: {{printf "%.1f" ($c.Width .)}}px"></span>{{.Value}}</div>
+{{end}}
+</div>
+{{end}}
+<div><input id="filter" type="search" placeholder="Filter rows..."></div>
+<table id="report">
+<thead><tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+<script>
+(function() {
+  var table = document.getElementById("report");
+  var tbody = table.tBodies[0];
+  var headers = table.tHead.rows[0].cells;
+  var value = function(row, i) {
+    var v = row.cells[i].textContent;
+    var n = parseFloat(v);
+    return (String(n) === v.trim()) ? n : v.toLowerCase();
+  };
+  Array.prototype.forEach.call(headers, function(th, i) {
+    th.addEventListener("click", function() {
+      var asc = !th.classList.contains("asc");
+      Array.prototype.forEach.call(headers, function(h) { h.classList.remove("asc", "desc"); });
+      th.classList.add(asc ? "asc" : "desc");
+      var rows = Array.prototype.slice.call(tbody.rows);
+      rows.sort(function(a, b) {
+        var x = value(a, i), y = value(b, i);
+        var c = (x < y) ? -1 : (x > y) ? 1 : 0;
+        return asc ? c : -c;
+      });
+      rows.forEach(function(r) { tbody.appendChild(r); });
+    });
+  });
+  document.getElementById("filter").addEventListener("input", function(e) {
+    var q = e.target.value.toLowerCase();
+    Array.prototype.forEach.call(tbody.rows, function(r) {
+      r.style.display = r.textContent.toLowerCase().indexOf(q) === -1 ? "none" : "";
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,151 @@
+package report
+
+import "io"
+
+// sharedIsolationSegment is the segment apps run in if neither their space
+// nor their org's default is assigned one
+const sharedIsolationSegment = "shared"
+
+// Where an app's isolation segment is assigned
+const (
+	assignedBySpace    = "space"
+	assignedByOrg      = "org default"
+	assignedByPlatform = "platform"
+)
+
+type isolationUsageInfo struct {
+	Organization     string `json:"organization"`
+	Space            string `json:"space"`
+	Application      string `json:"application"`
+	IsolationSegment string `json:"isolation_segment"`
+
+	// AssignedBy - whether the segment is assigned to the space, is the
+	// org's default, or is the platform's shared segment
+	AssignedBy string `json:"assigned_by"`
+
+	// Entitled - the isolation segments the org is entitled to
+	Entitled []string `json:"entitled,omitempty"`
+
+	Reasons []*reason `json:"reasons,omitempty"`
+}
+
+// reportIsolationSegments lists the isolation segment of every app selected
+// by opts, flagging those whose org is not entitled to it, renders them to
+// out and returns the rows reported on
+func (c *reportBuildpacks) reportIsolationSegments(client *simpleClient, fd Client, out io.Writer, opts *Options) ([]*isolationUsageInfo, error) {
+	apps, err := walkApps(client, fd, opts)
+	if err == ErrInterrupted {
+		opts.Partial = partialNote
+	} else if err != nil {
+		return nil, err
+	}
+
+	var orgs, spaces []*Resource
+	seen := make(map[string]bool)
+	for _, a := range apps {
+		if !seen[a.org.Metadata.Guid] {
+			seen[a.org.Metadata.Guid] = true
+			orgs = append(orgs, a.org)
+		}
+		if !seen[a.space.Metadata.Guid] {
+			seen[a.space.Metadata.Guid] = true
+			spaces = append(spaces, a.space)
+		}
+	}
+
+	endPhase := client.phase("isolation segments")
+	orgSegments := make([]*OrgIsolationSegments, len(orgs))
+	spaceSegments := make([]*string, len(spaces))
+	ierr := client.Parallel(len(orgs), func(i int) (err error) {
+		orgSegments[i], err = fd.OrgIsolationSegments(orgs[i])
+		return err
+	})
+	if ierr == nil {
+		ierr = client.Parallel(len(spaces), func(i int) error {
+			segment, err := fd.SpaceIsolationSegment(spaces[i])
+			if err != nil {
+				return err
+			}
+			spaceSegments[i] = &segment
+			return nil
+		})
+	}
+	endPhase()
+	// if interrupted, the apps whose segments were all looked up are still
+	// reported
+	ierr = interruptedOr(client, ierr)
+	if ierr == ErrInterrupted {
+		opts.Partial = partialNote
+		err = ierr
+	} else if ierr != nil {
+		return nil, ierr
+	}
+
+	byOrg := make(map[string]*OrgIsolationSegments)
+	for i, org := range orgs {
+		byOrg[org.Metadata.Guid] = orgSegments[i]
+	}
+	bySpace := make(map[string]*string)
+	for i, space := range spaces {
+		bySpace[space.Metadata.Guid] = spaceSegments[i]
+	}
+
+	var allInfo []*isolationUsageInfo
+	for _, a := range apps {
+		org, space := byOrg[a.org.Metadata.Guid], bySpace[a.space.Metadata.Guid]
+		if org == nil || space == nil {
+			continue
+		}
+		info := &isolationUsageInfo{
+			Organization:     a.org.Entity.Name,
+			Space:            a.space.Entity.Name,
+			Application:      a.app.Entity.Name,
+			IsolationSegment: *space,
+			AssignedBy:       assignedBySpace,
+			Entitled:         org.Entitled,
+		}
+		if info.IsolationSegment == "" {
+			info.IsolationSegment, info.AssignedBy = org.Default, assignedByOrg
+		}
+		if info.IsolationSegment == "" {
+			info.IsolationSegment, info.AssignedBy = sharedIsolationSegment, assignedByPlatform
+		}
+		if !stringList(org.Entitled).contains(info.IsolationSegment) {
+			info.Reasons = append(info.Reasons, newReason(reasonIsolationSegmentNotEntitled, "%s is not entitled to isolation segment %s, assigned by the %s", info.Organization, info.IsolationSegment, info.AssignedBy))
+		}
+		if opts.AttentionOnly && len(info.Reasons) == 0 {
+			continue
+		}
+		allInfo = append(allInfo, info)
+	}
+
+	sortIsolationUsageInfo(allInfo, opts)
+
+	rerr := renderIsolationUsageInfo(out, allInfo, opts)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return allInfo, err
+}
+
+// renderIsolationUsageInfo writes allInfo to out in the format selected by
+// opts
+func renderIsolationUsageInfo(out io.Writer, allInfo []*isolationUsageInfo, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, allInfo, opts)
+	}
+
+	var rows [][]string
+	for _, info := range allInfo {
+		rows = append(rows, []string{
+			info.Organization,
+			info.Space,
+			info.Application,
+			info.IsolationSegment,
+			info.AssignedBy,
+			reasonsMessage(info.Reasons),
+		})
+	}
+	return renderRows(out, []string{"Organization", "Space", "Application", "Isolation Segment", "Assigned By", "Messages"}, rows, opts)
+}
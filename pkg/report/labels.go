@@ -0,0 +1,171 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AppMetadata is the labels and annotations of an app, which only the v3
+// API has
+type AppMetadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// value returns the label key, or else the annotation key, or "" if the app
+// has neither
+func (md *AppMetadata) value(key string) string {
+	if md == nil {
+		return ""
+	}
+	if v, found := md.Labels[key]; found {
+		return v
+	}
+	return md.Annotations[key]
+}
+
+// Label selector operators, as supported by the cloud controller
+const (
+	selectorExists    = "exists"
+	selectorNotExists = "!exists"
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+)
+
+// labelRequirement is one comma-separated part of a label selector, eg
+// "env!=sandbox" or "tier in (web,api)"
+type labelRequirement struct {
+	key, op string
+	values  []string
+}
+
+// matches returns true if labels satisfy the requirement
+func (lr *labelRequirement) matches(labels map[string]string) bool {
+	v, found := labels[lr.key]
+	switch lr.op {
+	case selectorExists:
+		return found
+	case selectorNotExists:
+		return !found
+	case selectorEquals, selectorIn:
+		return found && stringList(lr.values).contains(v)
+	default:
+		// != and notin also match apps without the label, as the cloud
+		// controller's selectors do
+		return !found || !stringList(lr.values).contains(v)
+	}
+}
+
+// labelSelector is a flag.Value selecting apps by their labels with the
+// cloud controller's label_selector syntax, eg "team=payments,env!=sandbox".
+// Apps must match every requirement.
+type labelSelector struct {
+	raw          string
+	requirements []*labelRequirement
+}
+
+func (ls *labelSelector) String() string {
+	return ls.raw
+}
+
+func (ls *labelSelector) Set(v string) error {
+	for _, part := range splitSelector(v) {
+		lr, err := parseLabelRequirement(part)
+		if err != nil {
+			return err
+		}
+		ls.requirements = append(ls.requirements, lr)
+	}
+	if ls.raw != "" {
+		ls.raw += ","
+	}
+	ls.raw += v
+	return nil
+}
+
+// empty returns true if the selector has no requirements, so matches all apps
+func (ls *labelSelector) empty() bool {
+	return len(ls.requirements) == 0
+}
+
+// matches returns true if md's labels satisfy every requirement
+func (ls *labelSelector) matches(md *AppMetadata) bool {
+	var labels map[string]string
+	if md != nil {
+		labels = md.Labels
+	}
+	for _, lr := range ls.requirements {
+		if !lr.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitSelector splits s on the commas that aren't within the parentheses of
+// a set, eg "tier in (web,api),team=payments"
+func splitSelector(s string) []string {
+	var rv []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				rv = append(rv, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(rv, s[start:])
+}
+
+// parseLabelRequirement parses one requirement of a label selector
+func parseLabelRequirement(s string) (*labelRequirement, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("empty requirement in label selector")
+	}
+
+	if i := strings.Index(s, "("); i != -1 {
+		if !strings.HasSuffix(s, ")") {
+			return nil, fmt.Errorf("label selector %q: expected a set ending in \")\"", s)
+		}
+		fields := strings.Fields(s[:i])
+		if len(fields) != 2 || (fields[1] != selectorIn && fields[1] != selectorNotIn) {
+			return nil, fmt.Errorf("label selector %q: expected \"key in (...)\" or \"key notin (...)\"", s)
+		}
+		var values []string
+		for _, v := range strings.Split(s[i+1:len(s)-1], ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		return &labelRequirement{key: fields[0], op: fields[1], values: values}, nil
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(s, op); i != -1 {
+			key, value := strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(op):])
+			if key == "" {
+				return nil, fmt.Errorf("label selector %q: missing key", s)
+			}
+			lr := &labelRequirement{key: key, op: selectorEquals, values: []string{value}}
+			if op == "!=" {
+				lr.op = selectorNotEquals
+			}
+			return lr, nil
+		}
+	}
+
+	if strings.HasPrefix(s, "!") {
+		return &labelRequirement{key: strings.TrimSpace(s[1:]), op: selectorNotExists}, nil
+	}
+	if strings.ContainsAny(s, " \t") {
+		return nil, fmt.Errorf("label selector %q: unexpected space in key", s)
+	}
+	return &labelRequirement{key: s, op: selectorExists}, nil
+}
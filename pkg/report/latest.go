@@ -0,0 +1,167 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultGitHubAPI is where -check-latest looks up buildpack releases
+const defaultGitHubAPI = "https://api.github.com"
+
+// stagedBuildpack is a buildpack, with a known version, that a droplet was staged with
+type stagedBuildpack struct {
+	name, version string
+}
+
+// latestReleases looks up the releases of the Cloud Foundry buildpacks on
+// GitHub, fetching each buildpack's releases once
+type latestReleases struct {
+	// API - base URL of the GitHub API
+	API string
+
+	// Token - if set, sent to GitHub to avoid low anonymous rate limits
+	Token string
+
+	// Behind - apps are flagged when they are this many releases or more behind
+	Behind int
+
+	mu    sync.Mutex
+	repos map[string]*repoReleases
+}
+
+// repoReleases are the versions released in a repo, newest first
+type repoReleases struct {
+	once     sync.Once
+	versions []string
+}
+
+// buildpackRepo returns the cloudfoundry GitHub repo for a buildpack name,
+// eg java_buildpack_offline is released from java-buildpack
+func buildpackRepo(name string) string {
+	name = strings.TrimSuffix(name, "_offline")
+	return strings.Replace(name, "_", "-", -1)
+}
+
+// releases returns the versions released for the buildpack name, newest
+// first, or nil if it is not a Cloud Foundry buildpack or they could not be
+// fetched
+func (lr *latestReleases) releases(name string) []string {
+	repo := buildpackRepo(name)
+
+	lr.mu.Lock()
+	if lr.repos == nil {
+		lr.repos = make(map[string]*repoReleases)
+	}
+	rr, found := lr.repos[repo]
+	if !found {
+		rr = &repoReleases{}
+		lr.repos[repo] = rr
+	}
+	lr.mu.Unlock()
+
+	rr.once.Do(func() {
+		var err error
+		rr.versions, err = lr.fetch(repo)
+		// a buildpack that isn't one of ours has nothing to compare against
+		if err != nil && !isNotFound(err) {
+			logf(levelWarn, nil, "could not check latest release of %s: %s", name, err)
+		}
+	})
+	return rr.versions
+}
+
+// fetch lists the releases of repo, ignoring drafts and pre-releases
+func (lr *latestReleases) fetch(repo string) ([]string, error) {
+	u := fmt.Sprintf("%s/repos/cloudfoundry/%s/releases?per_page=100", strings.TrimSuffix(lr.API, "/"), repo)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if lr.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+lr.Token)
+	}
+	resp, err := externalClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, newAPIError(http.MethodGet, u, resp)
+	}
+
+	var releases []struct {
+		TagName    string `json:"tag_name"`
+		Draft      bool   `json:"draft"`
+		Prerelease bool   `json:"prerelease"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&releases)
+	if err != nil {
+		return nil, err
+	}
+
+	var rv []string
+	for _, r := range releases {
+		if !r.Draft && !r.Prerelease {
+			rv = append(rv, strings.TrimPrefix(r.TagName, "v"))
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return compareVersions(rv[i], rv[j]) > 0
+	})
+	return rv, nil
+}
+
+// compareVersions orders dotted versions numerically where possible, eg 1.10 after 1.9
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		var c int
+		if aErr == nil && bErr == nil {
+			c = compareInts(int64(an), int64(bn))
+		} else {
+			c = strings.Compare(as[i], bs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(int64(len(as)), int64(len(bs)))
+}
+
+// releasesBehind returns how many of versions, newest first, are newer
+// than version
+func releasesBehind(versions []string, version string) int {
+	behind := 0
+	for _, v := range versions {
+		if compareVersions(v, version) <= 0 {
+			break
+		}
+		behind++
+	}
+	return behind
+}
+
+// check flags each buildpack in staged that is lr.Behind or more releases
+// behind the latest release
+func (lr *latestReleases) check(staged []stagedBuildpack) []*reason {
+	var reasons []*reason
+	for _, bp := range staged {
+		versions := lr.releases(bp.name)
+		if len(versions) == 0 {
+			continue
+		}
+		behind := releasesBehind(versions, bp.version)
+		if behind >= lr.Behind {
+			reasons = append(reasons, newReason(reasonBehindLatestRelease, "staged with %s v%s, %d releases behind the latest release v%s", bp.name, bp.version, behind, versions[0]))
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFormats are the values accepted by -log-format
+var logFormats = []string{"text", "json"}
+
+// validateLogFormat returns an error if format is not one of logFormats
+func validateLogFormat(format string) error {
+	for _, f := range logFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log format %q, expected one of %s", format, strings.Join(logFormats, ", "))
+}
+
+// Log levels, as shown by -log-format json
+const (
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+)
+
+// logFields are extra fields of a log entry, only shown by -log-format json
+type logFields map[string]interface{}
+
+// jsonLogger writes log entries to stderr as JSON, one per line. It is set
+// by -log-format json, and is otherwise nil.
+var jsonLogger *jsonLogWriter
+
+// jsonLogWriter is the output of the log package for -log-format json, so
+// that messages logged with it are written as info entries too
+type jsonLogWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// setLogFormat sends log messages to stderr in format, one of logFormats
+func setLogFormat(format string) {
+	if format != "json" {
+		jsonLogger = nil
+		log.SetFlags(log.LstdFlags)
+		log.SetOutput(os.Stderr)
+		return
+	}
+	jsonLogger = &jsonLogWriter{w: os.Stderr}
+	log.SetFlags(0)
+	log.SetOutput(jsonLogger)
+}
+
+func (jw *jsonLogWriter) Write(p []byte) (int, error) {
+	err := jw.entry(levelInfo, strings.TrimSuffix(string(p), "\n"), nil)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// entry writes a log entry with msg and fields at level
+func (jw *jsonLogWriter) entry(level, msg string, fields logFields) error {
+	e := logFields{}
+	for k, v := range fields {
+		e[k] = v
+	}
+	e["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+	e["level"] = level
+	e["msg"] = msg
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+	_, err = jw.w.Write(append(b, '\n'))
+	return err
+}
+
+// logf logs a message at level. fields are only shown by -log-format json.
+func logf(level string, fields logFields, format string, v ...interface{}) {
+	if jsonLogger == nil {
+		log.Printf(format, v...)
+		return
+	}
+	jsonLogger.entry(level, fmt.Sprintf(format, v...), fields)
+}
+
+// logFatal logs an error as log.Fatal does, then exits with status 1
+func logFatal(v ...interface{}) {
+	logf(levelError, nil, "%s", fmt.Sprint(v...))
+	os.Exit(1)
+}
+
+// logFatalf logs an error as log.Fatalf does, then exits with status 1
+func logFatalf(format string, v ...interface{}) {
+	logf(levelError, nil, format, v...)
+	os.Exit(1)
+}
@@ -0,0 +1,74 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// memoryUnits are the values accepted by -memory-unit. "auto" formats each
+// value with the most readable unit, the others format values as plain
+// numbers of that unit, for consistent sorting in spreadsheets.
+var memoryUnits = []string{"auto", "mb", "gb"}
+
+// validateMemoryUnit returns an error if unit is not one of memoryUnits
+func validateMemoryUnit(unit string) error {
+	for _, u := range memoryUnits {
+		if u == unit {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown memory unit %q, expected one of %s", unit, strings.Join(memoryUnits, ", "))
+}
+
+// formatMemory formats mb megabytes in unit, which is one of memoryUnits
+func formatMemory(mb int64, unit string) string {
+	switch unit {
+	case "mb":
+		return strconv.FormatInt(mb, 10)
+	case "gb":
+		return strconv.FormatFloat(float64(mb)/1024, 'f', -1, 64)
+	}
+	switch {
+	case mb < 1024:
+		return fmt.Sprintf("%d MB", mb)
+	case mb < 1024*1024:
+		return oneDecimal(float64(mb)/1024) + " GB"
+	default:
+		return oneDecimal(float64(mb)/(1024*1024)) + " TB"
+	}
+}
+
+// parseMemory parses an amount of memory as the cf CLI does, eg "512M" or
+// "1G", returning it in MB. Plain numbers are MB.
+func parseMemory(s string) (int64, error) {
+	v := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(v, "M"):
+		v = strings.TrimSuffix(v, "M")
+	case strings.HasSuffix(v, "G"):
+		v, multiplier = strings.TrimSuffix(v, "G"), 1024
+	case strings.HasSuffix(v, "T"):
+		v, multiplier = strings.TrimSuffix(v, "T"), 1024*1024
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory %q, expected eg 512M or 1G", s)
+	}
+	return n * multiplier, nil
+}
+
+// oneDecimal formats f to one decimal place, dropping it if it is zero
+func oneDecimal(f float64) string {
+	return strings.TrimSuffix(strconv.FormatFloat(f, 'f', 1, 64), ".0")
+}
+
+// memoryHeader returns the column header for memory named name, giving the
+// unit if it is the same for all values
+func memoryHeader(name, unit string) string {
+	if unit == "auto" || unit == "" {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.ToUpper(unit))
+}
@@ -0,0 +1,65 @@
+package report
+
+import "testing"
+
+func TestFormatMemory(t *testing.T) {
+	for _, tc := range []struct {
+		mb   int64
+		unit string
+		want string
+	}{
+		{512, "auto", "512 MB"},
+		{1536, "auto", "1.5 GB"},
+		{2048, "auto", "2 GB"},
+		{3 * 1024 * 1024, "auto", "3 TB"},
+		{1536, "mb", "1536"},
+		{1536, "gb", "1.5"},
+	} {
+		if got := formatMemory(tc.mb, tc.unit); got != tc.want {
+			t.Errorf("formatMemory(%d, %q) = %q, want %q", tc.mb, tc.unit, got, tc.want)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	for s, want := range map[string]int64{"512": 512, "512M": 512, "512mb": 512, "1G": 1024, " 2gb ": 2048, "1T": 1024 * 1024} {
+		got, err := parseMemory(s)
+		if err != nil || got != want {
+			t.Errorf("parseMemory(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "1X", "-1G", "G"} {
+		if _, err := parseMemory(s); err == nil {
+			t.Errorf("parseMemory(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestTotalMemory(t *testing.T) {
+	app := &Resource{}
+	app.Entity.Memory, app.Entity.Instances = 1024, 2
+	if got := app.totalMemory(); got != 2048 {
+		t.Errorf("without processes got %d, want 2048", got)
+	}
+	if got := app.totalInstances(); got != 2 {
+		t.Errorf("without processes got %d instances, want 2", got)
+	}
+
+	// once listed, all processes count, not just web
+	app.Entity.ProcessMemory = map[string]int64{"web": 2048, "worker": 512}
+	app.Entity.ProcessInstances = 3
+	if got := app.totalMemory(); got != 2560 {
+		t.Errorf("with processes got %d, want 2560", got)
+	}
+	if got := app.totalInstances(); got != 3 {
+		t.Errorf("with processes got %d instances, want 3", got)
+	}
+
+	got := processMemory([]*v3Resource{
+		{Type: "web", MemoryInMB: 1024, Instances: 2},
+		{Type: "worker", MemoryInMB: 256, Instances: 1},
+	})
+	if got["web"] != 2048 || got["worker"] != 256 {
+		t.Errorf("processMemory() = %v, want web 2048 and worker 256", got)
+	}
+}
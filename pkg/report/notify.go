@@ -0,0 +1,163 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSlackApps is how many apps needing attention are listed in a Slack message
+const maxSlackApps = 20
+
+// maxSlackOrgs is how many orgs are listed as top offenders in a Slack message
+const maxSlackOrgs = 5
+
+// externalClient is used for requests to services other than the API
+var externalClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON POSTs v as JSON to u, with headers set on the request
+func postJSON(u string, headers map[string]string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := externalClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// don't include the URL, webhook URLs are secrets
+		return newAPIError(http.MethodPost, req.URL.Host, resp)
+	}
+	return nil
+}
+
+type slackMessage struct {
+	Text        string             `json:"text"`
+	Attachments []*slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	Color string `json:"color,omitempty"`
+}
+
+// countEntry is a name and how many times it occurred
+type countEntry struct {
+	name  string
+	count int
+}
+
+// sortedCounts returns counts ordered by count descending, then by name
+func sortedCounts(counts map[string]int) []countEntry {
+	var rv []countEntry
+	for name, count := range counts {
+		rv = append(rv, countEntry{name: name, count: count})
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		if rv[i].count != rv[j].count {
+			return rv[i].count > rv[j].count
+		}
+		return rv[i].name < rv[j].name
+	})
+	return rv
+}
+
+// slackSummary builds a message with counts per reason code, the orgs with
+// the most apps needing attention and a list of those apps
+func slackSummary(allInfo []*AppBuildpackInfo, reportLocation string) *slackMessage {
+	reasons := make(map[string]int)
+	orgs := make(map[string]int)
+	var attention []*AppBuildpackInfo
+	for _, info := range allInfo {
+		if !info.needsAttention() {
+			continue
+		}
+		attention = append(attention, info)
+		orgs[strings.TrimPrefix(info.Foundation+"/", "/")+info.Organization]++
+		for _, r := range info.Reasons {
+			reasons[r.Code]++
+		}
+	}
+
+	msg := &slackMessage{
+		Text: fmt.Sprintf("report-buildpacks: %d of %d apps need attention", len(attention), len(allInfo)),
+	}
+	if reportLocation != "" {
+		msg.Text += fmt.Sprintf(", full report in %s", reportLocation)
+	}
+	if len(attention) == 0 {
+		return msg
+	}
+
+	var lines []string
+	for _, c := range sortedCounts(reasons) {
+		lines = append(lines, fmt.Sprintf("%s: %d", c.name, c.count))
+	}
+	msg.Attachments = append(msg.Attachments, &slackAttachment{Title: "Reasons", Text: strings.Join(lines, "\n"), Color: "warning"})
+
+	lines = nil
+	for i, c := range sortedCounts(orgs) {
+		if i == maxSlackOrgs {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d", c.name, c.count))
+	}
+	msg.Attachments = append(msg.Attachments, &slackAttachment{Title: "Top orgs", Text: strings.Join(lines, "\n"), Color: "warning"})
+
+	lines = nil
+	for i, info := range attention {
+		if i == maxSlackApps {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(attention)-maxSlackApps))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", info.name(), info.messages()))
+	}
+	msg.Attachments = append(msg.Attachments, &slackAttachment{Title: "Apps needing attention", Text: "```" + strings.Join(lines, "\n") + "```"})
+
+	return msg
+}
+
+// notifySlack posts a summary of allInfo to a Slack incoming webhook
+func notifySlack(webhookURL string, allInfo []*AppBuildpackInfo, reportLocation string) error {
+	err := postJSON(webhookURL, nil, slackSummary(allInfo, reportLocation))
+	if err != nil {
+		return fmt.Errorf("notifying Slack: %s", err)
+	}
+	return nil
+}
+
+// postReport POSTs allInfo as JSON to u. If token is set, it is sent as a
+// bearer token.
+func postReport(u string, headers headerList, token string, allInfo []*AppBuildpackInfo) error {
+	h := make(map[string]string)
+	for k, v := range headers {
+		h[k] = v
+	}
+	if token != "" {
+		h["Authorization"] = "Bearer " + token
+	}
+	if allInfo == nil {
+		// an empty report is still a report
+		allInfo = []*AppBuildpackInfo{}
+	}
+	err := postJSON(u, h, allInfo)
+	if err != nil {
+		return fmt.Errorf("posting report: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codes of the ordering issues flagged by report-buildpack-order
+const (
+	// a buildpack that detects any app is positioned before a language
+	// buildpack, so apps it would detect are staged with the catch-all
+	// instead
+	reasonCatchAllFirst = "CATCH_ALL_BEFORE_LANGUAGE"
+
+	// the same buildpack is installed for any stack and for a specific stack,
+	// so the later one is never auto-detected for that stack
+	reasonShadowed = "SHADOWED"
+)
+
+// catchAllBuildpacks detect any app, so should be positioned after the
+// language buildpacks
+var catchAllBuildpacks = stringList{"binary_buildpack"}
+
+// orderedBuildpack is an installed buildpack in detection order, with any
+// issues with its position
+type orderedBuildpack struct {
+	Position  int       `json:"position"`
+	Buildpack string    `json:"buildpack"`
+	Stack     string    `json:"stack,omitempty"`
+	Enabled   bool      `json:"enabled"`
+	Locked    bool      `json:"locked"`
+	Filename  string    `json:"filename"`
+	Issues    []*reason `json:"issues,omitempty"`
+}
+
+// sameStack returns true if buildpacks for stacks a and b are both
+// auto-detected for some app, a stack of "" meaning any stack
+func sameStack(a, b string) bool {
+	return a == "" || b == "" || a == b
+}
+
+// stackName describes stack in issues
+func stackName(stack string) string {
+	if stack == "" {
+		return "any stack"
+	}
+	return stack
+}
+
+// checkBuildpackOrder flags the issues with the positions of ordered, which
+// is sorted by position
+func checkBuildpackOrder(ordered []*orderedBuildpack) {
+	for i, bp := range ordered {
+		if !bp.Enabled {
+			continue
+		}
+		var shadowed stringList
+		for _, later := range ordered[i+1:] {
+			if !later.Enabled || !sameStack(bp.Stack, later.Stack) {
+				continue
+			}
+			switch {
+			case later.Buildpack == bp.Buildpack:
+				later.Issues = append(later.Issues, newReason(reasonShadowed,
+					"%s for %s at position %d is detected first", bp.Buildpack, stackName(bp.Stack), bp.Position))
+			case catchAllBuildpacks.contains(bp.Buildpack) && !catchAllBuildpacks.contains(later.Buildpack) && !shadowed.contains(later.Buildpack):
+				shadowed = append(shadowed, later.Buildpack)
+			}
+		}
+		if len(shadowed) != 0 {
+			bp.Issues = append(bp.Issues, newReason(reasonCatchAllFirst,
+				"detects any app, but is before %s", strings.Join(shadowed, ", ")))
+		}
+	}
+}
+
+// reportBuildpackOrder lists the installed buildpacks in detection order,
+// flagging those whose positions cause apps to be auto-detected wrongly,
+// renders them to out and returns them
+func (c *reportBuildpacks) reportBuildpackOrder(fd Client, out io.Writer, opts *Options) ([]*orderedBuildpack, error) {
+	var ordered []*orderedBuildpack
+	err := fd.Buildpacks(func(bp *Resource) error {
+		ordered = append(ordered, &orderedBuildpack{
+			Position:  bp.Entity.Position,
+			Buildpack: bp.Entity.Name,
+			Stack:     bp.Entity.Stack,
+			Enabled:   bp.Entity.Enabled,
+			Locked:    bp.Entity.Locked,
+			Filename:  bp.Entity.Filename,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Position < ordered[j].Position
+	})
+	checkBuildpackOrder(ordered)
+
+	if opts.AttentionOnly {
+		var flagged []*orderedBuildpack
+		for _, o := range ordered {
+			if len(o.Issues) != 0 {
+				flagged = append(flagged, o)
+			}
+		}
+		ordered = flagged
+	}
+
+	if opts.OutputJSON {
+		return ordered, renderJSON(out, ordered, opts)
+	}
+
+	var rows [][]string
+	for _, o := range ordered {
+		var issues []string
+		for _, r := range o.Issues {
+			issues = append(issues, fmt.Sprintf("%s: %s", r.Code, r.Description))
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(o.Position),
+			o.Buildpack,
+			o.Stack,
+			strconv.FormatBool(o.Enabled),
+			strconv.FormatBool(o.Locked),
+			o.Filename,
+			strings.Join(issues, "; "),
+		})
+	}
+	return ordered, renderRows(out, []string{"Position", "Buildpack", "Stack", "Enabled", "Locked", "Filename", "Issues"}, rows, opts)
+}
@@ -0,0 +1,92 @@
+package report
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// orphanedBuildpack is an installed buildpack that no current droplet was staged with
+type orphanedBuildpack struct {
+	Position  int       `json:"position"`
+	Buildpack string    `json:"buildpack"`
+	Stack     string    `json:"stack,omitempty"`
+	Enabled   bool      `json:"enabled"`
+	Locked    bool      `json:"locked"`
+	Filename  string    `json:"filename"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// reportOrphanedBuildpacks lists the installed buildpacks that are not used
+// by any app's current droplet, renders them to out and returns them
+func (c *reportBuildpacks) reportOrphanedBuildpacks(client *simpleClient, fd Client, out io.Writer, opts *Options) ([]*orphanedBuildpack, error) {
+	// a buildpack is only orphaned if no app anywhere uses it, so all apps
+	// are checked regardless of the filters given
+	all := Options{IncludeStopped: true}
+	allInfo, err := collectUsageInfo(client, fd, &all, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []*Resource
+	err = fd.Buildpacks(func(bp *Resource) error {
+		installed = append(installed, bp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// mark each buildpack used, as matched by appUsageInfo
+	byKey := make(installedBuildpacks)
+	for _, bp := range installed {
+		byKey[buildpackKey{name: bp.Entity.Name, stack: bp.Entity.Stack}] = bp
+	}
+	used := make(map[*Resource]bool)
+	for _, info := range allInfo {
+		for _, name := range info.BuildpackNames {
+			bp, found := byKey.find(name, info.Stack)
+			if found {
+				used[bp] = true
+			}
+		}
+	}
+
+	var orphaned []*orphanedBuildpack
+	for _, bp := range installed {
+		if used[bp] {
+			continue
+		}
+		orphaned = append(orphaned, &orphanedBuildpack{
+			Position:  bp.Entity.Position,
+			Buildpack: bp.Entity.Name,
+			Stack:     bp.Entity.Stack,
+			Enabled:   bp.Entity.Enabled,
+			Locked:    bp.Entity.Locked,
+			Filename:  bp.Entity.Filename,
+			UpdatedAt: bp.Metadata.UpdatedAt,
+		})
+	}
+	sort.SliceStable(orphaned, func(i, j int) bool {
+		return orphaned[i].Position < orphaned[j].Position
+	})
+
+	if opts.OutputJSON {
+		return orphaned, renderJSON(out, orphaned, opts)
+	}
+
+	var rows [][]string
+	for _, o := range orphaned {
+		rows = append(rows, []string{
+			strconv.Itoa(o.Position),
+			o.Buildpack,
+			o.Stack,
+			strconv.FormatBool(o.Enabled),
+			strconv.FormatBool(o.Locked),
+			o.Filename,
+			o.UpdatedAt.Format("2006-01-02"),
+		})
+	}
+	return orphaned, renderRows(out, []string{"Position", "Buildpack", "Stack", "Enabled", "Locked", "Filename", "Updated"}, rows, opts)
+}
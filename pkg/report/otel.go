@@ -0,0 +1,260 @@
+package report
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otlpBatchSize is how many spans are exported per OTLP request
+const otlpBatchSize = 5000
+
+// span kinds and status codes, as numbered by OTLP
+const (
+	otelKindInternal = 1
+	otelKindClient   = 3
+
+	otelStatusError = 2
+)
+
+// otelTracer records spans of a run for -otlp-endpoint: the run, each phase
+// of collecting, each org, space and app, and each API request. Its methods
+// do nothing if it is nil, so clients need not check whether tracing is
+// enabled. As requests aren't made with a context saying which org, space or
+// app they are for, request spans are children of the phase they were made
+// in.
+type otelTracer struct {
+	traceID string
+	root    *otelSpan
+
+	mu    sync.Mutex
+	phase *otelSpan
+	spans []*otelSpan
+}
+
+// otelSpan is a span of a trace
+type otelSpan struct {
+	tracer   *otelTracer
+	id       string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    []otelAttribute
+	err      error
+}
+
+// otelAttribute is an attribute of a span, whose value is a string or int
+type otelAttribute struct {
+	key   string
+	value interface{}
+}
+
+// randomID returns n random bytes as hex, as OTLP JSON encodes IDs
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newOTelTracer returns a tracer with a root span for the run named name
+func newOTelTracer(name string, attrs ...otelAttribute) *otelTracer {
+	t := &otelTracer{traceID: randomID(16)}
+	t.root = &otelSpan{tracer: t, id: randomID(8), name: name, kind: otelKindInternal, start: time.Now(), attrs: attrs}
+	return t
+}
+
+// start starts a span, as a child of the current phase if there is one
+func (t *otelTracer) start(name string, attrs ...otelAttribute) *otelSpan {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	parent := t.root
+	if t.phase != nil {
+		parent = t.phase
+	}
+	t.mu.Unlock()
+	return &otelSpan{tracer: t, id: randomID(8), parentID: parent.id, name: name, kind: otelKindInternal, start: time.Now(), attrs: attrs}
+}
+
+// phaseSpan starts a span for the named phase of collecting, which spans
+// started before it ends are children of, and returns a func to call when
+// it ends
+func (t *otelTracer) phaseSpan(name string) func() {
+	if t == nil {
+		return func() {}
+	}
+	s := &otelSpan{tracer: t, id: randomID(8), parentID: t.root.id, name: name, kind: otelKindInternal, start: time.Now()}
+	t.mu.Lock()
+	t.phase = s
+	t.mu.Unlock()
+	return func() {
+		s.finish(nil)
+		t.mu.Lock()
+		t.phase = nil
+		t.mu.Unlock()
+	}
+}
+
+// request records a span for an API request that started at start and has
+// just completed with status, or failed with err
+func (t *otelTracer) request(method, u string, status int, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	s := t.start(method, otelAttribute{"http.request.method", method}, otelAttribute{"url.full", u})
+	s.kind = otelKindClient
+	s.start = start
+	if status != 0 {
+		s.attrs = append(s.attrs, otelAttribute{"http.response.status_code", status})
+	}
+	s.finish(err)
+}
+
+// finish ends the span, failed with err if it is not nil
+func (s *otelSpan) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.mu.Unlock()
+}
+
+// resourceAttributes returns attributes with the name and guid of r, which is
+// of the given kind, eg cf.org.name and cf.org.guid
+func resourceAttributes(kind string, r *Resource) []otelAttribute {
+	return []otelAttribute{
+		{"cf." + kind + ".name", r.Entity.Name},
+		{"cf." + kind + ".guid", r.Metadata.Guid},
+	}
+}
+
+// attributes returns attributes identifying the space and its org
+func (s spaceInOrg) attributes() []otelAttribute {
+	return append(resourceAttributes("org", s.org), resourceAttributes("space", s.space)...)
+}
+
+// attributes returns attributes identifying the app, its space and its org
+func (a appInSpace) attributes() []otelAttribute {
+	return append(a.spaceInOrg.attributes(), resourceAttributes("app", a.app)...)
+}
+
+// otlpSpan is a span as encoded in OTLP JSON
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *otelSpan) otlp() *otlpSpan {
+	rv := &otlpSpan{
+		TraceID:           s.tracer.traceID,
+		SpanID:            s.id,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	for _, a := range s.attrs {
+		switch v := a.value.(type) {
+		case int:
+			// OTLP JSON encodes 64 bit ints as strings
+			rv.Attributes = append(rv.Attributes, otlpAttribute{Key: a.key, Value: map[string]string{"intValue": strconv.Itoa(v)}})
+		default:
+			rv.Attributes = append(rv.Attributes, otlpAttribute{Key: a.key, Value: map[string]string{"stringValue": fmt.Sprint(v)}})
+		}
+	}
+	if s.err != nil {
+		rv.Status = &otlpStatus{Code: otelStatusError, Message: s.err.Error()}
+	}
+	return rv
+}
+
+// otlpTracesURL returns the URL to export traces to for endpoint, which is
+// the base URL of an OTLP/HTTP receiver unless it already ends with the
+// traces path
+func otlpTracesURL(endpoint string) string {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+// otlpHeaders returns the headers in $OTEL_EXPORTER_OTLP_HEADERS, given as
+// comma-separated key=value pairs, to send with exported traces
+func otlpHeaders() map[string]string {
+	rv := make(map[string]string)
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			continue
+		}
+		rv[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return rv
+}
+
+// export ends the run's span, and exports all spans recorded to the OTLP/HTTP
+// receiver at endpoint
+func (t *otelTracer) export(endpoint string) error {
+	t.root.finish(nil)
+
+	t.mu.Lock()
+	spans := t.spans
+	t.mu.Unlock()
+
+	resource := map[string]interface{}{
+		"attributes": []otlpAttribute{{Key: "service.name", Value: map[string]string{"stringValue": "cf-report-buildpacks"}}},
+	}
+	for start := 0; start < len(spans); start += otlpBatchSize {
+		end := start + otlpBatchSize
+		if end > len(spans) {
+			end = len(spans)
+		}
+		var batch []*otlpSpan
+		for _, s := range spans[start:end] {
+			batch = append(batch, s.otlp())
+		}
+		err := postJSON(otlpTracesURL(endpoint), otlpHeaders(), map[string]interface{}{
+			"resourceSpans": []interface{}{map[string]interface{}{
+				"resource": resource,
+				"scopeSpans": []interface{}{map[string]interface{}{
+					"scope": map[string]string{"name": "cf-report-buildpacks"},
+					"spans": batch,
+				}},
+			}},
+		})
+		if err != nil {
+			return fmt.Errorf("exporting traces: %s", err)
+		}
+	}
+	return nil
+}
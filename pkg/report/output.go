@@ -0,0 +1,44 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is written to a temporary file alongside path, which is renamed
+// to path by Commit, so that readers never see a partially written report
+type atomicFile struct {
+	*os.File
+	path string
+}
+
+func createAtomicFile(path string) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp uses 0600, but the report isn't secret
+	err = f.Chmod(0644)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// Commit closes the temporary file and renames it to path
+func (af *atomicFile) Commit() error {
+	err := af.File.Close()
+	if err != nil {
+		os.Remove(af.File.Name())
+		return err
+	}
+	return os.Rename(af.File.Name(), af.path)
+}
+
+// Abort closes and removes the temporary file, leaving path untouched
+func (af *atomicFile) Abort() {
+	af.File.Close()
+	os.Remove(af.File.Name())
+}
@@ -0,0 +1,195 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// defaultPivnetAPI is where -check-pivnet looks up buildpack releases
+const defaultPivnetAPI = "https://network.tanzu.vmware.com"
+
+// pivnetReleases looks up the releases of buildpacks on Tanzu Network
+// (formerly Pivotal Network), fetching each product's releases once
+type pivnetReleases struct {
+	// API - base URL of Tanzu Network
+	API string
+
+	// Token - the UAA API token of a Tanzu Network account, exchanged for
+	// an access token to list releases with
+	Token string
+
+	authOnce    sync.Once
+	accessToken string
+	authErr     error
+
+	mu       sync.Mutex
+	products map[string]*repoReleases
+}
+
+// buildpackProduct returns the Tanzu Network product slug for a buildpack
+// name, eg java_buildpack_offline is released as java-buildpack
+func buildpackProduct(name string) string {
+	return buildpackRepo(name)
+}
+
+// installedVersion matches the version in the filename of an installed
+// buildpack, eg java-buildpack-offline-cflinuxfs4-v4.50.zip
+var installedVersion = regexp.MustCompile(`-v([0-9][0-9.]*)\.zip$`)
+
+// authorize exchanges pr.Token for an access token, once
+func (pr *pivnetReleases) authorize() (string, error) {
+	pr.authOnce.Do(func() {
+		u := strings.TrimSuffix(pr.API, "/") + "/api/v2/authentication/access_tokens"
+		var rv struct {
+			AccessToken string `json:"access_token"`
+		}
+		pr.authErr = pivnetRequest(http.MethodPost, u, "", map[string]string{"refresh_token": pr.Token}, &rv)
+		if pr.authErr == nil && rv.AccessToken == "" {
+			pr.authErr = fmt.Errorf("no access token returned by %s", u)
+		}
+		pr.accessToken = rv.AccessToken
+	})
+	return pr.accessToken, pr.authErr
+}
+
+// pivnetRequest makes a request to Tanzu Network, sending body as JSON if it
+// is not nil, and json.Unmarshals the response to rv
+func pivnetRequest(method, u, accessToken string, body, rv interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := externalClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return newAPIError(method, u, resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(rv)
+}
+
+// releases returns the versions released for the buildpack name, newest
+// first, or nil if it is not on Tanzu Network or they could not be fetched
+func (pr *pivnetReleases) releases(name string) []string {
+	product := buildpackProduct(name)
+
+	pr.mu.Lock()
+	if pr.products == nil {
+		pr.products = make(map[string]*repoReleases)
+	}
+	rr, found := pr.products[product]
+	if !found {
+		rr = &repoReleases{}
+		pr.products[product] = rr
+	}
+	pr.mu.Unlock()
+
+	rr.once.Do(func() {
+		var err error
+		rr.versions, err = pr.fetch(product)
+		if err != nil && !isNotFound(err) {
+			logf(levelWarn, nil, "could not check latest Tanzu Network release of %s: %s", name, err)
+		}
+	})
+	return rr.versions
+}
+
+// fetch lists the releases of product
+func (pr *pivnetReleases) fetch(product string) ([]string, error) {
+	accessToken, err := pr.authorize()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/api/v2/products/%s/releases", strings.TrimSuffix(pr.API, "/"), product)
+	var rv struct {
+		Releases []struct {
+			Version string `json:"version"`
+		} `json:"releases"`
+	}
+	err = pivnetRequest(http.MethodGet, u, accessToken, nil, &rv)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, r := range rv.Releases {
+		versions = append(versions, strings.TrimPrefix(r.Version, "v"))
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) > 0
+	})
+	return versions, nil
+}
+
+// check flags each buildpack in staged that is behind its latest release
+func (pr *pivnetReleases) check(staged []stagedBuildpack) []*reason {
+	var reasons []*reason
+	for _, bp := range staged {
+		versions := pr.releases(bp.name)
+		if len(versions) == 0 {
+			continue
+		}
+		if behind := releasesBehind(versions, bp.version); behind > 0 {
+			reasons = append(reasons, newReason(reasonBehindPivnetRelease, "staged with %s v%s, %d releases behind the latest Tanzu Network release v%s", bp.name, bp.version, behind, versions[0]))
+		}
+	}
+	return reasons
+}
+
+// checkInstalled warns of each installed admin buildpack that is behind its
+// latest release
+func (pr *pivnetReleases) checkInstalled(buildpacks installedBuildpacks) {
+	var keys []buildpackKey
+	for k := range buildpacks {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].stack < keys[j].stack
+	})
+
+	for _, k := range keys {
+		m := installedVersion.FindStringSubmatch(buildpacks[k].Entity.Filename)
+		if m == nil {
+			continue
+		}
+		versions := pr.releases(k.name)
+		if len(versions) == 0 {
+			continue
+		}
+		if behind := releasesBehind(versions, m[1]); behind > 0 {
+			name := k.name
+			if k.stack != "" {
+				name += " for " + k.stack
+			}
+			logf(levelWarn, logFields{"buildpack": k.name, "stack": k.stack, "version": m[1], "latest": versions[0]},
+				"installed buildpack %s is v%s, %d releases behind the latest Tanzu Network release v%s", name, m[1], behind, versions[0])
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package report
+
+import "strings"
+
+// policy declares which buildpacks apps may use. It is read from a JSON file.
+type policy struct {
+	// AllowedBuildpacks - if set, apps may only use these buildpacks
+	AllowedBuildpacks []string `json:"allowed_buildpacks"`
+
+	// MinimumVersions - lowest version of each buildpack apps may be staged with
+	MinimumVersions map[string]string `json:"minimum_versions"`
+
+	// BannedBuildpackURLs - custom buildpacks with URLs starting with any of
+	// these may not be used
+	BannedBuildpackURLs []string `json:"banned_buildpack_urls"`
+}
+
+func loadPolicy(path string) (*policy, error) {
+	var p policy
+	err := readJSONFile(path, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// isPolicyReason returns true if code is raised by a policy
+func isPolicyReason(code string) bool {
+	return strings.HasPrefix(code, "POLICY_")
+}
+
+// violatesPolicy returns true if the app breaks the policy
+func (info *AppBuildpackInfo) violatesPolicy() bool {
+	for _, r := range info.Reasons {
+		if isPolicyReason(r.Code) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns a reason for each way info breaks the policy
+func (p *policy) check(info *AppBuildpackInfo) []*reason {
+	if info.Lifecycle == lifecycleDocker {
+		return nil
+	}
+
+	var reasons []*reason
+	for _, name := range info.BuildpackNames {
+		if len(p.AllowedBuildpacks) != 0 && !stringList(p.AllowedBuildpacks).contains(name) {
+			reasons = append(reasons, newReason(reasonPolicyNotAllowed, "%s is not an allowed buildpack", name))
+		}
+		for _, prefix := range p.BannedBuildpackURLs {
+			if strings.HasPrefix(name, prefix) {
+				reasons = append(reasons, newReason(reasonPolicyBannedURL, "%s is a banned buildpack URL", name))
+				break
+			}
+		}
+	}
+	for _, bp := range info.staged {
+		min, found := p.MinimumVersions[bp.name]
+		if found && compareVersions(bp.version, min) < 0 {
+			reasons = append(reasons, newReason(reasonPolicyVersionTooOld, "staged with %s v%s, policy requires at least v%s", bp.name, bp.version, min))
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,23 @@
+package report
+
+import "testing"
+
+func TestLoadPolicy(t *testing.T) {
+	path := writeFile(t, "policy.json", `{
+  "allowed_buildpacks": ["java_buildpack"],
+  "minimum_versions": {"java_buildpack": "4.30"}
+}`)
+	p, err := loadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.AllowedBuildpacks) != 1 || p.MinimumVersions["java_buildpack"] != "4.30" {
+		t.Errorf("got %+v", p)
+	}
+
+	// a misspelt field would otherwise silently allow everything
+	path = writeFile(t, "policy.json", `{"allowed_buildpack": ["java_buildpack"]}`)
+	if _, err := loadPolicy(path); err == nil {
+		t.Error("got no error for an unknown field")
+	}
+}
@@ -0,0 +1,146 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// promWriter writes metrics in the Prometheus text exposition format, as read
+// by node_exporter's textfile collector
+type promWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func newPromWriter(out io.Writer) *promWriter {
+	return &promWriter{w: bufio.NewWriter(out)}
+}
+
+// header writes the HELP and TYPE lines for a gauge
+func (pw *promWriter) header(name, help string) {
+	pw.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// sample writes a value for name, with labels given as name, value pairs
+func (pw *promWriter) sample(name string, value int64, labels ...string) {
+	var ls []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		ls = append(ls, fmt.Sprintf("%s=\"%s\"", labels[i], promEscaper.Replace(labels[i+1])))
+	}
+	if len(ls) == 0 {
+		pw.printf("%s %d\n", name, value)
+	} else {
+		pw.printf("%s{%s} %d\n", name, strings.Join(ls, ","), value)
+	}
+}
+
+func (pw *promWriter) printf(format string, a ...interface{}) {
+	if pw.err == nil {
+		_, pw.err = fmt.Fprintf(pw.w, format, a...)
+	}
+}
+
+// Flush writes any buffered output, and returns the first error encountered
+func (pw *promWriter) Flush() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	return pw.w.Flush()
+}
+
+// promEscaper escapes label values
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func boolGauge(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// appLabels returns the labels identifying the app, followed by extra
+func appLabels(info *AppBuildpackInfo, extra ...string) []string {
+	var rv []string
+	if info.Foundation != "" {
+		rv = append(rv, "foundation", info.Foundation)
+	}
+	rv = append(rv, "org", info.Organization, "space", info.Space, "app", info.Application)
+	return append(rv, extra...)
+}
+
+// renderPrometheus writes per app and per buildpack metrics for allInfo to out
+func renderPrometheus(out io.Writer, allInfo []*AppBuildpackInfo) error {
+	pw := newPromWriter(out)
+
+	pw.header("cf_app_buildpack_outdated", "1 if the app was staged with an outdated version of the buildpack")
+	for _, info := range allInfo {
+		for _, name := range info.BuildpackNames {
+			pw.sample("cf_app_buildpack_outdated", boolGauge(info.needsRestage()),
+				appLabels(info, "buildpack", name)...)
+		}
+	}
+
+	pw.header("cf_app_needs_attention", "1 if any problems were found with the app")
+	for _, info := range allInfo {
+		pw.sample("cf_app_needs_attention", boolGauge(info.needsAttention()),
+			appLabels(info)...)
+	}
+
+	pw.header("cf_app_staleness_days", "days the app's droplet predates the most recent update of its buildpacks")
+	for _, info := range allInfo {
+		pw.sample("cf_app_staleness_days", int64(info.StalenessDays),
+			appLabels(info)...)
+	}
+
+	pw.header("cf_app_memory_mb", "memory of all instances of the app in MB")
+	for _, info := range allInfo {
+		pw.sample("cf_app_memory_mb", info.memory(),
+			appLabels(info)...)
+	}
+
+	summaries := summarizeUsageInfo(allInfo)
+
+	pw.header("cf_buildpack_apps", "number of apps using the buildpack")
+	for _, s := range summaries {
+		pw.sample("cf_buildpack_apps", int64(s.Apps), "buildpack", s.Buildpack)
+	}
+
+	pw.header("cf_buildpack_apps_needing_attention", "number of apps using the buildpack that need attention")
+	for _, s := range summaries {
+		pw.sample("cf_buildpack_apps_needing_attention", int64(s.NeedsAttention), "buildpack", s.Buildpack)
+	}
+
+	pw.header("cf_buildpack_memory_mb", "memory of all apps using the buildpack in MB")
+	for _, s := range summaries {
+		pw.sample("cf_buildpack_memory_mb", s.TotalMemory, "buildpack", s.Buildpack)
+	}
+
+	return pw.Flush()
+}
+
+// renderStackPrometheus writes per app and per stack metrics for allInfo to out
+func renderStackPrometheus(out io.Writer, allInfo []*stackUsageInfo, opts *Options) error {
+	pw := newPromWriter(out)
+
+	pw.header("cf_app_stack_deprecated", "1 if the app runs on a deprecated stack")
+	for _, info := range allInfo {
+		pw.sample("cf_app_stack_deprecated", boolGauge(len(info.Reasons) != 0),
+			"org", info.Organization, "space", info.Space, "app", info.Application, "stack", info.Stack)
+	}
+
+	summaries := summarizeStackUsageInfo(allInfo, opts)
+
+	pw.header("cf_stack_apps", "number of apps running on the stack")
+	for _, s := range summaries {
+		pw.sample("cf_stack_apps", int64(s.Apps), "stack", s.Stack)
+	}
+
+	pw.header("cf_stack_memory_mb", "memory of all apps running on the stack in MB")
+	for _, s := range summaries {
+		pw.sample("cf_stack_memory_mb", s.TotalMemory, "stack", s.Stack)
+	}
+
+	return pw.Flush()
+}
@@ -0,0 +1,195 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// quotaUsageInfo compares the quota of an org, or of a space if Space is
+// set, with the memory and instances of its started apps
+type quotaUsageInfo struct {
+	Organization string `json:"organization"`
+	Space        string `json:"space,omitempty"`
+
+	// Quota - name of the quota, empty for spaces without one
+	Quota string `json:"quota,omitempty"`
+
+	// MemoryUsed and MemoryLimit - in MB. A nil limit is unlimited.
+	MemoryUsed  int64  `json:"memory_used"`
+	MemoryLimit *int64 `json:"memory_limit,omitempty"`
+
+	Instances     int64  `json:"instances"`
+	InstanceLimit *int64 `json:"instance_limit,omitempty"`
+}
+
+// setQuota sets the name and limits of info's quota to q, if it has one
+func (info *quotaUsageInfo) setQuota(q *Quota) {
+	if q == nil {
+		return
+	}
+	info.Quota = q.Name
+	info.MemoryLimit = q.MemoryLimit
+	info.InstanceLimit = q.InstanceLimit
+}
+
+// reportQuotas compares the quota of every org and space selected by opts
+// with the apps started in it, renders them to out and returns the rows
+// reported on. With -space, orgs' usage is of the spaces reported on.
+func (c *reportBuildpacks) reportQuotas(client *simpleClient, fd Client, out io.Writer, opts *Options) ([]*quotaUsageInfo, error) {
+	allInfo, err := collectQuotaUsageInfo(client, fd, opts)
+	if err == ErrInterrupted {
+		opts.Partial = partialNote
+	} else if err != nil {
+		return nil, err
+	}
+
+	sortQuotaUsageInfo(allInfo, opts)
+
+	rerr := renderQuotaUsageInfo(out, allInfo, opts)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return allInfo, err
+}
+
+// collectQuotaUsageInfo returns a row for each org and space selected by
+// opts. If client.Context is done before all spaces are listed it returns
+// the spaces listed so far, and their orgs, and ErrInterrupted.
+func collectQuotaUsageInfo(client *simpleClient, fd Client, opts *Options) ([]*quotaUsageInfo, error) {
+	defer client.phase("quotas")()
+
+	spaces, err := walkSpaces(client, fd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	spaceInfo := make([]*quotaUsageInfo, len(spaces))
+	err = client.Parallel(len(spaces), func(i int) (err error) {
+		span := client.Tracer.start("space", spaces[i].attributes()...)
+		defer func() { span.finish(err) }()
+
+		info := &quotaUsageInfo{Organization: spaces[i].org.Entity.Name, Space: spaces[i].space.Entity.Name}
+		err = fd.Apps(spaces[i].space, func(app *Resource) error {
+			if app.Entity.State == appStateStarted {
+				info.MemoryUsed += app.totalMemory()
+				info.Instances += app.totalInstances()
+			}
+			return nil
+		})
+		if isPermissionDenied(err) {
+			client.skipInaccessible("space", spaces[i].space, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		q, err := fd.SpaceQuota(spaces[i].space)
+		if err != nil {
+			return err
+		}
+		info.setQuota(q)
+		spaceInfo[i] = info
+		return nil
+	})
+	// if interrupted, the spaces listed so far are still returned
+	err = interruptedOr(client, err)
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	// each org's usage is the total of its spaces
+	var orgs []*Resource
+	orgInfo := make(map[*Resource]*quotaUsageInfo)
+	for i, info := range spaceInfo {
+		if info == nil {
+			continue
+		}
+		org := spaces[i].org
+		oi, found := orgInfo[org]
+		if !found {
+			oi = &quotaUsageInfo{Organization: org.Entity.Name}
+			orgInfo[org] = oi
+			orgs = append(orgs, org)
+		}
+		oi.MemoryUsed += info.MemoryUsed
+		oi.Instances += info.Instances
+	}
+	qerr := client.Parallel(len(orgs), func(i int) error {
+		q, err := fd.OrgQuota(orgs[i])
+		if err != nil {
+			return err
+		}
+		orgInfo[orgs[i]].setQuota(q)
+		return nil
+	})
+	qerr = interruptedOr(client, qerr)
+	if qerr != nil && qerr != ErrInterrupted {
+		return nil, qerr
+	}
+	if qerr != nil {
+		err = qerr
+	}
+
+	var allInfo []*quotaUsageInfo
+	for _, org := range orgs {
+		allInfo = append(allInfo, orgInfo[org])
+	}
+	for _, info := range spaceInfo {
+		if info != nil {
+			allInfo = append(allInfo, info)
+		}
+	}
+	return allInfo, err
+}
+
+// formatLimit formats a quota limit, which is unlimited if nil
+func formatLimit(limit *int64, format func(int64) string) string {
+	if limit == nil {
+		return "unlimited"
+	}
+	return format(*limit)
+}
+
+// percentUsed formats used as a percentage of limit, or returns "" if there
+// is no limit
+func percentUsed(used int64, limit *int64) string {
+	if limit == nil || *limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d%%", used*100 / *limit)
+}
+
+// renderQuotaUsageInfo writes allInfo to out in the format selected by opts
+func renderQuotaUsageInfo(out io.Writer, allInfo []*quotaUsageInfo, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, allInfo, opts)
+	}
+
+	memory := func(mb int64) string {
+		return formatMemory(mb, opts.MemoryUnit)
+	}
+	count := func(n int64) string {
+		return strconv.FormatInt(n, 10)
+	}
+	var rows [][]string
+	for _, info := range allInfo {
+		memoryLimit, instanceLimit := "", ""
+		if info.Quota != "" {
+			memoryLimit = formatLimit(info.MemoryLimit, memory)
+			instanceLimit = formatLimit(info.InstanceLimit, count)
+		}
+		rows = append(rows, []string{
+			info.Organization,
+			info.Space,
+			info.Quota,
+			memory(info.MemoryUsed),
+			memoryLimit,
+			percentUsed(info.MemoryUsed, info.MemoryLimit),
+			count(info.Instances),
+			instanceLimit,
+		})
+	}
+	return renderRows(out, []string{"Organization", "Space", "Quota", memoryHeader("Memory Used", opts.MemoryUnit), memoryHeader("Memory Limit", opts.MemoryUnit), "Memory Used %", "Instances", "Instance Limit"}, rows, opts)
+}
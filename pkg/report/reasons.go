@@ -0,0 +1,121 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reason codes are stable identifiers for why an app needs attention,
+// intended for machine consumption of the report
+const (
+	// the app has no current droplet, or it could not be retrieved
+	reasonDropletMissing = "DROPLET_MISSING"
+
+	// the current droplet does not record which buildpacks staged it
+	reasonNoBuildpackRecorded = "NO_BUILDPACK_RECORDED"
+
+	// a buildpack used to stage the droplet did not report its version
+	reasonVersionUnknown = "VERSION_UNKNOWN"
+
+	// a buildpack used to stage the droplet is not installed for the app's stack
+	reasonBuildpackNotInstalled = "BUILDPACK_NOT_INSTALLED"
+
+	// a buildpack used to stage the droplet is installed, but disabled
+	reasonBuildpackDisabled = "BUILDPACK_DISABLED"
+
+	// a buildpack used to stage the droplet is no longer installed for any stack
+	reasonBuildpackDeleted = "BUILDPACK_DELETED"
+
+	// a buildpack used to stage the droplet is a different version to the one installed
+	reasonOutdatedVersion = "OUTDATED_VERSION"
+
+	// the droplet was staged before an installed buildpack it uses was last updated
+	reasonRestageRequired = "RESTAGE_REQUIRED"
+
+	// the app uses a buildpack given by URL, which bypasses admin buildpacks
+	reasonCustomBuildpack = "CUSTOM_BUILDPACK"
+
+	// the droplet was staged longer ago than -max-droplet-age
+	reasonDropletTooOld = "DROPLET_TOO_OLD"
+
+	// a buildpack used to stage the droplet is behind its latest release on GitHub
+	reasonBehindLatestRelease = "BEHIND_LATEST_RELEASE"
+
+	// a buildpack used to stage the droplet is behind its latest offline
+	// release on Tanzu Network
+	reasonBehindPivnetRelease = "BEHIND_TANZU_NETWORK_RELEASE"
+
+	// a buildpack used to stage the droplet has a known vulnerability
+	reasonVulnerable = "VULNERABLE"
+
+	// the app uses a buildpack the policy does not allow
+	reasonPolicyNotAllowed = "POLICY_BUILDPACK_NOT_ALLOWED"
+
+	// the app was staged with a version older than the policy's minimum
+	reasonPolicyVersionTooOld = "POLICY_VERSION_TOO_OLD"
+
+	// the app uses a custom buildpack URL the policy bans
+	reasonPolicyBannedURL = "POLICY_BANNED_URL"
+
+	// the app runs on a stack that is deprecated or end of life
+	reasonStackDeprecated = "STACK_DEPRECATED"
+
+	// the app's space is assigned to an isolation segment, or falls back to
+	// one, that its org is not entitled to
+	reasonIsolationSegmentNotEntitled = "ISOLATION_SEGMENT_NOT_ENTITLED"
+
+	// the app doesn't request any buildpacks, so relies on detection, and
+	// -flag-autodetect is set
+	reasonAutoDetected = "AUTO_DETECTED"
+
+	// the app has an active deployment or a build staging, so its current
+	// droplet is about to be replaced and isn't checked
+	reasonDeploymentInProgress = "DEPLOYMENT_IN_PROGRESS"
+)
+
+// dropletReasons are the codes found by checking the current droplet against
+// the installed buildpacks, which don't apply if the droplet is about to be
+// replaced by a deployment or build in progress
+var dropletReasons = stringList{
+	reasonDropletMissing,
+	reasonNoBuildpackRecorded,
+	reasonVersionUnknown,
+	reasonBuildpackNotInstalled,
+	reasonBuildpackDisabled,
+	reasonBuildpackDeleted,
+	reasonOutdatedVersion,
+	reasonRestageRequired,
+	reasonDropletTooOld,
+}
+
+// reason explains why an app needs attention
+type reason struct {
+	// Code - one of the reason* constants
+	Code string `json:"code"`
+
+	// Description - human readable explanation, specific to the app
+	Description string `json:"description"`
+}
+
+func newReason(code, format string, a ...interface{}) *reason {
+	return &reason{
+		Code:        code,
+		Description: fmt.Sprintf(format, a...),
+	}
+}
+
+func (r *reason) String() string {
+	return fmt.Sprintf("%s: %s", r.Code, r.Description)
+}
+
+// reasonsMessage joins reasons into a single message, or "OK" if there are none
+func reasonsMessage(reasons []*reason) string {
+	if len(reasons) == 0 {
+		return "OK"
+	}
+	var rv []string
+	for _, r := range reasons {
+		rv = append(rv, r.String())
+	}
+	return strings.Join(rv, "; ")
+}
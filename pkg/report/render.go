@@ -0,0 +1,230 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Render writes allInfo to out in the format selected by opts
+func Render(out io.Writer, allInfo []*AppBuildpackInfo, opts *Options) error {
+	if opts.OutputPrometheus {
+		// metrics include per buildpack totals, so -summary makes no difference
+		err := renderPrometheus(out, allInfo)
+		if err != nil {
+			return err
+		}
+		return renderPartialComment(out, opts)
+	}
+
+	if opts.OutputTemplate != nil {
+		// the template is given both the rows and the summary, so -summary
+		// and -group-by make no difference
+		return renderTemplate(out, allInfo, opts)
+	}
+
+	if opts.OutputCycloneDX {
+		// the BOM lists every app, so -summary and -group-by make no difference
+		return renderCycloneDX(out, allInfo, opts)
+	}
+
+	if opts.OutputSARIF {
+		return renderSARIF(out, allInfo, opts)
+	}
+
+	if opts.Summary || opts.GroupBy == "buildpack" {
+		return renderSummary(out, summarizeUsageInfo(allInfo), opts)
+	}
+
+	if opts.GroupBy != "" {
+		return renderGroups(out, groupUsageInfo(allInfo, opts.GroupBy), opts.GroupBy, hasFoundation(allInfo), opts)
+	}
+
+	if opts.OutputJSON {
+		return renderJSON(out, allInfo, opts)
+	}
+
+	foundations := hasFoundation(allInfo)
+	var rows [][]string
+	for _, row := range allInfo {
+		var r []string
+		if foundations {
+			r = append(r, row.Foundation)
+		}
+		r = append(r,
+			row.Organization,
+			row.Space,
+			row.Application,
+			row.State,
+			row.Stack,
+			row.buildpackList(),
+			customBuildpacksMessage(row.CustomBuildpacks),
+			row.DockerImage,
+			formatMemory(row.memory(), opts.MemoryUnit),
+			row.lastStaged(),
+			row.messages(),
+		)
+		if opts.MemoryBreakdown {
+			r = append(r, row.processMemory(opts.MemoryUnit))
+		}
+		if opts.Advisories != nil {
+			r = append(r, strings.Join(row.Vulnerabilities, ", "))
+		}
+		if opts.IncludeContacts {
+			r = append(r, strings.Join(row.Contacts, ", "))
+		}
+		if opts.IncludeRoutes {
+			r = append(r, strings.Join(row.Routes, ", "))
+		}
+		if opts.IncludeServices {
+			r = append(r, strings.Join(row.Services, ", "))
+		}
+		if opts.IncludeRevisions {
+			r = append(r, row.revisions())
+		}
+		if opts.IncludeEvents {
+			r = append(r, row.lastEvent())
+		}
+		for _, key := range opts.MetadataColumns {
+			r = append(r, row.Metadata[key])
+		}
+		if opts.IncludeTasks {
+			r = append(r, row.tasks(opts.MemoryUnit))
+		}
+		if opts.IncludeSidecars {
+			r = append(r, row.sidecars(opts.MemoryUnit))
+		}
+		if opts.IncludeHealth {
+			healthCheck, running, crashed := "", "", ""
+			if row.Health != nil {
+				healthCheck = row.Health.HealthCheckType
+				running = strconv.Itoa(row.Health.Running)
+				crashed = strconv.Itoa(row.Health.Crashed)
+			}
+			r = append(r, healthCheck, running, crashed)
+		}
+		rows = append(rows, r)
+	}
+	var header []string
+	if foundations {
+		header = append(header, "Foundation")
+	}
+	header = append(header, "Organization", "Space", "Application", "App State", "Stack", "Buildpacks", "Custom Buildpack", "Docker Image", memoryHeader("Total Memory", opts.MemoryUnit), "Last Staged", "Messages")
+	if opts.MemoryBreakdown {
+		header = append(header, memoryHeader("Memory By Process", opts.MemoryUnit))
+	}
+	if opts.Advisories != nil {
+		header = append(header, "Vulnerabilities")
+	}
+	if opts.IncludeContacts {
+		header = append(header, "Contacts")
+	}
+	if opts.IncludeRoutes {
+		header = append(header, "Routes")
+	}
+	if opts.IncludeServices {
+		header = append(header, "Services")
+	}
+	if opts.IncludeRevisions {
+		header = append(header, "Revisions")
+	}
+	if opts.IncludeEvents {
+		header = append(header, "Last Event")
+	}
+	header = append(header, opts.MetadataColumns...)
+	if opts.IncludeTasks {
+		header = append(header, "Recent Tasks")
+	}
+	if opts.IncludeSidecars {
+		header = append(header, "Sidecars")
+	}
+	if opts.IncludeHealth {
+		header = append(header, "Health Check", "Running", "Crashed")
+	}
+
+	if opts.OutputHTML {
+		return renderHTML(out, header, rows, summaryCharts(summarizeUsageInfo(allInfo)), opts.Partial)
+	}
+
+	err := renderRows(out, header, rows, opts)
+	if err != nil || opts.OutputCSV || len(allInfo) == 0 {
+		return err
+	}
+	return renderTotals(out, allInfo, opts)
+}
+
+// jsonSchemaVersion is the version of the JSON output's format. It is
+// incremented by changes that could break parsers, eg removing a field or
+// changing its type, but not by adding fields.
+const jsonSchemaVersion = 1
+
+// jsonReport wraps the rows of JSON output, so that parsers can detect
+// breaking changes to it
+type jsonReport struct {
+	SchemaVersion int         `json:"schema_version"`
+	GeneratedAt   time.Time   `json:"generated_at"`
+	API           string      `json:"api,omitempty"`
+	Partial       string      `json:"partial,omitempty"`
+	Rows          interface{} `json:"rows"`
+}
+
+// renderJSON writes rows to out as JSON, wrapped in a jsonReport
+func renderJSON(out io.Writer, rows interface{}, opts *Options) error {
+	enc := json.NewEncoder(out)
+	if opts.JSONIndent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(&jsonReport{
+		SchemaVersion: jsonSchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		API:           opts.API,
+		Partial:       opts.Partial,
+		Rows:          rows,
+	})
+}
+
+// renderRows writes header and rows to out, as CSV or HTML if selected by
+// opts, otherwise as a table
+func renderRows(out io.Writer, header []string, rows [][]string, opts *Options) error {
+	if opts.OutputHTML {
+		return renderHTML(out, header, rows, nil, opts.Partial)
+	}
+
+	if opts.OutputCSV {
+		w := csv.NewWriter(out)
+		err := w.Write(header)
+		if err != nil {
+			return err
+		}
+		err = w.WriteAll(rows)
+		if err != nil {
+			return err
+		}
+		return w.Error()
+	}
+
+	table := tablewriter.NewWriter(out)
+	table.SetHeader(header)
+	table.AppendBulk(rows)
+	if opts.Partial != "" {
+		table.SetCaption(true, opts.Partial)
+	}
+	table.Render()
+
+	return nil
+}
+
+// renderPartialComment notes in Prometheus output that the report is partial
+func renderPartialComment(out io.Writer, opts *Options) error {
+	if opts.Partial == "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(out, "# %s\n", opts.Partial)
+	return err
+}
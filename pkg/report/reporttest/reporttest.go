@@ -0,0 +1,255 @@
+// Package reporttest provides a fake CloudController API, so that code built
+// on package report can be tested without a foundation.
+package reporttest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Foundation is the content of a small foundation, by request URI, for use
+// as the responses of NewServer. It has one org and space, containing a
+// started app staged with java_buildpack 4.0 when 4.1 is installed, and a
+// stopped app with no droplet.
+var Foundation = map[string]string{
+	"/": `{"links":{"cloud_controller_v2":{"href":"SERVER/v2"},"uaa":{"href":"SERVER/uaa"}}}`,
+
+	"/uaa/oauth/token": `{"access_token":"fake","token_type":"bearer"}`,
+
+	"/v2/buildpacks": `{"resources":[{"metadata":{"guid":"bp1","updated_at":"2020-01-01T00:00:00Z"},"entity":{"name":"java_buildpack","filename":"java-buildpack-v4.1.zip","enabled":true,"stack":"cflinuxfs4","position":1}}]}`,
+
+	"/v2/stacks": `{"resources":[{"metadata":{"guid":"st1"},"entity":{"name":"cflinuxfs4"}}]}`,
+
+	"/v2/organizations": `{"resources":[{"metadata":{"guid":"o1"},"entity":{"name":"org1","spaces_url":"/v2/organizations/o1/spaces"}}]}`,
+
+	"/v2/organizations/o1/spaces": `{"resources":[{"metadata":{"guid":"s1"},"entity":{"name":"space1","apps_url":"/v2/spaces/s1/apps","developers_url":"/v2/spaces/s1/developers","managers_url":"/v2/spaces/s1/managers"}}]}`,
+
+	"/v2/spaces/s1/apps": `{"resources":[{"metadata":{"guid":"a1"},"entity":{"name":"app1","memory":1024,"instances":2,"stack_guid":"st1","state":"STARTED"}},{"metadata":{"guid":"a2"},"entity":{"name":"app2","memory":512,"instances":1,"stack_guid":"st1","state":"STOPPED"}}]}`,
+
+	"/v2/spaces/s1/developers": `{"resources":[{"entity":{"username":"dev@example.com"}}]}`,
+
+	"/v2/spaces/s1/managers": `{"resources":[{"entity":{"username":"mgr@example.com"}}]}`,
+
+	"/v2/apps?inline-relations-depth=2&include-relations=space,organization": `{"resources":[{"metadata":{"guid":"a1"},"entity":{"name":"app1","memory":1024,"instances":2,"stack_guid":"st1","state":"STARTED","space":{"metadata":{"guid":"s1"},"entity":{"name":"space1","apps_url":"/v2/spaces/s1/apps","developers_url":"/v2/spaces/s1/developers","managers_url":"/v2/spaces/s1/managers","organization":{"metadata":{"guid":"o1"},"entity":{"name":"org1","spaces_url":"/v2/organizations/o1/spaces"}}}}}},{"metadata":{"guid":"a2"},"entity":{"name":"app2","memory":512,"instances":1,"stack_guid":"st1","state":"STOPPED","space":{"metadata":{"guid":"s1"},"entity":{"name":"space1","apps_url":"/v2/spaces/s1/apps","developers_url":"/v2/spaces/s1/developers","managers_url":"/v2/spaces/s1/managers","organization":{"metadata":{"guid":"o1"},"entity":{"name":"org1","spaces_url":"/v2/organizations/o1/spaces"}}}}}}]}`,
+
+	"/v3/apps?include=space.organization": `{"pagination":{},"resources":[{"guid":"a1","name":"app1","state":"STARTED","lifecycle":{"type":"buildpack","data":{"buildpacks":[],"stack":"cflinuxfs4"}},"relationships":{"space":{"data":{"guid":"s1"}},"current_droplet":{"data":{"guid":"d1"}}}},{"guid":"a2","name":"app2","state":"STOPPED","lifecycle":{"type":"buildpack","data":{"buildpacks":[],"stack":"cflinuxfs4"}},"relationships":{"space":{"data":{"guid":"s1"}}}}],"included":{"spaces":[{"guid":"s1","name":"space1","relationships":{"organization":{"data":{"guid":"o1"}}}}],"organizations":[{"guid":"o1","name":"org1"}]}}`,
+
+	"/v3/processes": `{"pagination":{},"resources":[{"type":"web","instances":2,"memory_in_mb":1024,"relationships":{"app":{"data":{"guid":"a1"}}}},{"type":"web","instances":1,"memory_in_mb":512,"relationships":{"app":{"data":{"guid":"a2"}}}}]}`,
+
+	"/v3/processes?space_guids=s1": `{"pagination":{},"resources":[{"type":"web","instances":2,"memory_in_mb":1024,"relationships":{"app":{"data":{"guid":"a1"}}}},{"type":"web","instances":1,"memory_in_mb":512,"relationships":{"app":{"data":{"guid":"a2"}}}}]}`,
+
+	"/v3/droplets?states=STAGED&app_guids=a1": `{"pagination":{},"resources":[{"guid":"d0","created_at":"2020-06-01T00:00:00Z","stack":"cflinuxfs4","buildpacks":[{"name":"java_buildpack","buildpack_name":"java","version":"3.9"}],"relationships":{"app":{"data":{"guid":"a1"}}}},{"guid":"d1","created_at":"2021-01-01T00:00:00Z","stack":"cflinuxfs4","buildpacks":[{"name":"java_buildpack","buildpack_name":"java","version":"4.0"}],"relationships":{"app":{"data":{"guid":"a1"}}}}]}`,
+
+	"/v3/apps/a1/droplets/current": `{"guid":"d1","created_at":"2021-01-01T00:00:00Z","stack":"cflinuxfs4","buildpacks":[{"name":"java_buildpack","buildpack_name":"java","version":"4.0"}]}`,
+
+	"/v3/deployments?status_values=ACTIVE&app_guids=a1": `{"pagination":{},"resources":[]}`,
+
+	"/v3/deployments?status_values=ACTIVE&app_guids=a2": `{"pagination":{},"resources":[]}`,
+
+	"/v3/builds?states=STAGING&app_guids=a1": `{"pagination":{},"resources":[]}`,
+
+	"/v3/builds?states=STAGING&app_guids=a2": `{"pagination":{},"resources":[]}`,
+}
+
+// Server is a fake CloudController API, which serves canned JSON responses
+// by request URI, 400 for query parameters the API doesn't accept, and 404
+// for anything else. Requests match a response if
+// they have the same path and query parameters, in any order and however
+// escaped, ignoring the page size. "SERVER" in a response is replaced with
+// the server's URL, for links to other resources.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]string
+	failures  map[string][]int
+	requests  []string
+	unhandled []string
+}
+
+// NewServer starts a fake API serving responses, eg Foundation. Close it
+// when done.
+func NewServer(responses map[string]string) *Server {
+	s := &Server{responses: make(map[string]string), failures: make(map[string][]int)}
+	for uri, body := range responses {
+		s.responses[key(uri)] = body
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Handle sets the response served for uri, or removes it if body is empty
+func (s *Server) Handle(uri, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if body == "" {
+		delete(s.responses, key(uri))
+		return
+	}
+	s.responses[key(uri)] = body
+}
+
+// Fail makes the next times requests for uri fail with status, before its
+// response is served again, eg to test retrying
+func (s *Server) Fail(uri string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.failures[key(uri)] = append(s.failures[key(uri)], status)
+	}
+}
+
+// pageSizeParams set the size of v2 and v3 pages, which clients choose
+// freely, so don't select a different response
+var pageSizeParams = []string{"results-per-page", "per_page"}
+
+// listParams are accepted by every v3 list endpoint
+var listParams = []string{"page", "per_page", "order_by", "label_selector", "created_ats", "updated_ats"}
+
+// queryParams are the other query parameters the real API accepts for the
+// v3 list endpoints used by the report. As with the API, requests with any
+// others are rejected with 400, so that tests fail for requests the API
+// wouldn't accept even if a response is registered for them. Endpoints not
+// listed here accept any query parameters.
+var queryParams = map[string][]string{
+	"/v3/apps":                        {"guids", "names", "space_guids", "organization_guids", "stacks", "lifecycle_type", "include"},
+	"/v3/audit_events":                {"types", "target_guids", "space_guids", "organization_guids"},
+	"/v3/builds":                      {"states", "app_guids", "package_guids"},
+	"/v3/deployments":                 {"app_guids", "states", "status_reasons", "status_values"},
+	"/v3/droplets":                    {"guids", "states", "app_guids", "space_guids", "organization_guids"},
+	"/v3/isolation_segments":          {"guids", "names", "organization_guids"},
+	"/v3/organization_quotas":         {"guids", "names", "organization_guids"},
+	"/v3/organizations":               {"names", "guids"},
+	"/v3/packages":                    {"guids", "states", "types", "app_guids", "space_guids", "organization_guids"},
+	"/v3/processes":                   {"guids", "types", "app_guids", "space_guids", "organization_guids"},
+	"/v3/roles":                       {"guids", "types", "space_guids", "organization_guids", "user_guids", "include"},
+	"/v3/service_credential_bindings": {"names", "service_instance_guids", "service_instance_names", "app_guids", "app_names", "service_plan_guids", "service_plan_names", "service_offering_guids", "service_offering_names", "type", "guids", "include"},
+	"/v3/service_instances":           {"names", "guids", "type", "space_guids", "organization_guids", "service_plan_guids", "service_plan_names", "fields"},
+	"/v3/space_quotas":                {"guids", "names", "organization_guids", "space_guids"},
+	"/v3/spaces":                      {"names", "guids", "organization_guids", "include"},
+}
+
+// unknownParams returns the query parameters of uri that the API doesn't
+// accept, see queryParams
+func unknownParams(uri string) []string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil
+	}
+	accepted, found := queryParams[u.Path]
+	if !found {
+		return nil
+	}
+	var rv []string
+	for p := range u.Query() {
+		if !contains(accepted, p) && !contains(listParams, p) {
+			rv = append(rv, p)
+		}
+	}
+	sort.Strings(rv)
+	return rv
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns uri in a canonical form, with its query parameters sorted and
+// escaped the same way, so that responses don't depend on how a request
+// happens to build its URI
+func key(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	for _, p := range pageSizeParams {
+		q.Del(p)
+	}
+	if len(q) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + q.Encode()
+}
+
+// Requests returns the requests made so far, as "METHOD URI"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Unhandled returns the requests made so far that had no response, and so
+// were served 404, or that the API would have rejected
+func (s *Server) Unhandled() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.unhandled...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	k := key(r.URL.RequestURI())
+	body, found := s.responses[k]
+	unknown := unknownParams(r.URL.RequestURI())
+	if !found || len(unknown) != 0 {
+		s.unhandled = append(s.unhandled, r.Method+" "+r.URL.RequestURI())
+	}
+	status := 0
+	if failures := s.failures[k]; len(failures) > 0 {
+		status, s.failures[k] = failures[0], failures[1:]
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(unknown) != 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"errors":[{"code":10005,"title":"CF-BadQueryParameter","detail":"The query parameter is invalid: Unknown query parameter(s): '%s'"}]}`, strings.Join(unknown, "', '"))
+		return
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"errors":[{"code":10001,"title":"CF-Fake","detail":"%s"}]}`, http.StatusText(status))
+		return
+	}
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"errors":[{"code":10010,"title":"CF-ResourceNotFound","detail":"%s not found"}]}`, r.URL.Path)
+		return
+	}
+	fmt.Fprint(w, strings.Replace(body, "SERVER", s.URL, -1))
+}
+
+// Connection returns a connection to the server, for report.NewClient and
+// report.Run, that is always logged in
+func (s *Server) Connection() *Connection {
+	return &Connection{API: s.URL}
+}
+
+// Connection is a report.Connection to a fake API
+type Connection struct {
+	API string
+}
+
+func (c *Connection) AccessToken() (string, error) {
+	return "bearer fake", nil
+}
+
+func (c *Connection) ApiEndpoint() (string, error) {
+	return c.API, nil
+}
+
+func (c *Connection) IsSSLDisabled() (bool, error) {
+	return false, nil
+}
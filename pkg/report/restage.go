@@ -0,0 +1,209 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// restageOptions controls restaging of apps after the report is rendered
+type restageOptions struct {
+	// Restage - if set, apps with outdated droplets are restaged
+	Restage bool
+
+	// DryRun - if set, print which apps would be restaged, but don't restage them
+	DryRun bool
+
+	// Yes - if set, don't prompt for confirmation before restaging
+	Yes bool
+
+	// MaxParallel - maximum number of apps to restage at once
+	MaxParallel int
+
+	// PerSpace - maximum number of apps to restage at once within a single space
+	PerSpace int
+}
+
+// restageReasons are the reason codes that cause an app to be restaged
+var restageReasons = []string{reasonOutdatedVersion, reasonRestageRequired}
+
+// needsRestage returns true if restaging the app would pick up newer buildpacks
+func (info *AppBuildpackInfo) needsRestage() bool {
+	for _, r := range info.Reasons {
+		for _, code := range restageReasons {
+			if r.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restageApps restages those apps in allInfo with outdated droplets. Unless
+// ropts.Yes is set, confirmation is read from in after listing the apps to prompt.
+func restageApps(fd Client, allInfo []*AppBuildpackInfo, ropts *restageOptions, in io.Reader, prompt io.Writer) error {
+	var toRestage []*AppBuildpackInfo
+	for _, info := range allInfo {
+		if info.needsRestage() {
+			toRestage = append(toRestage, info)
+		}
+	}
+	if len(toRestage) == 0 {
+		log.Println("no apps need restaging")
+		return nil
+	}
+
+	for _, info := range toRestage {
+		fmt.Fprintf(prompt, "%s/%s/%s\n", info.Organization, info.Space, info.Application)
+	}
+	if ropts.DryRun {
+		fmt.Fprintf(prompt, "dry run: would restage %d apps\n", len(toRestage))
+		return nil
+	}
+
+	if !ropts.Yes {
+		fmt.Fprintf(prompt, "Restage %d apps? [y/N] ", len(toRestage))
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return fmt.Errorf("restage cancelled")
+		}
+	}
+
+	// limit restages per space, so that a single space is not left with
+	// all of its apps staging at once
+	var mu sync.Mutex
+	spaceSlots := make(map[string]chan struct{})
+	slot := func(info *AppBuildpackInfo) chan struct{} {
+		mu.Lock()
+		defer mu.Unlock()
+		key := info.Organization + "/" + info.Space
+		c, found := spaceSlots[key]
+		if !found {
+			perSpace := ropts.PerSpace
+			if perSpace < 1 {
+				perSpace = 1
+			}
+			c = make(chan struct{}, perSpace)
+			spaceSlots[key] = c
+		}
+		return c
+	}
+
+	failed := 0
+	err := parallel(ropts.MaxParallel, len(toRestage), func(i int) error {
+		info := toRestage[i]
+		c := slot(info)
+		c <- struct{}{}
+		defer func() { <-c }()
+
+		log.Printf("restaging %s/%s/%s", info.Organization, info.Space, info.Application)
+		err := fd.Restage(info.AppGUID)
+		if err != nil {
+			logf(levelError, nil, "failed to restage %s/%s/%s: %s", info.Organization, info.Space, info.Application, err)
+			mu.Lock()
+			failed++
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d apps failed to restage", failed, len(toRestage))
+	}
+	return nil
+}
+
+// restageReason returns the first of restageReasons the app was flagged
+// with, which its commands are grouped under in a restage script
+func (info *AppBuildpackInfo) restageReason() string {
+	for _, code := range restageReasons {
+		for _, r := range info.Reasons {
+			if r.Code == code {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// shellQuote quotes s for a POSIX shell, if it needs quoting
+func shellQuote(s string) string {
+	safe := s != ""
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./@:", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// renderRestageScript writes a shell script to out that restages those apps
+// in allInfo with outdated droplets, grouped by reason and commented with
+// why each app is restaged, for -emit-restage-script
+func renderRestageScript(out io.Writer, allInfo []*AppBuildpackInfo, opts *Options) error {
+	byReason := make(map[string][]*AppBuildpackInfo)
+	for _, info := range allInfo {
+		if code := info.restageReason(); code != "" {
+			byReason[code] = append(byReason[code], info)
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "#!/bin/sh\n# Generated by cf report-buildpacks at %s", time.Now().UTC().Format(time.RFC3339))
+	if opts.API != "" {
+		fmt.Fprintf(w, " for %s", opts.API)
+	}
+	fmt.Fprintln(w)
+	if opts.Partial != "" {
+		fmt.Fprintf(w, "# %s\n", opts.Partial)
+	}
+	fmt.Fprintln(w, "# Review before running, and comment out apps that shouldn't be restaged yet.")
+	fmt.Fprintln(w, "set -e")
+	for _, code := range restageReasons {
+		apps := byReason[code]
+		if len(apps) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n# %s: %d apps\n", code, len(apps))
+		for _, info := range apps {
+			fmt.Fprintln(w)
+			for _, r := range info.Reasons {
+				fmt.Fprintf(w, "# %s: %s\n", r.Code, r.Description)
+			}
+			fmt.Fprintf(w, "cf target -o %s -s %s && cf restage %s\n", shellQuote(info.Organization), shellQuote(info.Space), shellQuote(info.Application))
+		}
+	}
+	return w.Flush()
+}
+
+// writeRestageScript writes the script rendered by renderRestageScript to
+// path, executable so it can be run once reviewed
+func writeRestageScript(path string, allInfo []*AppBuildpackInfo, opts *Options) error {
+	af, err := createAtomicFile(path)
+	if err != nil {
+		return err
+	}
+	err = af.Chmod(0755)
+	if err == nil {
+		err = renderRestageScript(af, allInfo, opts)
+	}
+	if err != nil {
+		af.Abort()
+		return err
+	}
+	return af.Commit()
+}
@@ -0,0 +1,205 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// checkpointInterval is the most often the -resume state file is saved
+const checkpointInterval = 10 * time.Second
+
+// checkpoint records the spaces whose apps have all been checked, along with
+// their rows, so that an interrupted or failed run can be resumed by -resume
+type checkpoint struct {
+	path string
+
+	mu    sync.Mutex
+	state checkpointState
+	saved time.Time
+
+	// pending - number of apps still to be checked in each space
+	pending map[string]int
+
+	// rows - rows for the apps checked so far in each space
+	rows map[string][]*checkpointApp
+}
+
+type checkpointState struct {
+	// Filters - the apps selected by the run, which must match to resume it
+	Filters checkpointFilters `json:"filters"`
+
+	// Spaces - rows for each space that has been completed, by space guid
+	Spaces map[string][]*checkpointApp `json:"spaces"`
+}
+
+// checkpointFilters are the options that select which apps are reported
+type checkpointFilters struct {
+	Orgs           stringList `json:"orgs"`
+	ExcludeOrgs    stringList `json:"exclude_orgs,omitempty"`
+	Spaces         stringList `json:"spaces"`
+	IncludeStopped bool       `json:"include_stopped"`
+	ExcludeDocker  bool       `json:"exclude_docker"`
+	LabelSelector  string     `json:"label_selector,omitempty"`
+	MinMemory      int64      `json:"min_memory,omitempty"`
+	AppFilter      string     `json:"app_filter,omitempty"`
+	ExcludeApp     string     `json:"exclude_app,omitempty"`
+	Anonymize      bool       `json:"anonymize,omitempty"`
+}
+
+func (cf checkpointFilters) String() string {
+	b, _ := json.Marshal(cf)
+	return string(b)
+}
+
+// regexpString returns the source of re, or "" if it is nil
+func regexpString(re *regexp.Regexp) string {
+	if re == nil {
+		return ""
+	}
+	return re.String()
+}
+
+// checkpointApp is a row, with the app guid that isn't otherwise saved
+type checkpointApp struct {
+	AppGuid string            `json:"app_guid"`
+	Info    *AppBuildpackInfo `json:"info"`
+}
+
+// loadCheckpoint reads the state saved by a previous run selecting the same
+// apps as opts from path, or starts a new checkpoint if path doesn't exist
+func loadCheckpoint(path string, opts *Options) (*checkpoint, error) {
+	filters := checkpointFilters{
+		Orgs:           opts.Orgs,
+		ExcludeOrgs:    opts.ExcludeOrgs,
+		Spaces:         opts.Spaces,
+		IncludeStopped: opts.IncludeStopped,
+		ExcludeDocker:  opts.ExcludeDocker,
+		LabelSelector:  opts.LabelSelector.String(),
+		MinMemory:      opts.MinMemory,
+		AppFilter:      regexpString(opts.AppFilter),
+		ExcludeApp:     regexpString(opts.ExcludeApp),
+		Anonymize:      opts.Anonymize,
+	}
+	cp := &checkpoint{
+		path: path,
+		state: checkpointState{
+			Filters: filters,
+			Spaces:  make(map[string][]*checkpointApp),
+		},
+		pending: make(map[string]int),
+		rows:    make(map[string][]*checkpointApp),
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state checkpointState
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return nil, fmt.Errorf("reading resume state %s: %s", path, err)
+	}
+	if state.Filters.String() != filters.String() {
+		return nil, fmt.Errorf("resume state %s was saved by a run selecting different apps: %s", path, state.Filters)
+	}
+	for guid, apps := range state.Spaces {
+		for _, a := range apps {
+			// saved before rows included GUIDs
+			a.Info.AppGUID = a.AppGuid
+		}
+		cp.state.Spaces[guid] = apps
+	}
+	return cp, nil
+}
+
+// done returns true if the space was completed by a previous run
+func (cp *checkpoint) done(spaceGuid string) bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	_, found := cp.state.Spaces[spaceGuid]
+	return found
+}
+
+// resumed returns the rows of the spaces completed by previous runs
+func (cp *checkpoint) resumed() []*AppBuildpackInfo {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	var rv []*AppBuildpackInfo
+	for _, apps := range cp.state.Spaces {
+		for _, a := range apps {
+			rv = append(rv, a.Info)
+		}
+	}
+	return rv
+}
+
+// start records the apps to be checked in each space
+func (cp *checkpoint) start(apps []appInSpace) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for _, a := range apps {
+		cp.pending[a.space.Metadata.Guid]++
+	}
+}
+
+// appDone records the row for an app, completing its space once all the
+// apps in it are done, and saves the state if it hasn't been recently
+func (cp *checkpoint) appDone(spaceGuid string, info *AppBuildpackInfo) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.rows[spaceGuid] = append(cp.rows[spaceGuid], &checkpointApp{AppGuid: info.AppGUID, Info: info})
+	cp.pending[spaceGuid]--
+	if cp.pending[spaceGuid] != 0 {
+		return
+	}
+	cp.state.Spaces[spaceGuid] = cp.rows[spaceGuid]
+	delete(cp.rows, spaceGuid)
+	if time.Since(cp.saved) >= checkpointInterval {
+		err := cp.saveLocked()
+		if err != nil {
+			logf(levelWarn, nil, "saving resume state: %s", err)
+		}
+	}
+}
+
+// Save writes the state to the state file
+func (cp *checkpoint) Save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.saveLocked()
+}
+
+func (cp *checkpoint) saveLocked() error {
+	af, err := createAtomicFile(cp.path)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(af).Encode(&cp.state)
+	if err != nil {
+		af.Abort()
+		return err
+	}
+	err = af.Commit()
+	if err != nil {
+		return err
+	}
+	cp.saved = time.Now()
+	return nil
+}
+
+// Remove deletes the state file, once the run it is for has completed
+func (cp *checkpoint) Remove() error {
+	err := os.Remove(cp.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
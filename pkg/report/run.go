@@ -0,0 +1,1236 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// exitNeedsAttention is the exit status used when -fail-on-attention is set
+// and too many apps need attention
+const exitNeedsAttention = 3
+
+// exitPolicyViolation is the exit status used when -fail-on-policy is set
+// and any app violates the policy
+const exitPolicyViolation = 4
+
+// exitInterrupted is the exit status used when the report is interrupted by
+// Ctrl-C, as is conventional for SIGINT
+const exitInterrupted = 130
+
+// reportBuildpacks runs the commands
+type reportBuildpacks struct {
+	// defineOnly - if set, run only defines the flags of the command, in
+	// flags, rather than running it
+	defineOnly bool
+	flags      *flag.FlagSet
+}
+
+// Options controls which apps are reported on, and how
+type Options struct {
+	// OutputJSON - if set render JSON instead of a table
+	OutputJSON bool
+
+	// JSONIndent - if set, indent JSON output to be read by people
+	JSONIndent bool
+
+	// OutputCSV - if set render CSV instead of a table
+	OutputCSV bool
+
+	// OutputHTML - if set render a standalone HTML page instead of a table
+	OutputHTML bool
+
+	// OutputTemplate - if set render the report through this Go template
+	// instead of a table
+	OutputTemplate *template.Template
+
+	// OutputPrometheus - if set render metrics in the Prometheus text format
+	OutputPrometheus bool
+
+	// OutputCycloneDX - if set render a CycloneDX SBOM, with each app as a
+	// component depending on its buildpacks
+	OutputCycloneDX bool
+
+	// OutputSARIF - if set render a SARIF log with a result for each reason
+	// an app needs attention
+	OutputSARIF bool
+
+	// Stream - if set write each app as a line of JSON as soon as it is processed
+	Stream bool
+
+	// Summary - if set render totals (ie per buildpack or stack) instead of per app
+	Summary bool
+
+	// GroupBy - if set, one of groupByKeys, render totals for each org, space
+	// or buildpack instead of per app
+	GroupBy string
+
+	// Orgs - if set, only orgs with these names are reported on
+	Orgs stringList
+
+	// ExcludeOrgs - orgs that are not reported on, unless named by Orgs
+	ExcludeOrgs stringList
+
+	// Spaces - if set, only spaces with these names are reported on
+	Spaces stringList
+
+	// IncludeStopped - if not set, only started apps are reported on
+	IncludeStopped bool
+
+	// ExcludeDocker - if set, apps using the docker lifecycle are not reported on
+	ExcludeDocker bool
+
+	// MinMemory - if set, only apps reserving at least this many MB across
+	// all their processes are reported on
+	MinMemory int64
+
+	// AppFilter - if set, only apps whose names match are reported on
+	AppFilter *regexp.Regexp
+
+	// ExcludeApp - if set, apps whose names match are not reported on, eg
+	// "-venerable$"
+	ExcludeApp *regexp.Regexp
+
+	// SortBy - one of sortKeys, rows are sorted by org, space and app by default
+	SortBy string
+
+	// SortDesc - if set, sort in descending order
+	SortDesc bool
+
+	// AttentionOnly - if set, apps that are OK are left out of the report
+	AttentionOnly bool
+
+	// LabelSelector - if set, only apps whose labels match are reported
+	LabelSelector labelSelector
+
+	// MetadataColumns - label or annotation keys reported as columns, eg to
+	// route findings to the team that owns the app
+	MetadataColumns stringList
+
+	// Buildpacks - if set, only apps using one of these buildpacks are
+	// reported on
+	Buildpacks stringList
+
+	// SkipInFlight - if set, apps with a deployment or build in progress are
+	// left out of the report
+	SkipInFlight bool
+
+	// Anonymize - if set, org, space and app names, and anything else that
+	// could reveal internal naming, are replaced with stable hashes
+	Anonymize bool
+
+	// FailOnAttention - if set, exit with exitNeedsAttention when more than
+	// AttentionThreshold apps need attention
+	FailOnAttention    bool
+	AttentionThreshold int
+
+	// IncludeContacts - if set, the developers and managers of each app's
+	// space are reported
+	IncludeContacts bool
+
+	// IncludeRoutes - if set, the routes mapped to each app are reported
+	IncludeRoutes bool
+
+	// IncludeServices - if set, the service instances bound to each app are
+	// reported
+	IncludeServices bool
+
+	// IncludeRevisions - if set, the buildpacks each of an app's most recent
+	// revisions was staged with are reported
+	IncludeRevisions bool
+
+	// IncludeEvents - if set, who last pushed, restaged, restarted or started
+	// each app, and when, is reported
+	IncludeEvents bool
+
+	// IncludeTasks - if set, each app's most recent tasks, and the memory
+	// they reserved, are reported
+	IncludeTasks bool
+
+	// IncludeSidecars - if set, each app's sidecars are reported, and their
+	// memory included in its total
+	IncludeSidecars bool
+
+	// IncludeHealth - if set, each app's health check type and running and
+	// crashed instances are reported
+	IncludeHealth bool
+
+	// MemoryUnit - one of memoryUnits, how memory is formatted in tables
+	MemoryUnit string
+
+	// MemoryBreakdown - if set, memory is also reported by type of process
+	MemoryBreakdown bool
+
+	// CheckLatest - if set, buildpacks are also compared with their latest
+	// release on GitHub
+	CheckLatest *latestReleases
+
+	// CheckPivnet - if set, buildpacks are also compared with their latest
+	// release on Tanzu Network
+	CheckPivnet *pivnetReleases
+
+	// Advisories - if set, buildpacks are checked for known vulnerabilities
+	Advisories *advisoryIndex
+
+	// MaxDropletAge - if set, apps with droplets staged longer ago than this
+	// need attention
+	MaxDropletAge time.Duration
+
+	// Policy - if set, apps are checked against it
+	Policy *policy
+
+	// FailOnPolicy - if set, exit with exitPolicyViolation when any app
+	// violates Policy
+	FailOnPolicy bool
+
+	// FlagAutodetect - if set, apps that don't request a buildpack, relying
+	// on detection, are flagged as needing attention
+	FlagAutodetect bool
+
+	// DeprecatedStacks - apps on these stacks are flagged as needing attention,
+	// by report-buildpacks as well as report-stacks
+	DeprecatedStacks stringList
+
+	// Resume - if set, spaces completed by a previous run are not checked
+	// again, and completed spaces are recorded for the next run
+	Resume *checkpoint
+
+	// API - the API the report is of, shown in JSON output. Not set for
+	// -foundations, whose rows each have a foundation instead.
+	API string
+
+	// Partial - set to a note saying so when the report was interrupted
+	// before all apps were collected, and shown with the rendered report
+	Partial string
+}
+
+// Run runs the command in args[0], eg report-buildpacks, with its options,
+// as "cf COMMAND" would, with the API reached through conn
+func Run(conn Connection, args []string) {
+	(&reportBuildpacks{}).run(conn, args)
+}
+
+// run runs the command in args[0], with the API reached through conn
+func (c *reportBuildpacks) run(conn Connection, args []string) {
+	var opts Options
+	var ropts restageOptions
+	var wopts watchOptions
+	eopts := emailOptions{
+		SMTPAddr: os.Getenv("REPORT_SMTP_ADDR"),
+		From:     os.Getenv("REPORT_SMTP_FROM"),
+		Username: os.Getenv("REPORT_SMTP_USERNAME"),
+		Password: os.Getenv("REPORT_SMTP_PASSWORD"),
+	}
+	quiet := false
+	logFormat := "text"
+	showStats := false
+	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if otlpEndpoint == "" {
+		otlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	concurrency := defaultConcurrency
+	apiVersion := "auto"
+	retries := 3
+	trace := traceDest(os.Getenv("CF_TRACE"))
+	var caCert, proxy string
+	var clientID, clientSecret string
+	outputFile := ""
+	saveSnapshot := ""
+	xlsxFile := ""
+	resume := ""
+	foundationsFile := ""
+	fromSnapshot := ""
+	serveAddr := ""
+	slackURL := ""
+	checkLatest := false
+	checkPivnet := false
+	pivnet := pivnetReleases{Token: os.Getenv("PIVNET_TOKEN")}
+	advisories := ""
+	policyFile := ""
+	maxDropletAge := ""
+	latest := latestReleases{Token: os.Getenv("GITHUB_TOKEN")}
+	postURL := ""
+	postHeaders := make(headerList)
+	postToken := os.Getenv("REPORT_POST_TOKEN")
+	esURL := ""
+	esAPIKey := os.Getenv("REPORT_ELASTICSEARCH_API_KEY")
+	historyFile := ""
+	exportDD := false
+	ddAPIKey := os.Getenv("DD_API_KEY")
+	ddSite := os.Getenv("DD_SITE")
+	if ddSite == "" {
+		ddSite = defaultDatadogSite
+	}
+	splunkURL := ""
+	splunkToken := os.Getenv("REPORT_SPLUNK_TOKEN")
+	uploadS3 := ""
+	s3Endpoint := ""
+	s3Region := ""
+	historySince := ""
+	historyChange := ""
+	serveInterval := time.Hour
+
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	fs.BoolVar(&opts.OutputJSON, "output-json", false, "if set sends JSON to stdout instead of a rendered table, implies -quiet unless -output-file is set")
+	fs.BoolVar(&opts.JSONIndent, "json-indent", false, "if set indent -output-json, -output-cyclonedx and -output-sarif to be human-readable, instead of compact")
+	fs.BoolVar(&opts.OutputCSV, "output-csv", false, "if set sends CSV to stdout instead of a rendered table")
+	fs.BoolVar(&opts.OutputHTML, "output-html", false, "if set sends a standalone HTML page to stdout instead of a rendered table")
+	outputTemplate := ""
+	fs.StringVar(&outputTemplate, "output-template", "", "if set sends the report rendered through this Go template, or the template in this file, to stdout instead of a rendered table")
+	fs.BoolVar(&opts.OutputPrometheus, "output-prometheus", false, "if set sends metrics in the Prometheus text format to stdout instead of a rendered table")
+	fs.BoolVar(&opts.OutputSARIF, "output-sarif", false, "if set sends a SARIF log to stdout, with a result for each reason an app needs attention, instead of a rendered table")
+	fs.BoolVar(&opts.OutputCycloneDX, "output-cyclonedx", false, "if set sends a CycloneDX SBOM to stdout, with each app as a component depending on its buildpacks, instead of a rendered table")
+	fs.BoolVar(&opts.Stream, "stream", false, "if set sends JSON Lines to stdout, one app per line as each is processed, implies -quiet unless -output-file is set")
+	fs.StringVar(&outputFile, "output-file", "", "if set the report is written to this file instead of stdout")
+	fs.StringVar(&xlsxFile, "output-xlsx", "", "if set an Excel workbook is also written to this file, with a summary sheet and a sheet of apps per org")
+	restageScript := ""
+	fs.StringVar(&restageScript, "emit-restage-script", "", "if set a shell script restaging the apps with outdated droplets, grouped and commented by reason, is written to this file for review")
+	fs.StringVar(&uploadS3, "upload-s3", "", "if set upload -output-file and -output-xlsx, named with the time of the run, to this s3://bucket/prefix/ URL, with credentials from $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+	fs.StringVar(&s3Endpoint, "s3-endpoint", "", "URL of an S3-compatible service such as MinIO to upload to with -upload-s3 (default $AWS_ENDPOINT_URL_S3 or $AWS_ENDPOINT_URL, else AWS)")
+	fs.StringVar(&s3Region, "s3-region", "", "region of the -upload-s3 bucket (default $AWS_REGION or $AWS_DEFAULT_REGION, else us-east-1)")
+	fs.StringVar(&historyFile, "history-file", "", "if set append each run's rows, with a run ID and timestamp, to this history file, for use with history")
+	fs.StringVar(&historySince, "since", "30d", "with history, how far back to report changes from, eg 7d or 12h")
+	fs.StringVar(&historyChange, "change", "", "with history, only report this kind of change, one of: "+strings.Join(changeKinds, ", "))
+	fs.StringVar(&saveSnapshot, "save-snapshot", "", "if set the data collected from the API is saved to this file, for use with -from-snapshot")
+	fs.StringVar(&resume, "resume", "", "if set record progress in this file, so that if the run is interrupted or fails, running again with the same options continues where it left off")
+	fs.StringVar(&foundationsFile, "foundations", "", "if set report on each foundation in this config file, logging in with the credentials given for each, instead of the one the cf CLI is logged in to")
+	fs.StringVar(&fromSnapshot, "from-snapshot", "", "if set the report is rendered from a file saved by -save-snapshot instead of calling the API")
+	fs.StringVar(&serveAddr, "serve", "", "if set serve the report over HTTP on this address (eg :8080) instead of writing it once")
+	fs.DurationVar(&serveInterval, "serve-interval", time.Hour, "how often -serve collects the report again")
+	fs.DurationVar(&wopts.Interval, "watch", 0, "if set collect the report on this interval (eg 24h), saving each to -watch-output")
+	fs.StringVar(&wopts.Output, "watch-output", "", "directory to write a file per report to, or file to append a line per report to")
+	fs.Int64Var(&wopts.MaxSize, "watch-max-size", 100, "size in MB at which the -watch-output file is rotated")
+	fs.IntVar(&wopts.Keep, "watch-keep", 5, "number of rotated -watch-output files to keep")
+	fs.StringVar(&slackURL, "notify-slack", "", "if set post a summary of apps needing attention to this Slack webhook URL")
+	fs.StringVar(&postURL, "post-url", "", "if set POST the report as JSON to this URL")
+	fs.Var(postHeaders, "post-header", "header to send with -post-url, as \"Name: value\", may be repeated")
+	fs.StringVar(&postToken, "post-token", postToken, "bearer token to send with -post-url (default $REPORT_POST_TOKEN)")
+	fs.StringVar(&esURL, "export-elasticsearch", "", "if set index each row, with the time of the run, in the Elasticsearch index at this URL (eg https://es.example.com:9200/buildpacks) with the bulk API")
+	fs.StringVar(&esAPIKey, "elasticsearch-api-key", esAPIKey, "API key to send with -export-elasticsearch (default $REPORT_ELASTICSEARCH_API_KEY)")
+	fs.StringVar(&splunkURL, "export-splunk-hec", "", "if set send each row, with the run's ID, time and API, as an event to the Splunk HTTP Event Collector at this URL (eg https://splunk.example.com:8088)")
+	fs.StringVar(&splunkToken, "splunk-token", splunkToken, "HEC token to send with -export-splunk-hec (default $REPORT_SPLUNK_TOKEN)")
+	fs.BoolVar(&exportDD, "export-datadog", false, "if set submit gauges of the apps, memory and apps outdated or needing attention for each buildpack, tagged by foundation and org, to Datadog")
+	fs.StringVar(&ddAPIKey, "datadog-api-key", ddAPIKey, "API key to submit -export-datadog metrics with (default $DD_API_KEY)")
+	fs.StringVar(&ddSite, "datadog-site", ddSite, "Datadog site to submit -export-datadog metrics to, eg datadoghq.eu (default $DD_SITE, else "+defaultDatadogSite+")")
+	fs.Var(&eopts.To, "email-to", "if set email the report to these addresses, may be repeated or comma-separated")
+	fs.StringVar(&eopts.From, "email-from", eopts.From, "address to email the report from (default $REPORT_SMTP_FROM)")
+	fs.StringVar(&eopts.Format, "email-format", "html", "format of the emailed report: html or csv")
+	fs.StringVar(&eopts.SMTPAddr, "smtp-addr", eopts.SMTPAddr, "host:port of the SMTP server to email the report with (default $REPORT_SMTP_ADDR)")
+	fs.BoolVar(&opts.IncludeContacts, "include-contacts", false, "if set report the developers and managers of each app's space")
+	fs.BoolVar(&opts.IncludeRoutes, "include-routes", false, "if set report the routes mapped to each app")
+	fs.BoolVar(&opts.IncludeServices, "include-services", false, "if set report the service instances bound to each app")
+	fs.BoolVar(&opts.IncludeEvents, "include-events", false, "if set report who last pushed, restaged, restarted or started each app, and when")
+	fs.BoolVar(&opts.IncludeTasks, "include-tasks", false, "if set report the name, memory and state of each app's most recent tasks")
+	fs.BoolVar(&opts.IncludeSidecars, "include-sidecars", false, "if set report the sidecars of each app, and include their memory in its total")
+	fs.BoolVar(&opts.IncludeHealth, "include-health", false, "if set report the health check type and running and crashed instances of each app")
+	fs.BoolVar(&opts.IncludeRevisions, "include-revisions", false, "if set report the buildpacks each of an app's most recent revisions was staged with")
+	fs.BoolVar(&checkLatest, "check-latest", false, "if set flag apps staged with buildpacks older than their latest release on GitHub, using $GITHUB_TOKEN if set")
+	fs.IntVar(&latest.Behind, "check-latest-behind", 1, "number of releases behind the latest that -check-latest flags")
+	fs.StringVar(&latest.API, "github-api", defaultGitHubAPI, "GitHub API URL that -check-latest looks up releases with")
+	fs.BoolVar(&checkPivnet, "check-pivnet", false, "if set flag apps staged with, and warn of installed, buildpacks older than their latest offline release on Tanzu Network")
+	fs.StringVar(&pivnet.Token, "pivnet-token", pivnet.Token, "Tanzu Network UAA API token for -check-pivnet (default $PIVNET_TOKEN)")
+	fs.StringVar(&pivnet.API, "pivnet-api", defaultPivnetAPI, "Tanzu Network URL that -check-pivnet looks up releases with")
+	fs.StringVar(&advisories, "advisories", "", "if set flag apps staged with buildpack versions affected by advisories in this JSON file or URL")
+	fs.StringVar(&policyFile, "policy", "", "if set flag apps that violate the allowed buildpacks, minimum versions and banned URLs in this policy file")
+	fs.BoolVar(&opts.FailOnPolicy, "fail-on-policy", false, "if set exit with status 4 when any app violates -policy")
+	fs.StringVar(&maxDropletAge, "max-droplet-age", "", "if set flag apps with droplets staged longer ago than this, eg 90d")
+	fs.StringVar(&opts.MemoryUnit, "memory-unit", "auto", "unit to show memory in tables and CSV, one of: "+strings.Join(memoryUnits, ", ")+", JSON is always in MB")
+	fs.BoolVar(&opts.MemoryBreakdown, "memory-breakdown", false, "if set report the memory of each type of process, as well as the total")
+	fs.BoolVar(&opts.Summary, "summary", false, "if set report totals instead of per app")
+	fs.StringVar(&opts.GroupBy, "group-by", "", "if set report the apps, memory and apps needing attention for each of: "+strings.Join(groupByKeys, ", ")+", instead of per app")
+	fs.Var(&opts.Orgs, "org", "only report on this org, may be repeated or comma-separated")
+	current := false
+	fs.BoolVar(&current, "current", false, "if set only report on the org and space targeted by the cf CLI, which doesn't require listing all orgs")
+	includeSystem := false
+	fs.Var(&opts.ExcludeOrgs, "exclude-orgs", "orgs not to report on, may be repeated or comma-separated (default "+defaultExcludedOrgs.String()+")")
+	fs.BoolVar(&includeSystem, "include-system", false, "if set report on the orgs excluded by default, unless given by -exclude-orgs")
+	fs.Var(&opts.Spaces, "space", "only report on this space, may be repeated or comma-separated")
+	runningOnly := false
+	fs.BoolVar(&opts.IncludeStopped, "include-stopped", true, "if set stopped apps are reported, as well as started apps")
+	fs.BoolVar(&runningOnly, "running-only", false, "if set only started apps are reported, same as -include-stopped=false")
+	fs.BoolVar(&opts.ExcludeDocker, "exclude-docker", false, "if set docker apps are not reported")
+	minMemory := ""
+	fs.StringVar(&minMemory, "min-memory", "", "if set only apps reserving at least this much memory are reported, eg 1G")
+	appFilter, excludeApp := "", ""
+	fs.StringVar(&appFilter, "app-filter", "", "if set only apps whose names match this regular expression are reported")
+	fs.StringVar(&excludeApp, "exclude-app", "", "if set apps whose names match this regular expression are not reported, eg '-venerable$'")
+	fs.StringVar(&opts.SortBy, "sort-by", "name", "sort rows by one of: "+strings.Join(sortKeys, ", "))
+	fs.BoolVar(&opts.SortDesc, "desc", false, "if set sort rows in descending order")
+	fs.BoolVar(&opts.AttentionOnly, "attention-only", false, "if set only apps that need attention are reported")
+	fs.Var(&opts.LabelSelector, "label-selector", "only report on apps whose labels match this selector, eg 'team=payments,env!=sandbox'")
+	fs.Var(&opts.MetadataColumns, "metadata-columns", "label or annotation keys to report as columns, may be repeated or comma-separated")
+	fs.Var(&opts.Buildpacks, "buildpack", "only report on apps using this buildpack, may be repeated or comma-separated")
+	fs.BoolVar(&opts.SkipInFlight, "skip-in-flight", false, "if set apps with a deployment or build in progress are not reported")
+	fs.BoolVar(&opts.Anonymize, "anonymize", false, "if set replace org, space and app names with stable hashes, so the report can be shared")
+	fs.BoolVar(&opts.FailOnAttention, "fail-on-attention", false, "if set exit with status 3 when more than -attention-threshold apps need attention")
+	fs.IntVar(&opts.AttentionThreshold, "attention-threshold", 0, "number of apps that may need attention before -fail-on-attention fails the run")
+	fs.BoolVar(&opts.FlagAutodetect, "flag-autodetect", false, "if set flag apps that don't request a buildpack, so would change buildpack if the buildpack order changed")
+	fs.Var(&opts.DeprecatedStacks, "deprecated-stacks", "stacks to flag as deprecated, may be repeated or comma-separated (default "+defaultDeprecatedStacks.String()+")")
+	tag := false
+	fs.BoolVar(&tag, "tag-apps", false, "if set annotate each app reported with its status, reasons and when it was checked")
+	fs.BoolVar(&ropts.Restage, "restage", false, "if set restage apps with outdated droplets after reporting")
+	fs.BoolVar(&ropts.DryRun, "dry-run", false, "if set with -restage, list the apps that would be restaged without restaging them")
+	fs.BoolVar(&ropts.Yes, "yes", false, "if set with -restage, don't prompt for confirmation")
+	fs.IntVar(&ropts.MaxParallel, "restage-max-parallel", 2, "maximum number of apps to restage at once")
+	fs.IntVar(&ropts.PerSpace, "restage-per-space", 1, "maximum number of apps to restage at once within a space")
+	fs.BoolVar(&quiet, "quiet", false, "if set suppresses printing of progress messages to stderr")
+	fs.BoolVar(&showStats, "stats", false, "if set log the number of API requests, retries and rate limited requests, the orgs, spaces and apps found, and the time taken by each phase, once the run completes")
+	fs.StringVar(&otlpEndpoint, "otlp-endpoint", otlpEndpoint, "if set export OpenTelemetry spans for each phase of collecting, org, space, app and API request to the OTLP/HTTP receiver at this URL, once the run completes (default $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	fs.StringVar(&logFormat, "log-format", "text", "format of progress and error messages on stderr, one of: "+strings.Join(logFormats, ", "))
+	fs.IntVar(&concurrency, "concurrency", defaultConcurrency, "maximum number of API requests to make in parallel")
+	fs.StringVar(&clientID, "client-id", "", "UAA client to log in as instead of the logged in user, with the cloud_controller.admin_read_only authority (default $CF_CLIENT_ID)")
+	fs.StringVar(&clientSecret, "client-secret", "", "secret of -client-id (default $CF_CLIENT_SECRET)")
+	fs.StringVar(&caCert, "ca-cert", os.Getenv("SSL_CERT_FILE"), "PEM file of CA certificates to verify the API's certificate with, instead of skipping validation (default $SSL_CERT_FILE)")
+	fs.StringVar(&proxy, "proxy", "", "URL of a proxy to reach the API through (default from HTTPS_PROXY, HTTP_PROXY and NO_PROXY)")
+	fs.Var(&trace, "trace", "dump API requests and responses, with Authorization redacted, to stderr, or to a file with -trace=PATH (default from CF_TRACE)")
+	fs.IntVar(&retries, "retries", 3, "number of times to retry API requests that fail with a transient error")
+	requestsPerSecond := 0.0
+	fs.Float64Var(&requestsPerSecond, "requests-per-second", 0, "if set make at most this many API requests a second, so as not to load a busy foundation, eg 10")
+	resultsPerPage := 0
+	fs.IntVar(&resultsPerPage, "results-per-page", 0, "size of the pages API listings are requested in (default the most allowed: 100 with the v2 API, 5000 with v3)")
+	fs.StringVar(&apiVersion, "api-version", "auto", "CloudController API version to list resources with: 2, 3 or auto")
+	fs.String("config", defaultConfigPath(), "file of default options, overridden by "+envPrefix+"* environment variables and then the command line")
+	c.flags = fs
+	if c.defineOnly {
+		return
+	}
+
+	// "report-buildpacks diff OLD NEW" compares two saved reports, and
+	// "report-buildpacks history FILE" reports changes recorded by -history-file
+	flagArgs := args[1:]
+	diff := args[0] == "report-buildpacks" && len(flagArgs) != 0 && flagArgs[0] == "diff"
+	history := args[0] == "report-buildpacks" && len(flagArgs) != 0 && flagArgs[0] == "history"
+	if diff || history {
+		flagArgs = flagArgs[1:]
+	}
+	err := fs.Parse(flagArgs)
+	if err != nil {
+		logFatal(err)
+	}
+	err = applyDefaults(fs)
+	if err != nil {
+		logFatal(err)
+	}
+
+	err = validateLogFormat(logFormat)
+	if err != nil {
+		logFatal(err)
+	}
+	setLogFormat(logFormat)
+
+	if resultsPerPage < 0 {
+		logFatal("-results-per-page can't be negative")
+	}
+
+	err = validateSortKey(opts.SortBy)
+	if err != nil {
+		logFatal(err)
+	}
+
+	err = validateMemoryUnit(opts.MemoryUnit)
+	if err != nil {
+		logFatal(err)
+	}
+
+	if runningOnly {
+		opts.IncludeStopped = false
+	}
+
+	formats := 0
+	for _, set := range []bool{opts.OutputJSON, opts.OutputCSV, opts.OutputHTML, outputTemplate != "", opts.OutputPrometheus, opts.OutputCycloneDX, opts.OutputSARIF, opts.Stream} {
+		if set {
+			formats++
+		}
+	}
+	if formats > 1 {
+		logFatal("only one of -output-json, -output-csv, -output-html, -output-template, -output-prometheus, -output-cyclonedx, -output-sarif and -stream may be set")
+	}
+	if outputTemplate != "" {
+		if args[0] != "report-buildpacks" || diff {
+			logFatal("-output-template can only be used with report-buildpacks")
+		}
+		opts.OutputTemplate, err = parseOutputTemplate(outputTemplate, &opts)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+	if (opts.OutputCycloneDX || opts.OutputSARIF) && (args[0] != "report-buildpacks" || diff) {
+		logFatal("-output-cyclonedx and -output-sarif can only be used with report-buildpacks")
+	}
+	if xlsxFile != "" && (args[0] != "report-buildpacks" || diff || serveAddr != "" || wopts.Interval != 0) {
+		logFatal("-output-xlsx can only be used with report-buildpacks, and not with -serve or -watch")
+	}
+	if restageScript != "" && (args[0] != "report-buildpacks" || diff || serveAddr != "" || wopts.Interval != 0 || foundationsFile != "" || opts.Anonymize) {
+		logFatal("-emit-restage-script can only be used with report-buildpacks, and not with -serve, -watch, -foundations or -anonymize")
+	}
+	if opts.Stream && opts.Summary {
+		logFatal("-stream cannot be used with -summary")
+	}
+	if (args[0] == "report-services" || args[0] == "report-docker" || args[0] == "report-quotas" || args[0] == "report-users" || args[0] == "report-isolation-segments" || args[0] == "report-buildpack-order") && (opts.Summary || opts.OutputPrometheus || opts.Stream) {
+		logFatal("-summary, -output-prometheus and -stream can only be used with report-buildpacks and report-stacks")
+	}
+	if (args[0] == "report-services" || args[0] == "report-quotas" || args[0] == "report-users" || args[0] == "report-buildpack-order") && (!opts.LabelSelector.empty() || appFilter != "" || excludeApp != "" || minMemory != "") {
+		logFatal("-label-selector, -app-filter, -exclude-app and -min-memory can only be used with commands that report on apps")
+	}
+	if args[0] == "report-docker" && opts.ExcludeDocker {
+		logFatal("-exclude-docker cannot be used with report-docker")
+	}
+
+	err = validateGroupBy(opts.GroupBy)
+	if err != nil {
+		logFatal(err)
+	}
+	if opts.GroupBy != "" && (opts.Summary || opts.Stream || args[0] != "report-buildpacks") {
+		logFatal("-group-by can only be used with report-buildpacks, and not with -summary or -stream")
+	}
+
+	if opts.JSONIndent && opts.Stream {
+		logFatal("-json-indent cannot be used with -stream, which writes one object per line")
+	}
+	if (opts.OutputJSON || opts.OutputTemplate != nil || opts.OutputCycloneDX || opts.OutputSARIF || opts.Stream) && outputFile == "" {
+		// so progress can't corrupt the JSON if stderr is merged into stdout
+		quiet = true
+	}
+
+	if serveAddr != "" && (formats != 0 || outputFile != "" || ropts.Restage || args[0] != "report-buildpacks") {
+		logFatal("-serve can only be used with report-buildpacks, and not with output options or -restage")
+	}
+
+	if wopts.Interval != 0 && (wopts.Output == "" || serveAddr != "" || formats != 0 || outputFile != "" || ropts.Restage || args[0] != "report-buildpacks") {
+		logFatal("-watch can only be used with report-buildpacks and -watch-output, and not with -serve, output options or -restage")
+	}
+
+	err = eopts.validate()
+	if err != nil {
+		logFatal(err)
+	}
+
+	var s3opts *s3Options
+	if uploadS3 != "" {
+		if diff || history || (outputFile == "" && xlsxFile == "") {
+			logFatal("-upload-s3 requires -output-file or -output-xlsx, and cannot be used with diff or history")
+		}
+		s3opts, err = newS3Options(uploadS3)
+		if err != nil {
+			logFatal(err)
+		}
+		if s3Endpoint != "" {
+			s3opts.Endpoint = s3Endpoint
+		}
+		if s3Region != "" {
+			s3opts.Region = s3Region
+		}
+		err = s3opts.validate()
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if historyFile != "" && (args[0] != "report-buildpacks" || diff || history || serveAddr != "") {
+		logFatal("-history-file can only be used with report-buildpacks, and not with -serve")
+	}
+	var since time.Time
+	if history {
+		age, err := parseAge(historySince)
+		if err != nil {
+			logFatal(err)
+		}
+		since = time.Now().Add(-age)
+		err = validateChangeKind(historyChange)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if splunkURL != "" {
+		if args[0] != "report-buildpacks" || diff || history || serveAddr != "" {
+			logFatal("-export-splunk-hec can only be used with report-buildpacks, and not with -serve")
+		}
+		_, err = hecURL(splunkURL)
+		if err != nil {
+			logFatal(err)
+		}
+		if splunkToken == "" {
+			logFatal("-export-splunk-hec requires -splunk-token or $REPORT_SPLUNK_TOKEN")
+		}
+	}
+
+	if exportDD {
+		if args[0] != "report-buildpacks" || diff || history || serveAddr != "" {
+			logFatal("-export-datadog can only be used with report-buildpacks, and not with -serve")
+		}
+		if ddAPIKey == "" {
+			logFatal("-export-datadog requires -datadog-api-key or $DD_API_KEY")
+		}
+	}
+
+	if esURL != "" {
+		if args[0] != "report-buildpacks" || diff || history || serveAddr != "" {
+			logFatal("-export-elasticsearch can only be used with report-buildpacks, and not with -serve")
+		}
+		_, err = bulkURL(esURL)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if fromSnapshot != "" && (saveSnapshot != "" || ropts.Restage) {
+		logFatal("-from-snapshot cannot be used with -save-snapshot or -restage")
+	}
+	if tag && (args[0] != "report-buildpacks" || diff || serveAddr != "" || wopts.Interval != 0 || foundationsFile != "" || fromSnapshot != "") {
+		logFatal("-tag-apps can only be used with report-buildpacks, and not with -serve, -watch, -foundations or -from-snapshot")
+	}
+	if opts.Anonymize && (args[0] != "report-buildpacks" || diff || tag || ropts.Restage) {
+		logFatal("-anonymize can only be used with report-buildpacks, and not with -tag-apps or -restage")
+	}
+
+	if clientID == "" {
+		clientID = os.Getenv("CF_CLIENT_ID")
+	}
+	if clientSecret == "" {
+		clientSecret = os.Getenv("CF_CLIENT_SECRET")
+	}
+	if clientSecret != "" && clientID == "" {
+		logFatal("-client-secret requires -client-id")
+	}
+
+	var foundations []*foundationConfig
+	if foundationsFile != "" {
+		if args[0] != "report-buildpacks" || serveAddr != "" || wopts.Interval != 0 || resume != "" || saveSnapshot != "" || fromSnapshot != "" || ropts.Restage || clientSecret != "" {
+			logFatal("-foundations can only be used with report-buildpacks, and not with -serve, -watch, -resume, snapshots, -restage or -client-id")
+		}
+		foundations, err = loadFoundations(foundationsFile)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if minMemory != "" {
+		opts.MinMemory, err = parseMemory(minMemory)
+		if err != nil {
+			logFatalf("-min-memory: %s", err)
+		}
+	}
+	if appFilter != "" {
+		opts.AppFilter, err = regexp.Compile(appFilter)
+		if err != nil {
+			logFatalf("-app-filter: %s", err)
+		}
+	}
+	if excludeApp != "" {
+		opts.ExcludeApp, err = regexp.Compile(excludeApp)
+		if err != nil {
+			logFatalf("-exclude-app: %s", err)
+		}
+	}
+
+	var target *Target
+	if current {
+		if len(opts.Orgs) != 0 || len(opts.Spaces) != 0 || fromSnapshot != "" || foundationsFile != "" {
+			logFatal("-current cannot be used with -org, -space, -from-snapshot or -foundations")
+		}
+		target, err = currentTarget(conn)
+		if err != nil {
+			logFatal(err)
+		}
+		// so that the targeted org is reported on even if excluded by
+		// default, and rows are filtered as -org and -space would
+		opts.Orgs = stringList{target.OrgName}
+		if target.SpaceGuid != "" {
+			opts.Spaces = stringList{target.SpaceName}
+		}
+	}
+
+	// set before -resume, which must be resumed with the same orgs excluded
+	if len(opts.ExcludeOrgs) == 0 && !includeSystem {
+		opts.ExcludeOrgs = defaultExcludedOrgs
+	}
+
+	if resume != "" {
+		if args[0] != "report-buildpacks" || serveAddr != "" || wopts.Interval != 0 {
+			logFatal("-resume can only be used with report-buildpacks, and not with -serve or -watch")
+		}
+		opts.Resume, err = loadCheckpoint(resume, &opts)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if checkLatest {
+		if latest.Behind < 1 {
+			logFatal("-check-latest-behind must be at least 1")
+		}
+		opts.CheckLatest = &latest
+	}
+
+	if checkPivnet {
+		if pivnet.Token == "" {
+			logFatal("-check-pivnet requires -pivnet-token or $PIVNET_TOKEN")
+		}
+		opts.CheckPivnet = &pivnet
+	}
+
+	if advisories != "" {
+		opts.Advisories, err = loadAdvisories(newAdvisorySource(advisories))
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if maxDropletAge != "" {
+		opts.MaxDropletAge, err = parseAge(maxDropletAge)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if policyFile != "" {
+		opts.Policy, err = loadPolicy(policyFile)
+		if err != nil {
+			logFatal(err)
+		}
+	} else if opts.FailOnPolicy {
+		logFatal("-fail-on-policy requires -policy")
+	}
+
+	if len(opts.DeprecatedStacks) == 0 {
+		opts.DeprecatedStacks = defaultDeprecatedStacks
+	}
+
+	// if writing to a file, it is only put in place once the report is complete
+	var out io.Writer = os.Stdout
+	var af *atomicFile
+	if outputFile != "" {
+		af, err = createAtomicFile(outputFile)
+		if err != nil {
+			logFatal(err)
+		}
+		out = af
+	}
+	fatal := func(err error) {
+		if af != nil {
+			af.Abort()
+		}
+		logFatal(err)
+	}
+
+	if diff {
+		if fs.NArg() != 2 {
+			fatal(errors.New("usage: cf report-buildpacks diff [options] OLD.json NEW.json"))
+		}
+		err = reportDiff(out, fs.Arg(0), fs.Arg(1), &opts)
+		if err != nil {
+			fatal(err)
+		}
+		if af != nil {
+			err = af.Commit()
+			if err != nil {
+				logFatal(err)
+			}
+		}
+		return
+	}
+
+	if history {
+		if fs.NArg() != 1 {
+			fatal(errors.New("usage: cf report-buildpacks history [options] HISTORY"))
+		}
+		err = reportHistory(out, fs.Arg(0), since, historyChange, &opts)
+		if err != nil {
+			fatal(err)
+		}
+		if af != nil {
+			err = af.Commit()
+			if err != nil {
+				logFatal(err)
+			}
+		}
+		return
+	}
+
+	traceOut, err := trace.open()
+	if err != nil {
+		fatal(err)
+	}
+
+	var stats *runStats
+	if showStats {
+		stats = newRunStats()
+	}
+
+	var tracer *otelTracer
+	if otlpEndpoint != "" && serveAddr == "" && wopts.Interval == 0 {
+		tracer = newOTelTracer(args[0])
+	}
+
+	// connect returns a client for the API conn is logged in to
+	connect := func(conn Connection) (*simpleClient, Client, error) {
+		client, err := newSimpleClient(conn, quiet, concurrency, caCert, proxy)
+		if err != nil {
+			return nil, nil, err
+		}
+		client.Retries = retries
+		client.RateLimit = newRateLimiter(requestsPerSecond)
+		client.ResultsPerPage = resultsPerPage
+		client.Stats = stats
+		client.Tracer = tracer
+		if traceOut != nil {
+			client.Trace(traceOut)
+		}
+
+		fd, err := newFoundation(client, apiVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, fd, nil
+	}
+
+	var client *simpleClient
+	var fd Client
+	var recorder *recordingFoundation
+	switch {
+	case fromSnapshot != "":
+		// no API calls are made, the client is only used to run in parallel
+		client = &simpleClient{Quiet: quiet, Concurrency: concurrency, Stats: stats}
+		sf, err := loadSnapshotFoundation(fromSnapshot)
+		if err != nil {
+			fatal(err)
+		}
+		fd = sf
+		opts.API = sf.snapshot.API
+	case foundations != nil:
+		// each foundation is connected to in turn while reporting
+	default:
+		if clientSecret != "" {
+			conn, err = withClientCredentials(conn, clientID, clientSecret)
+			if err != nil {
+				fatal(err)
+			}
+		}
+		client, fd, err = connect(conn)
+		if err != nil {
+			fatal(err)
+		}
+		opts.API = client.API
+		if saveSnapshot != "" {
+			recorder = newRecordingFoundation(fd, client.API)
+			fd = recorder
+		}
+		if target != nil {
+			fd = &targetFoundation{Client: fd, target: target}
+		}
+	}
+
+	if serveAddr != "" {
+		logFatal(serveReport(serveAddr, serveInterval, client, fd, &opts))
+	}
+
+	if wopts.Interval != 0 {
+		logFatal(watchReports(client, fd, &opts, &wopts, func(allInfo []*AppBuildpackInfo) {
+			if slackURL != "" {
+				err := notifySlack(slackURL, allInfo, wopts.Output)
+				if err != nil {
+					logf(levelError, nil, "%s", err)
+				}
+			}
+			if postURL != "" {
+				err := postReport(postURL, postHeaders, postToken, allInfo)
+				if err != nil {
+					logf(levelError, nil, "%s", err)
+				}
+			}
+			runID, err := newUUID()
+			if err != nil {
+				logf(levelError, nil, "%s", err)
+				return
+			}
+			if historyFile != "" {
+				err := appendHistory(historyFile, runID, time.Now(), opts.API, allInfo)
+				if err != nil {
+					logf(levelError, nil, "%s", err)
+				}
+			}
+			if splunkURL != "" {
+				err := exportSplunk(splunkURL, splunkToken, allInfo, runID, time.Now(), opts.API)
+				if err != nil {
+					logf(levelError, nil, "%s", err)
+				}
+			}
+			if exportDD {
+				err := exportDatadog(ddSite, ddAPIKey, allInfo, time.Now())
+				if err != nil {
+					logf(levelError, nil, "%s", err)
+				}
+			}
+			if esURL != "" {
+				err := exportElasticsearch(esURL, esAPIKey, allInfo, time.Now())
+				if err != nil {
+					logf(levelError, nil, "%s", err)
+				}
+			}
+			if len(eopts.To) != 0 {
+				err := emailReport(&eopts, allInfo, &opts)
+				if err != nil {
+					logf(levelError, nil, "%s", err)
+				}
+			}
+		}))
+	}
+
+	// rows exported to Elasticsearch, Splunk or history are stamped with when
+	// the run started, and an ID to tell runs apart
+	runTime := time.Now()
+	runID, err := newUUID()
+	if err != nil {
+		logFatal(err)
+	}
+
+	// on Ctrl-C stop collecting and render what has been collected so far. A
+	// second Ctrl-C kills the process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if client != nil {
+		client.Context = ctx
+	}
+
+	interrupted := false
+	attention := 0
+	violations := 0
+	// reported is the report-buildpacks rows, for restaging and notifications
+	var reported []*AppBuildpackInfo
+	switch args[0] {
+	case "report-buildpacks":
+		collect := func(emit func(*AppBuildpackInfo) error) ([]*AppBuildpackInfo, error) {
+			return collectUsageInfo(client, fd, &opts, emit)
+		}
+		if foundations != nil {
+			collect = func(emit func(*AppBuildpackInfo) error) ([]*AppBuildpackInfo, error) {
+				return collectFoundations(foundations, func(conn Connection) (*simpleClient, Client, error) {
+					client, fd, err := connect(conn)
+					if err != nil {
+						return nil, nil, err
+					}
+					client.Context = ctx
+					return client, fd, nil
+				}, &opts, emit)
+			}
+		}
+		allInfo, err := c.reportBuildpacks(collect, out, &opts)
+		if err == ErrInterrupted {
+			interrupted = true
+		} else if err != nil {
+			fatal(err)
+		}
+		if xlsxFile != "" {
+			err = writeXLSX(xlsxFile, allInfo)
+			if err != nil {
+				fatal(err)
+			}
+		}
+		if restageScript != "" {
+			err = writeRestageScript(restageScript, allInfo, &opts)
+			if err != nil {
+				fatal(err)
+			}
+		}
+		for _, info := range allInfo {
+			if info.needsAttention() {
+				attention++
+			}
+			if info.violatesPolicy() {
+				violations++
+			}
+		}
+		reported = allInfo
+	case "report-orphaned-buildpacks":
+		_, err := c.reportOrphanedBuildpacks(client, fd, out, &opts)
+		if err == ErrInterrupted {
+			// a partial list would include buildpacks used by the apps not
+			// yet checked, so nothing is reported
+			if af != nil {
+				af.Abort()
+			}
+			log.Println("interrupted before all apps were checked, no report written")
+			os.Exit(exitInterrupted)
+		}
+		if err != nil {
+			fatal(err)
+		}
+	case "report-buildpack-order":
+		ordered, err := c.reportBuildpackOrder(fd, out, &opts)
+		if err != nil {
+			fatal(err)
+		}
+		for _, o := range ordered {
+			if len(o.Issues) != 0 {
+				attention++
+			}
+		}
+	case "report-stacks":
+		allInfo, err := c.reportStacks(client, fd, out, &opts)
+		if err == ErrInterrupted {
+			interrupted = true
+		} else if err != nil {
+			fatal(err)
+		}
+		for _, info := range allInfo {
+			if len(info.Reasons) != 0 {
+				attention++
+			}
+		}
+	case "report-services":
+		allInfo, err := c.reportServices(client, fd, out, &opts)
+		if err == ErrInterrupted {
+			interrupted = true
+		} else if err != nil {
+			fatal(err)
+		}
+		for _, info := range allInfo {
+			if info.needsAttention() {
+				attention++
+			}
+		}
+	case "report-docker":
+		_, err := c.reportDocker(client, fd, out, &opts)
+		if err == ErrInterrupted {
+			interrupted = true
+		} else if err != nil {
+			fatal(err)
+		}
+	case "report-quotas":
+		_, err := c.reportQuotas(client, fd, out, &opts)
+		if err == ErrInterrupted {
+			interrupted = true
+		} else if err != nil {
+			fatal(err)
+		}
+	case "report-users":
+		_, err := c.reportUsers(client, fd, out, &opts)
+		if err == ErrInterrupted {
+			interrupted = true
+		} else if err != nil {
+			fatal(err)
+		}
+	case "report-isolation-segments":
+		allInfo, err := c.reportIsolationSegments(client, fd, out, &opts)
+		if err == ErrInterrupted {
+			interrupted = true
+		} else if err != nil {
+			fatal(err)
+		}
+		for _, info := range allInfo {
+			if len(info.Reasons) != 0 {
+				attention++
+			}
+		}
+	}
+
+	if af != nil {
+		err = af.Commit()
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if s3opts != nil {
+		var paths []string
+		for _, p := range []string{outputFile, xlsxFile} {
+			if p != "" {
+				paths = append(paths, p)
+			}
+		}
+		err = uploadReports(s3opts, paths, runTime)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if client != nil {
+		client.logInaccessible()
+	}
+
+	if stats != nil {
+		stats.log()
+	}
+
+	if tracer != nil {
+		err = tracer.export(otlpEndpoint)
+		if err != nil {
+			logf(levelError, nil, "%s", err)
+		}
+	}
+
+	if interrupted {
+		// restaging and notifications are skipped, as they would act on an
+		// incomplete report
+		log.Println("interrupted, the report only includes the apps collected before then")
+		os.Exit(exitInterrupted)
+	}
+
+	if opts.Resume != nil {
+		// the run is complete, so the next starts from scratch
+		err = opts.Resume.Remove()
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if recorder != nil {
+		err = recorder.Save(saveSnapshot)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if tag {
+		err = tagApps(fd, reported, runTime, concurrency)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if ropts.Restage {
+		err = restageApps(fd, reported, &ropts, os.Stdin, os.Stderr)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if slackURL != "" && args[0] == "report-buildpacks" {
+		err = notifySlack(slackURL, reported, outputFile)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if postURL != "" && args[0] == "report-buildpacks" {
+		err = postReport(postURL, postHeaders, postToken, reported)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if historyFile != "" && args[0] == "report-buildpacks" {
+		err = appendHistory(historyFile, runID, runTime, opts.API, reported)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if splunkURL != "" && args[0] == "report-buildpacks" {
+		err = exportSplunk(splunkURL, splunkToken, reported, runID, runTime, opts.API)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if exportDD && args[0] == "report-buildpacks" {
+		err = exportDatadog(ddSite, ddAPIKey, reported, runTime)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if esURL != "" && args[0] == "report-buildpacks" {
+		err = exportElasticsearch(esURL, esAPIKey, reported, runTime)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if len(eopts.To) != 0 && args[0] == "report-buildpacks" {
+		err = emailReport(&eopts, reported, &opts)
+		if err != nil {
+			logFatal(err)
+		}
+	}
+
+	if opts.FailOnPolicy && violations != 0 {
+		logf(levelError, nil, "%d apps violate the policy", violations)
+		os.Exit(exitPolicyViolation)
+	}
+
+	if opts.FailOnAttention && attention > opts.AttentionThreshold {
+		logf(levelError, nil, "%d apps need attention, more than the threshold of %d", attention, opts.AttentionThreshold)
+		os.Exit(exitNeedsAttention)
+	}
+}
+
+// collectFunc collects usage information for all apps, calling emit as
+// collectUsageInfo does
+type collectFunc func(emit func(*AppBuildpackInfo) error) ([]*AppBuildpackInfo, error)
+
+// reportBuildpacks collects usage information for all apps with collect,
+// renders it to out and returns the rows reported on
+func (c *reportBuildpacks) reportBuildpacks(collect collectFunc, out io.Writer, opts *Options) ([]*AppBuildpackInfo, error) {
+	if opts.Stream {
+		// JSON Lines, written as each app is processed
+		var mu sync.Mutex
+		enc := json.NewEncoder(out)
+		return collect(func(info *AppBuildpackInfo) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return enc.Encode(info)
+		})
+	}
+
+	allInfo, err := collect(nil)
+	if err == ErrInterrupted {
+		opts.Partial = partialNote
+	} else if err != nil {
+		return nil, err
+	}
+	Sort(allInfo, opts)
+
+	rerr := Render(out, allInfo, opts)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return allInfo, err
+}
+
+// partialNote is shown with reports that were interrupted
+const partialNote = "PARTIAL REPORT: interrupted before all apps were collected"
+
+// commonOptions are the flags that apply to every command
+var commonOptions = []string{
+	"output-json", "json-indent", "output-csv", "output-html", "output-prometheus", "output-file", "upload-s3", "s3-endpoint", "s3-region", "quiet", "log-format", "stats", "otlp-endpoint", "concurrency", "retries", "requests-per-second", "results-per-page", "client-id", "client-secret", "ca-cert", "proxy", "trace", "api-version", "config",
+	"save-snapshot", "from-snapshot", "summary", "org", "current", "exclude-orgs", "include-system", "space",
+	"include-stopped", "running-only", "exclude-docker", "min-memory", "app-filter", "exclude-app", "label-selector", "sort-by", "desc", "memory-unit", "attention-only", "fail-on-attention", "attention-threshold",
+}
+
+// UsageOptions returns the help text for commonOptions and names, as shown
+// by "cf help COMMAND", from the same flags as -h
+func UsageOptions(names ...string) map[string]string {
+	c := &reportBuildpacks{defineOnly: true}
+	c.run(nil, []string{"report-buildpacks"})
+	rv := make(map[string]string)
+	for _, name := range append(commonOptions, names...) {
+		rv[name] = flagUsage(c.flags.Lookup(name))
+	}
+	return rv
+}
+
+// flagUsage returns the help text of f with its default, if it has one that
+// isn't already given, as -h shows it
+func flagUsage(f *flag.Flag) string {
+	switch {
+	case f.DefValue == "", f.DefValue == "0", f.DefValue == "false", f.DefValue == "0s", strings.Contains(f.Usage, "(default "):
+		return f.Usage
+	}
+	return f.Usage + " (default " + f.DefValue + ")"
+}
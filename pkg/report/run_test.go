@@ -0,0 +1,25 @@
+package report
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUsageOptions(t *testing.T) {
+	options := UsageOptions("restage-max-parallel", "check-latest")
+	for _, name := range commonOptions {
+		if options[name] == "" {
+			t.Errorf("-%s has no help text", name)
+		}
+	}
+	if got := options["restage-max-parallel"]; got != "maximum number of apps to restage at once (default 2)" {
+		t.Errorf("-restage-max-parallel: got %q, want its default given", got)
+	}
+	// defaults already in the help text aren't given twice
+	if got := options["exclude-orgs"]; strings.Count(got, "(default") != 1 {
+		t.Errorf("-exclude-orgs: got %q, want one default", got)
+	}
+	if got := options["quiet"]; got != "if set suppresses printing of progress messages to stderr" {
+		t.Errorf("-quiet: got %q, want the same help text as -h", got)
+	}
+}
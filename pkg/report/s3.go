@@ -0,0 +1,240 @@
+package report
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Options controls where -upload-s3 uploads reports to
+type s3Options struct {
+	// Bucket - the bucket to upload to
+	Bucket string
+
+	// Prefix - prepended to the names of uploaded objects
+	Prefix string
+
+	// Endpoint - URL of an S3-compatible service such as MinIO, if not AWS
+	Endpoint string
+
+	// Region - the region of the bucket, also used to sign requests
+	Region string
+
+	// AccessKeyID, SecretAccessKey and SessionToken - the credentials to
+	// sign requests with
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// newS3Options returns options to upload to u, an s3://bucket/prefix/ URL,
+// with the region and credentials set from the environment as for the AWS
+// CLI
+func newS3Options(u string) (*s3Options, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "s3" || parsed.Host == "" {
+		return nil, fmt.Errorf("-upload-s3 must be an s3://bucket/prefix/ URL")
+	}
+	s3opts := &s3Options{
+		Bucket:          parsed.Host,
+		Prefix:          strings.TrimPrefix(parsed.Path, "/"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_S3"),
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s3opts.Endpoint == "" {
+		s3opts.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if s3opts.Region == "" {
+		s3opts.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s3opts.Region == "" {
+		s3opts.Region = "us-east-1"
+	}
+	return s3opts, nil
+}
+
+func (s3opts *s3Options) validate() error {
+	if s3opts.AccessKeyID == "" || s3opts.SecretAccessKey == "" {
+		return fmt.Errorf("-upload-s3 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY to be set")
+	}
+	if s3opts.Endpoint != "" {
+		u, err := url.Parse(s3opts.Endpoint)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid -s3-endpoint %q, expected a URL such as https://minio.example.com:9000", s3opts.Endpoint)
+		}
+	}
+	return nil
+}
+
+// objectURL returns the URL of the object key. AWS buckets are addressed by
+// host name, but S3-compatible services such as MinIO often only support
+// the bucket in the path.
+func (s3opts *s3Options) objectURL(key string) string {
+	if s3opts.Endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s3opts.Bucket, s3opts.Region, awsURIEncode(key))
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s3opts.Endpoint, "/"), s3opts.Bucket, awsURIEncode(key))
+}
+
+// timestampedKey returns the key to upload the file at p to, with the time
+// of the run added to its name, eg prefix/report-20240102T030405Z.json. The
+// prefix is a directory, whether or not it ends in "/".
+func timestampedKey(prefix, p string, runTime time.Time) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	name := filepath.Base(p)
+	ext := path.Ext(name)
+	return prefix + strings.TrimSuffix(name, ext) + "-" + runTime.UTC().Format(watchTimeFormat) + ext
+}
+
+// uploadReports uploads each of the files at paths to S3, named with the
+// time of the run
+func uploadReports(s3opts *s3Options, paths []string, runTime time.Time) error {
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		key := timestampedKey(s3opts.Prefix, p, runTime)
+		err = putObject(s3opts, key, b, contentType(p))
+		if err != nil {
+			return fmt.Errorf("uploading %s to s3://%s/%s: %s", p, s3opts.Bucket, key, err)
+		}
+	}
+	return nil
+}
+
+// contentType returns the MIME type to upload the file at p as
+func contentType(p string) string {
+	switch ext := strings.ToLower(filepath.Ext(p)); ext {
+	case ".csv":
+		return "text/csv"
+	case ".sarif":
+		return "application/sarif+json"
+	case ".xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+		return "application/octet-stream"
+	}
+}
+
+// putObject uploads body to key, signing the request with AWS Signature
+// Version 4
+func putObject(s3opts *s3Options, key string, body []byte, ct string) error {
+	req, err := http.NewRequest(http.MethodPut, s3opts.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ct)
+	signS3Request(req, s3opts, body, time.Now())
+
+	resp, err := externalClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// the query may hold credentials, eg presigned URLs
+		u := *req.URL
+		u.RawQuery = ""
+		return newAPIError(http.MethodPut, u.String(), resp)
+	}
+	return nil
+}
+
+// signS3Request adds the headers that authenticate req with the credentials
+// in s3opts at the time now, as described at
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signS3Request(req *http.Request, s3opts *s3Options, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s3opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s3opts.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s3opts.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + s3opts.SecretAccessKey)
+	for _, s := range []string{date, s3opts.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s3opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// awsURIEncode escapes all but the characters AWS leaves unreserved in each
+// segment of the path p
+func awsURIEncode(p string) string {
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', strings.IndexByte("-_.~/", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
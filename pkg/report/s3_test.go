@@ -0,0 +1,45 @@
+package report
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestampedKey(t *testing.T) {
+	runTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		prefix, want string
+	}{
+		{"", "report-20240102T030405Z.json"},
+		{"reports/", "reports/report-20240102T030405Z.json"},
+		{"reports", "reports/report-20240102T030405Z.json"},
+		{"a/b", "a/b/report-20240102T030405Z.json"},
+	} {
+		if got := timestampedKey(tc.prefix, "/tmp/report.json", runTime); got != tc.want {
+			t.Errorf("timestampedKey(%q) = %q, want %q", tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func TestPutObjectError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	s3opts := &s3Options{Bucket: "bucket", Endpoint: srv.URL, Region: "us-east-1", AccessKeyID: "id", SecretAccessKey: "secret"}
+	err := putObject(s3opts, "reports/report.json", []byte("{}"), "application/json")
+	ae, ok := err.(*apiError)
+	if !ok {
+		t.Fatalf("got %v, want an apiError", err)
+	}
+	if want := srv.URL + "/bucket/reports/report.json"; ae.URL != want {
+		t.Errorf("got URL %q, want %q", ae.URL, want)
+	}
+	if !strings.Contains(ae.Body, "AccessDenied") {
+		t.Errorf("got body %q, want the service's error", ae.Body)
+	}
+}
@@ -0,0 +1,162 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+)
+
+// sarifRules describes each reason code, in the order they are listed as
+// SARIF rules
+var sarifRules = []struct {
+	code, description string
+}{
+	{reasonDropletMissing, "The app has no current droplet, or it could not be retrieved"},
+	{reasonNoBuildpackRecorded, "The current droplet does not record which buildpacks staged it"},
+	{reasonVersionUnknown, "A buildpack used to stage the droplet did not report its version"},
+	{reasonBuildpackNotInstalled, "A buildpack used to stage the droplet is not installed for the app's stack"},
+	{reasonBuildpackDisabled, "A buildpack used to stage the droplet is installed, but disabled"},
+	{reasonBuildpackDeleted, "A buildpack used to stage the droplet is no longer installed for any stack"},
+	{reasonOutdatedVersion, "A buildpack used to stage the droplet is a different version to the one installed"},
+	{reasonRestageRequired, "The droplet was staged before an installed buildpack it uses was last updated"},
+	{reasonCustomBuildpack, "The app uses a buildpack given by URL, which bypasses admin buildpacks"},
+	{reasonDropletTooOld, "The droplet was staged longer ago than the maximum droplet age"},
+	{reasonBehindLatestRelease, "A buildpack used to stage the droplet is behind its latest release"},
+	{reasonBehindPivnetRelease, "A buildpack used to stage the droplet is behind its latest offline release on Tanzu Network"},
+	{reasonVulnerable, "A buildpack used to stage the droplet has a known vulnerability"},
+	{reasonPolicyNotAllowed, "The app uses a buildpack the policy does not allow"},
+	{reasonPolicyVersionTooOld, "The app was staged with a version older than the policy's minimum"},
+	{reasonPolicyBannedURL, "The app uses a custom buildpack URL the policy bans"},
+	{reasonStackDeprecated, "The app runs on a stack that is deprecated or end of life"},
+	{reasonAutoDetected, "The app doesn't request a buildpack, so a change to the buildpack order can change the one detected"},
+	{reasonDeploymentInProgress, "The app has a deployment or build in progress, so its droplet was not checked"},
+}
+
+// sarifLevel returns the SARIF level of results with the reason code
+func sarifLevel(code string) string {
+	switch {
+	case code == reasonVulnerable || isPolicyReason(code):
+		return "error"
+	case code == reasonCustomBuildpack || code == reasonAutoDetected || code == reasonDeploymentInProgress:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool      `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string           `json:"ruleId"`
+	Level     string           `json:"level"`
+	Message   sarifMessage     `json:"message"`
+	Locations []*sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// appLocation returns the location of the app in info. Dashboards such as
+// GitHub code scanning require a file, so the app's path within the
+// foundation is used as one.
+func appLocation(info *AppBuildpackInfo) *sarifLocation {
+	path := []string{info.Organization, info.Space, info.Application}
+	if info.Foundation != "" {
+		path = append([]string{info.Foundation}, path...)
+	}
+	uri := "cf"
+	for _, p := range path {
+		uri += "/" + url.PathEscape(p)
+	}
+	return &sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}},
+		LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: info.name(), Kind: "module"}},
+	}
+}
+
+// renderSARIF writes a SARIF log to out with a result for each reason an app
+// in allInfo needs attention
+func renderSARIF(out io.Writer, allInfo []*AppBuildpackInfo, opts *Options) error {
+	run := &sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "cf-report-buildpacks",
+			InformationURI: "https://github.com/svrc-pivotal/cf-report-buildpacks",
+		}},
+		Results: []*sarifResult{},
+	}
+	for _, r := range sarifRules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, &sarifRule{
+			ID:                   r.code,
+			ShortDescription:     sarifMessage{Text: r.description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(r.code)},
+		})
+	}
+	for _, info := range allInfo {
+		for _, r := range info.Reasons {
+			run.Results = append(run.Results, &sarifResult{
+				RuleID:    r.Code,
+				Level:     sarifLevel(r.Code),
+				Message:   sarifMessage{Text: info.name() + ": " + r.Description},
+				Locations: []*sarifLocation{appLocation(info)},
+			})
+		}
+	}
+
+	enc := json.NewEncoder(out)
+	if opts.JSONIndent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(&sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []*sarifRun{run},
+	})
+}
@@ -0,0 +1,94 @@
+package report
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// reportServer serves the latest report over HTTP, collecting it again
+// every interval
+type reportServer struct {
+	client *simpleClient
+	fd     Client
+	opts   *Options
+
+	mu        sync.RWMutex
+	allInfo   []*AppBuildpackInfo
+	collected time.Time
+}
+
+// refresh collects the report again. If that fails, the previous report
+// continues to be served.
+func (rs *reportServer) refresh() {
+	allInfo, err := collectUsageInfo(rs.client, rs.fd, rs.opts, nil)
+	if err != nil {
+		logf(levelError, nil, "error collecting report, serving previous report: %s", err)
+		return
+	}
+	Sort(allInfo, rs.opts)
+
+	rs.mu.Lock()
+	rs.allInfo = allInfo
+	rs.collected = time.Now()
+	rs.mu.Unlock()
+}
+
+// handler renders the latest report with opts changed by format
+func (rs *reportServer) handler(contentType string, format func(*Options)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rs.mu.RLock()
+		allInfo, collected := rs.allInfo, rs.collected
+		rs.mu.RUnlock()
+
+		if collected.IsZero() {
+			http.Error(w, "report has not been collected yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		opts := *rs.opts
+		format(&opts)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Last-Modified", collected.UTC().Format(http.TimeFormat))
+		err := Render(w, allInfo, &opts)
+		if err != nil {
+			logf(levelError, nil, "error rendering %s: %s", r.URL.Path, err)
+		}
+	}
+}
+
+// serveReport collects the report every interval, and serves it on addr as
+// HTML on /, JSON on /report.json and Prometheus metrics on /metrics
+func serveReport(addr string, interval time.Duration, client *simpleClient, fd Client, opts *Options) error {
+	rs := &reportServer{client: client, fd: fd, opts: opts}
+
+	go func() {
+		for {
+			rs.refresh()
+			time.Sleep(interval)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		rs.handler("text/html; charset=utf-8", func(o *Options) { o.OutputHTML = true })(w, r)
+	})
+	mux.HandleFunc("/report.json", rs.handler("application/json", func(o *Options) { o.OutputJSON = true }))
+	mux.HandleFunc("/sbom.cdx.json", rs.handler("application/vnd.cyclonedx+json", func(o *Options) { o.OutputCycloneDX = true }))
+	mux.HandleFunc("/report.sarif", rs.handler("application/sarif+json", func(o *Options) { o.OutputSARIF = true }))
+	mux.HandleFunc("/metrics", rs.handler("text/plain; version=0.0.4", func(o *Options) { o.OutputPrometheus = true }))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK\n")
+	})
+
+	if !client.Quiet {
+		log.Printf("serving report on %s, refreshing every %s", addr, interval)
+	}
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,154 @@
+package report
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+type serviceUsageInfo struct {
+	Organization    string `json:"organization"`
+	Space           string `json:"space"`
+	ServiceInstance string `json:"service_instance"`
+
+	// Type - managed or user-provided
+	Type    string `json:"type"`
+	Service string `json:"service,omitempty"`
+	Plan    string `json:"plan,omitempty"`
+
+	// BoundApps - names of the apps the instance is bound to
+	BoundApps []string `json:"bound_apps,omitempty"`
+
+	// LastOperation - eg "create succeeded", and when it last changed
+	LastOperation   string     `json:"last_operation,omitempty"`
+	LastOperationAt *time.Time `json:"last_operation_at,omitempty"`
+}
+
+// needsAttention returns true if the last operation on the instance failed
+func (info *serviceUsageInfo) needsAttention() bool {
+	return strings.HasSuffix(info.LastOperation, " failed")
+}
+
+// reportServices lists the service instances in every space selected by
+// opts, with the apps bound to each, renders them to out and returns the
+// rows reported on
+func (c *reportBuildpacks) reportServices(client *simpleClient, fd Client, out io.Writer, opts *Options) ([]*serviceUsageInfo, error) {
+	allInfo, err := collectServiceUsageInfo(client, fd, opts)
+	if err == ErrInterrupted {
+		opts.Partial = partialNote
+	} else if err != nil {
+		return nil, err
+	}
+
+	sortServiceUsageInfo(allInfo, opts)
+
+	rerr := renderServiceUsageInfo(out, allInfo, opts)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return allInfo, err
+}
+
+// collectServiceUsageInfo lists the service instances in every space
+// selected by opts. If client.Context is done before all spaces are listed
+// it returns the instances in the spaces listed so far and ErrInterrupted.
+func collectServiceUsageInfo(client *simpleClient, fd Client, opts *Options) ([]*serviceUsageInfo, error) {
+	defer client.phase("services")()
+
+	spaces, err := walkSpaces(client, fd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// stored by index so that output order matches the order the API
+	// returned spaces in. A space's rows are only stored once all of its
+	// instances have been listed.
+	spaceInfo := make([][]*serviceUsageInfo, len(spaces))
+	err = client.Parallel(len(spaces), func(i int) (err error) {
+		span := client.Tracer.start("space", spaces[i].attributes()...)
+		defer func() { span.finish(err) }()
+
+		// apps are listed to name those bound, whether or not they are running
+		appNames := make(map[string]string)
+		err = fd.Apps(spaces[i].space, func(app *Resource) error {
+			appNames[app.Metadata.Guid] = app.Entity.Name
+			return nil
+		})
+		if isPermissionDenied(err) {
+			client.skipInaccessible("space", spaces[i].space, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rows []*serviceUsageInfo
+		err = fd.ServiceInstances(spaces[i].space, func(si *ServiceInstance) error {
+			info := &serviceUsageInfo{
+				Organization:    spaces[i].org.Entity.Name,
+				Space:           spaces[i].space.Entity.Name,
+				ServiceInstance: si.Name,
+				Type:            si.Type,
+				Service:         si.Offering,
+				Plan:            si.Plan,
+				LastOperation:   si.LastOperation,
+				LastOperationAt: si.LastOperationAt,
+			}
+			for _, guid := range si.AppGuids {
+				name, found := appNames[guid]
+				if !found {
+					name = guid
+				}
+				info.BoundApps = append(info.BoundApps, name)
+			}
+			if opts.AttentionOnly && !info.needsAttention() {
+				return nil
+			}
+			rows = append(rows, info)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		spaceInfo[i] = rows
+		return nil
+	})
+	// if interrupted, the spaces listed so far are still returned
+	err = interruptedOr(client, err)
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	var allInfo []*serviceUsageInfo
+	for _, rows := range spaceInfo {
+		allInfo = append(allInfo, rows...)
+	}
+	return allInfo, err
+}
+
+// renderServiceUsageInfo writes allInfo to out in the format selected by opts
+func renderServiceUsageInfo(out io.Writer, allInfo []*serviceUsageInfo, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, allInfo, opts)
+	}
+
+	var rows [][]string
+	for _, info := range allInfo {
+		lastOperation := info.LastOperation
+		if info.LastOperationAt != nil {
+			lastOperation += " " + info.LastOperationAt.Format("2006-01-02")
+		}
+		rows = append(rows, []string{
+			info.Organization,
+			info.Space,
+			info.ServiceInstance,
+			info.Type,
+			info.Service,
+			info.Plan,
+			strings.Join(info.BoundApps, ", "),
+			lastOperation,
+		})
+	}
+	return renderRows(out, []string{"Organization", "Space", "Service Instance", "Type", "Service", "Plan", "Bound Apps", "Last Operation"}, rows, opts)
+}
@@ -0,0 +1,736 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// snapshot is the raw data collected from a Client, saved by
+// -save-snapshot so that reports can be re-rendered by -from-snapshot
+// without calling the API again
+type snapshot struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	API         string         `json:"api"`
+	Buildpacks  []*Resource    `json:"buildpacks"`
+	Orgs        []*snapshotOrg `json:"orgs"`
+}
+
+type snapshotOrg struct {
+	Org               *Resource             `json:"org"`
+	Quota             *Quota                `json:"quota,omitempty"`
+	Roles             []*Role               `json:"roles,omitempty"`
+	IsolationSegments *OrgIsolationSegments `json:"isolation_segments,omitempty"`
+	Spaces            []*snapshotSpace      `json:"spaces,omitempty"`
+}
+
+type snapshotSpace struct {
+	Space            *Resource          `json:"space"`
+	Contacts         []string           `json:"contacts,omitempty"`
+	Quota            *Quota             `json:"quota,omitempty"`
+	Roles            []*Role            `json:"roles,omitempty"`
+	IsolationSegment string             `json:"isolation_segment,omitempty"`
+	ServiceInstances []*ServiceInstance `json:"service_instances,omitempty"`
+	Apps             []*snapshotApp     `json:"apps,omitempty"`
+}
+
+type snapshotApp struct {
+	App *Resource `json:"app"`
+
+	// Lifecycle - saved separately as it is not part of the resource's JSON
+	Lifecycle string `json:"lifecycle"`
+
+	Routes   []string `json:"routes,omitempty"`
+	Services []string `json:"services,omitempty"`
+
+	DockerPackage *DockerPackage `json:"docker_package,omitempty"`
+	Revisions     []*Revision    `json:"revisions,omitempty"`
+	InFlight      string         `json:"in_flight,omitempty"`
+	Health        *AppHealth     `json:"health,omitempty"`
+	Sidecars      []*Sidecar     `json:"sidecars,omitempty"`
+	Tasks         []*Task        `json:"tasks,omitempty"`
+	Metadata      *AppMetadata   `json:"metadata,omitempty"`
+	LastEvent     *AppEvent      `json:"last_event,omitempty"`
+	Droplet       *Droplet       `json:"droplet,omitempty"`
+	DropletError  *snapshotError `json:"droplet_error,omitempty"`
+}
+
+// snapshotError is an error returned while fetching a droplet. apiErrors
+// keep their status code so that they are classified the same way when
+// the snapshot is loaded.
+type snapshotError struct {
+	Method     string `json:"method,omitempty"`
+	URL        string `json:"url,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Message    string `json:"message"`
+}
+
+func newSnapshotError(err error) *snapshotError {
+	if ae, ok := err.(*apiError); ok {
+		return &snapshotError{Method: ae.Method, URL: ae.URL, StatusCode: ae.StatusCode, Message: ae.Body}
+	}
+	return &snapshotError{Message: err.Error()}
+}
+
+func (se *snapshotError) err() error {
+	if se.StatusCode != 0 {
+		return &apiError{Method: se.Method, URL: se.URL, StatusCode: se.StatusCode, Body: se.Message}
+	}
+	return errors.New(se.Message)
+}
+
+// recordingFoundation passes calls through to another Client, and
+// records what was returned into a snapshot. Only what a run lists is
+// recorded, so snapshots taken with -org or -space only contain those.
+type recordingFoundation struct {
+	Client
+
+	mu       sync.Mutex
+	snapshot snapshot
+	orgs     map[string]*snapshotOrg
+	spaces   map[string]*snapshotSpace
+	apps     map[string]*snapshotApp
+}
+
+func newRecordingFoundation(fd Client, api string) *recordingFoundation {
+	return &recordingFoundation{
+		Client:   fd,
+		snapshot: snapshot{GeneratedAt: time.Now().UTC(), API: api},
+		orgs:     make(map[string]*snapshotOrg),
+		spaces:   make(map[string]*snapshotSpace),
+		apps:     make(map[string]*snapshotApp),
+	}
+}
+
+func (rf *recordingFoundation) Buildpacks(f func(*Resource) error) error {
+	return rf.Client.Buildpacks(func(bp *Resource) error {
+		rf.mu.Lock()
+		rf.snapshot.Buildpacks = append(rf.snapshot.Buildpacks, bp)
+		rf.mu.Unlock()
+		return f(bp)
+	})
+}
+
+func (rf *recordingFoundation) Orgs(f func(*Resource) error) error {
+	return rf.Client.Orgs(func(org *Resource) error {
+		so := &snapshotOrg{Org: org}
+		rf.mu.Lock()
+		rf.snapshot.Orgs = append(rf.snapshot.Orgs, so)
+		rf.orgs[org.Metadata.Guid] = so
+		rf.mu.Unlock()
+		return f(org)
+	})
+}
+
+func (rf *recordingFoundation) Spaces(org *Resource, f func(*Resource) error) error {
+	return rf.Client.Spaces(org, func(space *Resource) error {
+		ss := &snapshotSpace{Space: space}
+		rf.mu.Lock()
+		if so, found := rf.orgs[org.Metadata.Guid]; found {
+			so.Spaces = append(so.Spaces, ss)
+		}
+		rf.spaces[space.Metadata.Guid] = ss
+		rf.mu.Unlock()
+		return f(space)
+	})
+}
+
+func (rf *recordingFoundation) Org(guid string) (*Resource, error) {
+	org, err := rf.Client.Org(guid)
+	if err != nil {
+		return nil, err
+	}
+	so := &snapshotOrg{Org: org}
+	rf.mu.Lock()
+	rf.snapshot.Orgs = append(rf.snapshot.Orgs, so)
+	rf.orgs[org.Metadata.Guid] = so
+	rf.mu.Unlock()
+	return org, nil
+}
+
+func (rf *recordingFoundation) Space(org *Resource, guid string) (*Resource, error) {
+	space, err := rf.Client.Space(org, guid)
+	if err != nil {
+		return nil, err
+	}
+	ss := &snapshotSpace{Space: space}
+	rf.mu.Lock()
+	if so, found := rf.orgs[org.Metadata.Guid]; found {
+		so.Spaces = append(so.Spaces, ss)
+	}
+	rf.spaces[space.Metadata.Guid] = ss
+	rf.mu.Unlock()
+	return space, nil
+}
+
+func (rf *recordingFoundation) Apps(space *Resource, f func(*Resource) error) error {
+	return rf.Client.Apps(space, func(app *Resource) error {
+		sa := &snapshotApp{App: app, Lifecycle: app.Entity.Lifecycle}
+		rf.mu.Lock()
+		if ss, found := rf.spaces[space.Metadata.Guid]; found {
+			ss.Apps = append(ss.Apps, sa)
+		}
+		rf.apps[app.Metadata.Guid] = sa
+		rf.mu.Unlock()
+		return f(app)
+	})
+}
+
+// AllApps is unsupported, so that snapshots still record orgs and spaces
+// without apps, which other reports use
+func (rf *recordingFoundation) AllApps(f func(org, space, app *Resource) error) error {
+	return errAllAppsUnsupported
+}
+
+func (rf *recordingFoundation) Contacts(space *Resource) ([]string, error) {
+	contacts, err := rf.Client.Contacts(space)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if ss, found := rf.spaces[space.Metadata.Guid]; found {
+		ss.Contacts = contacts
+	}
+	rf.mu.Unlock()
+	return contacts, nil
+}
+
+func (rf *recordingFoundation) Routes(app *Resource) ([]string, error) {
+	routes, err := rf.Client.Routes(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.Routes = routes
+	}
+	rf.mu.Unlock()
+	return routes, nil
+}
+
+func (rf *recordingFoundation) Services(app *Resource) ([]string, error) {
+	services, err := rf.Client.Services(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.Services = services
+	}
+	rf.mu.Unlock()
+	return services, nil
+}
+
+func (rf *recordingFoundation) OrgRoles(org *Resource) ([]*Role, error) {
+	roles, err := rf.Client.OrgRoles(org)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if so, found := rf.orgs[org.Metadata.Guid]; found {
+		so.Roles = roles
+	}
+	rf.mu.Unlock()
+	return roles, nil
+}
+
+func (rf *recordingFoundation) SpaceRoles(space *Resource) ([]*Role, error) {
+	roles, err := rf.Client.SpaceRoles(space)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if ss, found := rf.spaces[space.Metadata.Guid]; found {
+		ss.Roles = roles
+	}
+	rf.mu.Unlock()
+	return roles, nil
+}
+
+func (rf *recordingFoundation) OrgIsolationSegments(org *Resource) (*OrgIsolationSegments, error) {
+	segments, err := rf.Client.OrgIsolationSegments(org)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if so, found := rf.orgs[org.Metadata.Guid]; found {
+		so.IsolationSegments = segments
+	}
+	rf.mu.Unlock()
+	return segments, nil
+}
+
+func (rf *recordingFoundation) SpaceIsolationSegment(space *Resource) (string, error) {
+	segment, err := rf.Client.SpaceIsolationSegment(space)
+	if err != nil {
+		return "", err
+	}
+	rf.mu.Lock()
+	if ss, found := rf.spaces[space.Metadata.Guid]; found {
+		ss.IsolationSegment = segment
+	}
+	rf.mu.Unlock()
+	return segment, nil
+}
+
+func (rf *recordingFoundation) OrgQuota(org *Resource) (*Quota, error) {
+	q, err := rf.Client.OrgQuota(org)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if so, found := rf.orgs[org.Metadata.Guid]; found {
+		so.Quota = q
+	}
+	rf.mu.Unlock()
+	return q, nil
+}
+
+func (rf *recordingFoundation) SpaceQuota(space *Resource) (*Quota, error) {
+	q, err := rf.Client.SpaceQuota(space)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if ss, found := rf.spaces[space.Metadata.Guid]; found {
+		ss.Quota = q
+	}
+	rf.mu.Unlock()
+	return q, nil
+}
+
+func (rf *recordingFoundation) Revisions(app *Resource) ([]*Revision, error) {
+	revisions, err := rf.Client.Revisions(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.Revisions = revisions
+	}
+	rf.mu.Unlock()
+	return revisions, nil
+}
+
+func (rf *recordingFoundation) Health(app *Resource) (*AppHealth, error) {
+	health, err := rf.Client.Health(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.Health = health
+	}
+	rf.mu.Unlock()
+	return health, nil
+}
+
+func (rf *recordingFoundation) Tasks(app *Resource) ([]*Task, error) {
+	tasks, err := rf.Client.Tasks(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.Tasks = tasks
+	}
+	rf.mu.Unlock()
+	return tasks, nil
+}
+
+func (rf *recordingFoundation) Sidecars(app *Resource) ([]*Sidecar, error) {
+	sidecars, err := rf.Client.Sidecars(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.Sidecars = sidecars
+	}
+	rf.mu.Unlock()
+	return sidecars, nil
+}
+
+func (rf *recordingFoundation) LastEvent(app *Resource) (*AppEvent, error) {
+	event, err := rf.Client.LastEvent(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.LastEvent = event
+	}
+	rf.mu.Unlock()
+	return event, nil
+}
+
+func (rf *recordingFoundation) AppMetadata(app *Resource) (*AppMetadata, error) {
+	md, err := rf.Client.AppMetadata(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.Metadata = md
+	}
+	rf.mu.Unlock()
+	return md, nil
+}
+
+func (rf *recordingFoundation) InFlight(app *Resource) (string, error) {
+	inFlight, err := rf.Client.InFlight(app)
+	if err != nil {
+		return "", err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.InFlight = inFlight
+	}
+	rf.mu.Unlock()
+	return inFlight, nil
+}
+
+func (rf *recordingFoundation) DockerPackage(app *Resource) (*DockerPackage, error) {
+	dp, err := rf.Client.DockerPackage(app)
+	if err != nil {
+		return nil, err
+	}
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		sa.DockerPackage = dp
+	}
+	rf.mu.Unlock()
+	return dp, nil
+}
+
+func (rf *recordingFoundation) ServiceInstances(space *Resource, f func(*ServiceInstance) error) error {
+	return rf.Client.ServiceInstances(space, func(si *ServiceInstance) error {
+		rf.mu.Lock()
+		if ss, found := rf.spaces[space.Metadata.Guid]; found {
+			ss.ServiceInstances = append(ss.ServiceInstances, si)
+		}
+		rf.mu.Unlock()
+		return f(si)
+	})
+}
+
+func (rf *recordingFoundation) Droplet(app *Resource) (*Droplet, error) {
+	d, err := rf.Client.Droplet(app)
+	rf.mu.Lock()
+	if sa, found := rf.apps[app.Metadata.Guid]; found {
+		if err != nil {
+			sa.DropletError = newSnapshotError(err)
+		} else {
+			sa.Droplet = d
+		}
+	}
+	rf.mu.Unlock()
+	return d, err
+}
+
+// Save writes the recorded snapshot to path, replacing it only once it has
+// been written completely
+func (rf *recordingFoundation) Save(path string) error {
+	af, err := createAtomicFile(path)
+	if err != nil {
+		return err
+	}
+	rf.mu.Lock()
+	err = json.NewEncoder(af).Encode(&rf.snapshot)
+	rf.mu.Unlock()
+	if err != nil {
+		af.Abort()
+		return err
+	}
+	return af.Commit()
+}
+
+// snapshotFoundation serves a snapshot loaded by -from-snapshot as if it
+// were a live foundation
+type snapshotFoundation struct {
+	snapshot *snapshot
+	orgs     map[string]*snapshotOrg
+	spaces   map[string]*snapshotSpace
+	apps     map[string]*snapshotApp
+}
+
+func loadSnapshotFoundation(path string) (*snapshotFoundation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var s snapshot
+	err = json.NewDecoder(f).Decode(&s)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %s", path, err)
+	}
+
+	sf := &snapshotFoundation{
+		snapshot: &s,
+		orgs:     make(map[string]*snapshotOrg),
+		spaces:   make(map[string]*snapshotSpace),
+		apps:     make(map[string]*snapshotApp),
+	}
+	for _, so := range s.Orgs {
+		sf.orgs[so.Org.Metadata.Guid] = so
+		for _, ss := range so.Spaces {
+			sf.spaces[ss.Space.Metadata.Guid] = ss
+			for _, sa := range ss.Apps {
+				sa.App.Entity.Lifecycle = sa.Lifecycle
+				sf.apps[sa.App.Metadata.Guid] = sa
+			}
+		}
+	}
+	return sf, nil
+}
+
+func (sf *snapshotFoundation) Buildpacks(f func(*Resource) error) error {
+	for _, bp := range sf.snapshot.Buildpacks {
+		err := f(bp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sf *snapshotFoundation) Orgs(f func(*Resource) error) error {
+	for _, so := range sf.snapshot.Orgs {
+		err := f(so.Org)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sf *snapshotFoundation) Spaces(org *Resource, f func(*Resource) error) error {
+	so, found := sf.orgs[org.Metadata.Guid]
+	if !found {
+		return nil
+	}
+	for _, ss := range so.Spaces {
+		err := f(ss.Space)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sf *snapshotFoundation) Org(guid string) (*Resource, error) {
+	so, found := sf.orgs[guid]
+	if !found {
+		return nil, fmt.Errorf("org %s was not captured in the snapshot", guid)
+	}
+	return so.Org, nil
+}
+
+func (sf *snapshotFoundation) Space(org *Resource, guid string) (*Resource, error) {
+	ss, found := sf.spaces[guid]
+	if !found {
+		return nil, fmt.Errorf("space %s was not captured in the snapshot", guid)
+	}
+	return ss.Space, nil
+}
+
+func (sf *snapshotFoundation) Apps(space *Resource, f func(*Resource) error) error {
+	ss, found := sf.spaces[space.Metadata.Guid]
+	if !found {
+		return nil
+	}
+	for _, sa := range ss.Apps {
+		err := f(sa.App)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllApps is unsupported, as listing the apps of each space in the snapshot
+// makes no requests anyway
+func (sf *snapshotFoundation) AllApps(f func(org, space, app *Resource) error) error {
+	return errAllAppsUnsupported
+}
+
+func (sf *snapshotFoundation) Contacts(space *Resource) ([]string, error) {
+	ss, found := sf.spaces[space.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return ss.Contacts, nil
+}
+
+func (sf *snapshotFoundation) Routes(app *Resource) ([]string, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.Routes, nil
+}
+
+func (sf *snapshotFoundation) Services(app *Resource) ([]string, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.Services, nil
+}
+
+func (sf *snapshotFoundation) OrgRoles(org *Resource) ([]*Role, error) {
+	so, found := sf.orgs[org.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return so.Roles, nil
+}
+
+func (sf *snapshotFoundation) SpaceRoles(space *Resource) ([]*Role, error) {
+	ss, found := sf.spaces[space.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return ss.Roles, nil
+}
+
+func (sf *snapshotFoundation) OrgIsolationSegments(org *Resource) (*OrgIsolationSegments, error) {
+	so, found := sf.orgs[org.Metadata.Guid]
+	if !found || so.IsolationSegments == nil {
+		return &OrgIsolationSegments{}, nil
+	}
+	return so.IsolationSegments, nil
+}
+
+func (sf *snapshotFoundation) SpaceIsolationSegment(space *Resource) (string, error) {
+	ss, found := sf.spaces[space.Metadata.Guid]
+	if !found {
+		return "", nil
+	}
+	return ss.IsolationSegment, nil
+}
+
+func (sf *snapshotFoundation) OrgQuota(org *Resource) (*Quota, error) {
+	so, found := sf.orgs[org.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return so.Quota, nil
+}
+
+func (sf *snapshotFoundation) SpaceQuota(space *Resource) (*Quota, error) {
+	ss, found := sf.spaces[space.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return ss.Quota, nil
+}
+
+func (sf *snapshotFoundation) Revisions(app *Resource) ([]*Revision, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.Revisions, nil
+}
+
+func (sf *snapshotFoundation) Health(app *Resource) (*AppHealth, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.Health, nil
+}
+
+func (sf *snapshotFoundation) Tasks(app *Resource) ([]*Task, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.Tasks, nil
+}
+
+func (sf *snapshotFoundation) Sidecars(app *Resource) ([]*Sidecar, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.Sidecars, nil
+}
+
+func (sf *snapshotFoundation) LastEvent(app *Resource) (*AppEvent, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.LastEvent, nil
+}
+
+func (sf *snapshotFoundation) AppMetadata(app *Resource) (*AppMetadata, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return nil, nil
+	}
+	return sa.Metadata, nil
+}
+
+func (sf *snapshotFoundation) InFlight(app *Resource) (string, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found {
+		return "", nil
+	}
+	return sa.InFlight, nil
+}
+
+func (sf *snapshotFoundation) DockerPackage(app *Resource) (*DockerPackage, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	if !found || sa.DockerPackage == nil {
+		return &DockerPackage{}, nil
+	}
+	return sa.DockerPackage, nil
+}
+
+func (sf *snapshotFoundation) ServiceInstances(space *Resource, f func(*ServiceInstance) error) error {
+	ss, found := sf.spaces[space.Metadata.Guid]
+	if !found {
+		return nil
+	}
+	for _, si := range ss.ServiceInstances {
+		err := f(si)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefetchDroplets does nothing, as the snapshot has every app's droplet
+func (sf *snapshotFoundation) PrefetchDroplets(apps []*Resource) error {
+	return nil
+}
+
+func (sf *snapshotFoundation) Droplet(app *Resource) (*Droplet, error) {
+	sa, found := sf.apps[app.Metadata.Guid]
+	switch {
+	case !found:
+		return nil, fmt.Errorf("app %s is not in the snapshot", app.Entity.Name)
+	case sa.DropletError != nil:
+		return nil, sa.DropletError.err()
+	case sa.Droplet == nil:
+		return nil, fmt.Errorf("droplet was not captured in the snapshot")
+	}
+	return sa.Droplet, nil
+}
+
+func (sf *snapshotFoundation) Restage(appGuid string) error {
+	return errors.New("apps cannot be restaged from a snapshot")
+}
+
+func (sf *snapshotFoundation) Annotate(appGuid string, annotations map[string]string) error {
+	return errors.New("apps cannot be tagged from a snapshot")
+}
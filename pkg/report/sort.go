@@ -0,0 +1,166 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sortKeys are the values accepted by -sort-by
+var sortKeys = []string{"name", "memory", "buildpack", "staleness", "stack", "crashed"}
+
+// validateSortKey returns an error if key is not one of sortKeys
+func validateSortKey(key string) error {
+	for _, k := range sortKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown sort key %q, expected one of %s", key, strings.Join(sortKeys, ", "))
+}
+
+// compareNames orders by organization, then space, then application
+func compareNames(org1, space1, app1, org2, space2, app2 string) int {
+	if c := strings.Compare(org1, org2); c != 0 {
+		return c
+	}
+	if c := strings.Compare(space1, space2); c != 0 {
+		return c
+	}
+	return strings.Compare(app1, app2)
+}
+
+// compareInts orders a before b
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortLess returns a less function for sort.Slice, using by as the primary
+// comparison, reversed if desc, with ties broken by names in ascending order
+func sortLess(by, names func(i, j int) int, desc bool) func(i, j int) bool {
+	return func(i, j int) bool {
+		c := by(i, j)
+		if desc {
+			c = -c
+		}
+		if c == 0 {
+			c = names(i, j)
+		}
+		return c < 0
+	}
+}
+
+// Sort sorts allInfo by opts.SortBy
+func Sort(allInfo []*AppBuildpackInfo, opts *Options) {
+	names := func(i, j int) int {
+		a, b := allInfo[i], allInfo[j]
+		if c := strings.Compare(a.Foundation, b.Foundation); c != 0 {
+			return c
+		}
+		return compareNames(a.Organization, a.Space, a.Application, b.Organization, b.Space, b.Application)
+	}
+	by := names
+	switch opts.SortBy {
+	case "memory":
+		by = func(i, j int) int {
+			return compareInts(allInfo[i].memory(), allInfo[j].memory())
+		}
+	case "buildpack":
+		by = func(i, j int) int {
+			return strings.Compare(strings.Join(allInfo[i].Buildpacks, ", "), strings.Join(allInfo[j].Buildpacks, ", "))
+		}
+	case "staleness":
+		by = func(i, j int) int {
+			return compareInts(int64(allInfo[i].StalenessDays), int64(allInfo[j].StalenessDays))
+		}
+	case "stack":
+		by = func(i, j int) int {
+			return strings.Compare(allInfo[i].Stack, allInfo[j].Stack)
+		}
+	case "crashed":
+		by = func(i, j int) int {
+			return compareInts(allInfo[i].crashed(), allInfo[j].crashed())
+		}
+	}
+	sort.Slice(allInfo, sortLess(by, names, opts.SortDesc))
+}
+
+// sortStackUsageInfo sorts allInfo by opts.SortBy
+func sortStackUsageInfo(allInfo []*stackUsageInfo, opts *Options) {
+	names := func(i, j int) int {
+		a, b := allInfo[i], allInfo[j]
+		return compareNames(a.Organization, a.Space, a.Application, b.Organization, b.Space, b.Application)
+	}
+	by := names
+	switch opts.SortBy {
+	case "memory":
+		by = func(i, j int) int {
+			return compareInts(allInfo[i].memory(), allInfo[j].memory())
+		}
+	case "stack":
+		by = func(i, j int) int {
+			return strings.Compare(allInfo[i].Stack, allInfo[j].Stack)
+		}
+	}
+	sort.Slice(allInfo, sortLess(by, names, opts.SortDesc))
+}
+
+// sortServiceUsageInfo sorts allInfo by org, space and service instance, as
+// the other sort keys don't apply to service instances
+func sortServiceUsageInfo(allInfo []*serviceUsageInfo, opts *Options) {
+	names := func(i, j int) int {
+		a, b := allInfo[i], allInfo[j]
+		return compareNames(a.Organization, a.Space, a.ServiceInstance, b.Organization, b.Space, b.ServiceInstance)
+	}
+	sort.Slice(allInfo, sortLess(names, names, opts.SortDesc))
+}
+
+// sortDockerUsageInfo sorts allInfo by org, space and app, as the other sort
+// keys don't apply to docker apps
+func sortDockerUsageInfo(allInfo []*dockerUsageInfo, opts *Options) {
+	names := func(i, j int) int {
+		a, b := allInfo[i], allInfo[j]
+		return compareNames(a.Organization, a.Space, a.Application, b.Organization, b.Space, b.Application)
+	}
+	sort.Slice(allInfo, sortLess(names, names, opts.SortDesc))
+}
+
+// sortQuotaUsageInfo sorts allInfo by org and space, with each org before
+// its spaces, as the other sort keys don't apply to quotas
+func sortQuotaUsageInfo(allInfo []*quotaUsageInfo, opts *Options) {
+	names := func(i, j int) int {
+		a, b := allInfo[i], allInfo[j]
+		return compareNames(a.Organization, a.Space, "", b.Organization, b.Space, "")
+	}
+	sort.Slice(allInfo, sortLess(names, names, opts.SortDesc))
+}
+
+// sortUserRoleInfo sorts allInfo by org and space, with each org before its
+// spaces, then by role and username, as the other sort keys don't apply to
+// roles
+func sortUserRoleInfo(allInfo []*userRoleInfo, opts *Options) {
+	names := func(i, j int) int {
+		a, b := allInfo[i], allInfo[j]
+		if c := compareNames(a.Organization, a.Space, a.Role, b.Organization, b.Space, b.Role); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Username, b.Username)
+	}
+	sort.Slice(allInfo, sortLess(names, names, opts.SortDesc))
+}
+
+// sortIsolationUsageInfo sorts allInfo by org, space and app, as the other
+// sort keys don't apply to isolation segments
+func sortIsolationUsageInfo(allInfo []*isolationUsageInfo, opts *Options) {
+	names := func(i, j int) int {
+		a, b := allInfo[i], allInfo[j]
+		return compareNames(a.Organization, a.Space, a.Application, b.Organization, b.Space, b.Application)
+	}
+	sort.Slice(allInfo, sortLess(names, names, opts.SortDesc))
+}
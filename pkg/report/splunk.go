@@ -0,0 +1,99 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// splunkBatchSize is how many events are sent per HEC request
+const splunkBatchSize = 1000
+
+// splunkEvent is an event sent to a Splunk HTTP Event Collector
+type splunkEvent struct {
+	Time       float64    `json:"time"`
+	Source     string     `json:"source"`
+	Sourcetype string     `json:"sourcetype"`
+	Event      *splunkRow `json:"event"`
+}
+
+// splunkRow is a row sent as the data of an event, with metadata of the run
+// it was collected by
+type splunkRow struct {
+	RunID string `json:"run_id"`
+	API   string `json:"api,omitempty"`
+	*AppBuildpackInfo
+}
+
+// hecURL returns the event endpoint of the HTTP Event Collector at u, which
+// may be its base URL, eg https://splunk.example.com:8088
+func hecURL(u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("-export-splunk-hec must be the URL of an HTTP Event Collector, eg https://splunk.example.com:8088")
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/services/collector/event"
+	}
+	return parsed.String(), nil
+}
+
+// exportSplunk sends each row of allInfo as an event to the HTTP Event
+// Collector at u, authenticated with token, stamped with the run's ID, time
+// and API
+func exportSplunk(u, token string, allInfo []*AppBuildpackInfo, runID string, runTime time.Time, api string) error {
+	eu, err := hecURL(u)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(allInfo); start += splunkBatchSize {
+		end := start + splunkBatchSize
+		if end > len(allInfo) {
+			end = len(allInfo)
+		}
+		// HEC takes a batch of events as concatenated objects
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, info := range allInfo[start:end] {
+			err = enc.Encode(&splunkEvent{
+				Time:       float64(runTime.UnixNano()/int64(time.Millisecond)) / 1000,
+				Source:     "cf-report-buildpacks",
+				Sourcetype: "_json",
+				Event:      &splunkRow{RunID: runID, API: api, AppBuildpackInfo: info},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		err = postHEC(eu, token, &body)
+		if err != nil {
+			return fmt.Errorf("exporting to Splunk: %s", err)
+		}
+	}
+	return nil
+}
+
+// postHEC POSTs a batch of events to u
+func postHEC(u, token string, body *bytes.Buffer) error {
+	req, err := http.NewRequest(http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+token)
+	resp, err := externalClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return newAPIError(http.MethodPost, req.URL.Host, resp)
+	}
+	return nil
+}
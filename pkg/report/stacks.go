@@ -0,0 +1,148 @@
+package report
+
+import (
+	"io"
+	"sort"
+	"strconv"
+)
+
+// defaultDeprecatedStacks are the stacks flagged by report-stacks unless
+// -deprecated-stacks is given
+var defaultDeprecatedStacks = stringList{"cflinuxfs2", "cflinuxfs3", "windows2012R2", "windows2016"}
+
+type stackUsageInfo struct {
+	Organization string    `json:"organization"`
+	Space        string    `json:"space"`
+	Application  string    `json:"application"`
+	Stack        string    `json:"stack"`
+	TotalMemory  string    `json:"total_memory,omitempty"`
+	Reasons      []*reason `json:"reasons,omitempty"`
+}
+
+// stackSummary aggregates usage information for all apps on a stack
+type stackSummary struct {
+	Stack       string `json:"stack"`
+	Apps        int    `json:"apps"`
+	TotalMemory int64  `json:"total_memory"`
+	Deprecated  bool   `json:"deprecated"`
+}
+
+// reportStacks lists the stack of every app selected by opts, renders it
+// to out and returns the rows reported on
+func (c *reportBuildpacks) reportStacks(client *simpleClient, fd Client, out io.Writer, opts *Options) ([]*stackUsageInfo, error) {
+	apps, err := walkApps(client, fd, opts)
+	if err == ErrInterrupted {
+		opts.Partial = partialNote
+	} else if err != nil {
+		return nil, err
+	}
+
+	var allInfo []*stackUsageInfo
+	for _, a := range apps {
+		info := &stackUsageInfo{
+			Organization: a.org.Entity.Name,
+			Space:        a.space.Entity.Name,
+			Application:  a.app.Entity.Name,
+			Stack:        a.app.Entity.Stack,
+			TotalMemory:  strconv.FormatInt(a.app.totalMemory(), 10),
+		}
+		if opts.DeprecatedStacks.contains(info.Stack) {
+			info.Reasons = append(info.Reasons, newReason(reasonStackDeprecated, "%s is deprecated", info.Stack))
+		}
+		if opts.AttentionOnly && len(info.Reasons) == 0 {
+			continue
+		}
+		allInfo = append(allInfo, info)
+	}
+
+	sortStackUsageInfo(allInfo, opts)
+
+	rerr := renderStackUsageInfo(out, allInfo, opts)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return allInfo, err
+}
+
+// renderStackUsageInfo writes allInfo to out in the format selected by opts
+func renderStackUsageInfo(out io.Writer, allInfo []*stackUsageInfo, opts *Options) error {
+	if opts.OutputPrometheus {
+		err := renderStackPrometheus(out, allInfo, opts)
+		if err != nil {
+			return err
+		}
+		return renderPartialComment(out, opts)
+	}
+
+	if opts.Summary {
+		return renderStackSummary(out, summarizeStackUsageInfo(allInfo, opts), opts)
+	}
+
+	if opts.OutputJSON {
+		return renderJSON(out, allInfo, opts)
+	}
+
+	var rows [][]string
+	for _, info := range allInfo {
+		rows = append(rows, []string{
+			info.Organization,
+			info.Space,
+			info.Application,
+			info.Stack,
+			formatMemory(info.memory(), opts.MemoryUnit),
+			reasonsMessage(info.Reasons),
+		})
+	}
+	return renderRows(out, []string{"Organization", "Space", "Application", "Stack", memoryHeader("Total Memory", opts.MemoryUnit), "Messages"}, rows, opts)
+}
+
+// memory returns TotalMemory as a number of MB
+func (info *stackUsageInfo) memory() int64 {
+	rv, _ := strconv.ParseInt(info.TotalMemory, 10, 64)
+	return rv
+}
+
+// summarizeStackUsageInfo groups allInfo by stack, sorted by name
+func summarizeStackUsageInfo(allInfo []*stackUsageInfo, opts *Options) []*stackSummary {
+	byName := make(map[string]*stackSummary)
+	for _, info := range allInfo {
+		s, found := byName[info.Stack]
+		if !found {
+			s = &stackSummary{
+				Stack:      info.Stack,
+				Deprecated: opts.DeprecatedStacks.contains(info.Stack),
+			}
+			byName[info.Stack] = s
+		}
+		s.Apps++
+		s.TotalMemory += info.memory()
+	}
+
+	var rv []*stackSummary
+	for _, s := range byName {
+		rv = append(rv, s)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Stack < rv[j].Stack
+	})
+	return rv
+}
+
+// renderStackSummary writes summaries to out in the format selected by opts
+func renderStackSummary(out io.Writer, summaries []*stackSummary, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, summaries, opts)
+	}
+
+	var rows [][]string
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			s.Stack,
+			strconv.Itoa(s.Apps),
+			formatMemory(s.TotalMemory, opts.MemoryUnit),
+			strconv.FormatBool(s.Deprecated),
+		})
+	}
+	return renderRows(out, []string{"Stack", "Apps", memoryHeader("Total Memory", opts.MemoryUnit), "Deprecated"}, rows, opts)
+}
@@ -0,0 +1,189 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// standaloneCommands are the commands that can be run without the cf CLI
+var standaloneCommands = stringList{"report-buildpacks", "report-stacks", "report-services", "report-docker", "report-quotas", "report-users", "report-isolation-segments", "report-orphaned-buildpacks", "report-buildpack-order"}
+
+// RunStandalone runs a command without the cf CLI, logging in with the
+// credentials in the environment. args is the command followed by its
+// options, and the command defaults to report-buildpacks.
+func RunStandalone(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"report-buildpacks"}, args...)
+	}
+	if !standaloneCommands.contains(args[0]) {
+		logFatalf("unknown command %q, expected one of %s", args[0], standaloneCommands)
+	}
+
+	Run(newStandaloneConnection(), args)
+}
+
+// standaloneConnection logs in to the API with credentials from the
+// environment, for running without the cf CLI, eg in CI:
+//
+//   - CF_API - the API URL, eg https://api.system.example.com
+//   - CF_USERNAME and CF_PASSWORD - to log in as a user
+//   - CF_REFRESH_TOKEN - to log in with a refresh token, eg from ~/.cf/config.json
+//   - CF_CLIENT_ID and CF_CLIENT_SECRET - to log in as a UAA client
+//   - CF_SKIP_SSL_VALIDATION - if true, don't validate the API's certificate
+type standaloneConnection struct {
+	api      string
+	skipSSL  bool
+	clientID string
+	secret   string
+	username string
+	password string
+
+	// Client - used to request tokens, set by newSimpleClient
+	Client *http.Client
+
+	mu           sync.Mutex
+	tokenURL     string
+	refreshToken string
+}
+
+func newStandaloneConnection() *standaloneConnection {
+	fc := &foundationConfig{
+		API:          os.Getenv("CF_API"),
+		Username:     os.Getenv("CF_USERNAME"),
+		Password:     os.Getenv("CF_PASSWORD"),
+		RefreshToken: os.Getenv("CF_REFRESH_TOKEN"),
+		ClientID:     os.Getenv("CF_CLIENT_ID"),
+		ClientSecret: os.Getenv("CF_CLIENT_SECRET"),
+	}
+	fc.SkipSSLValidation, _ = strconv.ParseBool(os.Getenv("CF_SKIP_SSL_VALIDATION"))
+	return fc.connection()
+}
+
+// withClientCredentials returns a connection to the same API as conn that
+// logs in as a UAA client, eg one with the cloud_controller.admin_read_only
+// authority, rather than as the user conn is logged in as
+func withClientCredentials(conn Connection, clientID, secret string) (*standaloneConnection, error) {
+	api, err := conn.ApiEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	skipSSL, err := conn.IsSSLDisabled()
+	if err != nil {
+		return nil, err
+	}
+	return &standaloneConnection{
+		api:      api,
+		skipSSL:  skipSSL,
+		clientID: clientID,
+		secret:   secret,
+		Client:   http.DefaultClient,
+	}, nil
+}
+
+func (sc *standaloneConnection) ApiEndpoint() (string, error) {
+	if sc.api == "" {
+		// only needed if not reporting on -foundations
+		return "", errors.New("CF_API must be set when not run as a cf CLI plugin")
+	}
+	return sc.api, nil
+}
+
+func (sc *standaloneConnection) IsSSLDisabled() (bool, error) {
+	return sc.skipSSL, nil
+}
+
+// AccessToken logs in, and returns an Authorization header. It is called
+// again when the token expires, and then uses the refresh token if there
+// is one.
+func (sc *standaloneConnection) AccessToken() (string, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.tokenURL == "" {
+		tokenURL, err := sc.findTokenURL()
+		if err != nil {
+			return "", err
+		}
+		sc.tokenURL = tokenURL
+	}
+
+	form := url.Values{}
+	switch {
+	case sc.secret == "" && sc.refreshToken == "" && (sc.username == "" || sc.password == ""):
+		return "", errors.New("CF_USERNAME and CF_PASSWORD, CF_REFRESH_TOKEN, or CF_CLIENT_ID and CF_CLIENT_SECRET must be set when not run as a cf CLI plugin")
+	case sc.refreshToken != "":
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", sc.refreshToken)
+	case sc.secret != "":
+		form.Set("grant_type", "client_credentials")
+	default:
+		form.Set("grant_type", "password")
+		form.Set("username", sc.username)
+		form.Set("password", sc.password)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sc.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(sc.clientID, sc.secret)
+	resp, err := sc.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("logging in: %s", newAPIError(http.MethodPost, sc.tokenURL, resp))
+	}
+
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("logging in: %s", err)
+	}
+	if token.RefreshToken != "" {
+		sc.refreshToken = token.RefreshToken
+	}
+	return "bearer " + token.AccessToken, nil
+}
+
+// findTokenURL looks up the UAA token endpoint from the API's root
+func (sc *standaloneConnection) findTokenURL() (string, error) {
+	resp, err := sc.Client.Get(sc.api + "/")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", newAPIError(http.MethodGet, sc.api+"/", resp)
+	}
+
+	var root struct {
+		Links struct {
+			UAA struct {
+				Href string `json:"href"`
+			} `json:"uaa"`
+		} `json:"links"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&root)
+	if err != nil {
+		return "", err
+	}
+	if root.Links.UAA.Href == "" {
+		return "", fmt.Errorf("%s does not link to a UAA to log in with", sc.api)
+	}
+	return strings.TrimSuffix(root.Links.UAA.Href, "/") + "/oauth/token", nil
+}
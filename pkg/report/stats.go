@@ -0,0 +1,113 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runStats counts the API requests made by a run, and the resources it
+// found, for -stats. Its methods do nothing if it is nil, so clients need
+// not check whether -stats is set.
+type runStats struct {
+	start time.Time
+
+	requests    int64
+	retries     int64
+	rateLimited int64
+
+	mu     sync.Mutex
+	orgs   int
+	spaces int
+	apps   int
+
+	// phases - time spent in each phase of collecting, summed over
+	// foundations, in the order they were first started
+	phases     map[string]time.Duration
+	phaseOrder []string
+}
+
+func newRunStats() *runStats {
+	return &runStats{start: time.Now(), phases: make(map[string]time.Duration)}
+}
+
+func (rs *runStats) request() {
+	if rs != nil {
+		atomic.AddInt64(&rs.requests, 1)
+	}
+}
+
+func (rs *runStats) retry() {
+	if rs != nil {
+		atomic.AddInt64(&rs.retries, 1)
+	}
+}
+
+func (rs *runStats) rateLimit() {
+	if rs != nil {
+		atomic.AddInt64(&rs.rateLimited, 1)
+	}
+}
+
+// found adds to the numbers of orgs, spaces and apps found
+func (rs *runStats) found(orgs, spaces, apps int) {
+	if rs == nil {
+		return
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.orgs += orgs
+	rs.spaces += spaces
+	rs.apps += apps
+}
+
+// phase starts timing the named phase, and returns a func to call when it
+// ends
+func (rs *runStats) phase(name string) func() {
+	if rs == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+		if _, found := rs.phases[name]; !found {
+			rs.phaseOrder = append(rs.phaseOrder, name)
+		}
+		rs.phases[name] += time.Since(start)
+	}
+}
+
+// log logs the statistics, with each as a field for -log-format json
+func (rs *runStats) log() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	elapsed := time.Since(rs.start)
+	requests := atomic.LoadInt64(&rs.requests)
+	retries := atomic.LoadInt64(&rs.retries)
+	rateLimited := atomic.LoadInt64(&rs.rateLimited)
+
+	phaseFields := make(map[string]float64)
+	var phases []string
+	for _, name := range rs.phaseOrder {
+		d := rs.phases[name]
+		phaseFields[name] = d.Seconds()
+		phases = append(phases, fmt.Sprintf("%s %s", name, d.Round(time.Millisecond)))
+	}
+
+	fields := logFields{
+		"requests":     requests,
+		"retries":      retries,
+		"rate_limited": rateLimited,
+		"orgs":         rs.orgs,
+		"spaces":       rs.spaces,
+		"apps":         rs.apps,
+		"elapsed":      elapsed.Seconds(),
+		"phases":       phaseFields,
+	}
+	logf(levelInfo, fields, "%d API requests, %d retries, %d rate limited, %d orgs, %d spaces and %d apps in %s (%s)",
+		requests, retries, rateLimited, rs.orgs, rs.spaces, rs.apps, elapsed.Round(time.Millisecond), strings.Join(phases, ", "))
+}
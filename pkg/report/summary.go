@@ -0,0 +1,140 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Names summaries use for apps without any known buildpack
+const (
+	noBuildpack     = "(none)"
+	dockerBuildpack = "(docker)"
+)
+
+// buildpackSummary aggregates usage information for all apps using a buildpack
+type buildpackSummary struct {
+	Buildpack      string `json:"buildpack"`
+	Apps           int    `json:"apps"`
+	Organizations  int    `json:"organizations"`
+	Spaces         int    `json:"spaces"`
+	TotalMemory    int64  `json:"total_memory"`
+	NeedsAttention int    `json:"needs_attention"`
+
+	orgs   map[string]bool
+	spaces map[string]bool
+}
+
+// summaryNames returns the names of the buildpacks the app in info is
+// counted against in summaries, standing in for docker apps and apps without
+// buildpacks
+func summaryNames(info *AppBuildpackInfo) []string {
+	if len(info.BuildpackNames) != 0 {
+		return info.BuildpackNames
+	}
+	if info.Lifecycle == lifecycleDocker {
+		return []string{dockerBuildpack}
+	}
+	return []string{noBuildpack}
+}
+
+// summarizeUsageInfo groups allInfo by buildpack name, sorted by name. Apps
+// staged with multiple buildpacks count towards each of them.
+func summarizeUsageInfo(allInfo []*AppBuildpackInfo) []*buildpackSummary {
+	byName := make(map[string]*buildpackSummary)
+	for _, info := range allInfo {
+		memory := info.memory()
+		for _, name := range summaryNames(info) {
+			s, found := byName[name]
+			if !found {
+				s = &buildpackSummary{
+					Buildpack: name,
+					orgs:      make(map[string]bool),
+					spaces:    make(map[string]bool),
+				}
+				byName[name] = s
+			}
+			s.Apps++
+			s.TotalMemory += memory
+			if info.needsAttention() {
+				s.NeedsAttention++
+			}
+			s.orgs[info.Foundation+"/"+info.Organization] = true
+			s.spaces[info.Foundation+"/"+info.Organization+"/"+info.Space] = true
+			s.Organizations = len(s.orgs)
+			s.Spaces = len(s.spaces)
+		}
+	}
+
+	var rv []*buildpackSummary
+	for _, s := range byName {
+		rv = append(rv, s)
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Buildpack < rv[j].Buildpack
+	})
+	return rv
+}
+
+// renderSummary writes summaries to out in the format selected by opts
+func renderSummary(out io.Writer, summaries []*buildpackSummary, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, summaries, opts)
+	}
+
+	var rows [][]string
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			s.Buildpack,
+			strconv.Itoa(s.Apps),
+			strconv.Itoa(s.Organizations),
+			strconv.Itoa(s.Spaces),
+			formatMemory(s.TotalMemory, opts.MemoryUnit),
+			strconv.Itoa(s.NeedsAttention),
+		})
+	}
+	return renderRows(out, []string{"Buildpack", "Apps", "Organizations", "Spaces", memoryHeader("Total Memory", opts.MemoryUnit), "Needs Attention"}, rows, opts)
+}
+
+// renderTotals writes a table of the apps and memory for each buildpack in
+// allInfo, with the totals for all apps as a footer, to follow the table of
+// apps. Apps staged with multiple buildpacks count towards each of them, but
+// only once towards the totals.
+func renderTotals(out io.Writer, allInfo []*AppBuildpackInfo, opts *Options) error {
+	var rows [][]string
+	for _, s := range summarizeUsageInfo(allInfo) {
+		rows = append(rows, []string{s.Buildpack, strconv.Itoa(s.Apps), formatMemory(s.TotalMemory, opts.MemoryUnit)})
+	}
+	var memory int64
+	for _, info := range allInfo {
+		memory += info.memory()
+	}
+
+	_, err := fmt.Fprintln(out)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Buildpack", "Apps", memoryHeader("Total Memory", opts.MemoryUnit)})
+	table.AppendBulk(rows)
+	table.SetFooter([]string{"Total", strconv.Itoa(len(allInfo)), formatMemory(memory, opts.MemoryUnit)})
+	table.Render()
+	return nil
+}
+
+// summaryCharts returns charts of app count, apps needing attention and
+// memory for each buildpack in summaries
+func summaryCharts(summaries []*buildpackSummary) []*htmlChart {
+	apps := &htmlChart{Title: "Apps per buildpack"}
+	attention := &htmlChart{Title: "Apps needing attention per buildpack"}
+	memory := &htmlChart{Title: "Total memory (MB) per buildpack"}
+	for _, s := range summaries {
+		apps.Bars = append(apps.Bars, htmlBar{Label: s.Buildpack, Value: int64(s.Apps)})
+		attention.Bars = append(attention.Bars, htmlBar{Label: s.Buildpack, Value: int64(s.NeedsAttention)})
+		memory.Bars = append(memory.Bars, htmlBar{Label: s.Buildpack, Value: s.TotalMemory})
+	}
+	return []*htmlChart{apps, attention, memory}
+}
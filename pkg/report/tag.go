@@ -0,0 +1,81 @@
+package report
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// tagPrefix namespaces the annotations written by -tag-apps
+const tagPrefix = "report-buildpacks/"
+
+// Values of the status annotation written by -tag-apps
+const (
+	tagStatusOK        = "ok"
+	tagStatusOutdated  = "outdated"
+	tagStatusDeploying = "deploying"
+	tagStatusAttention = "needs-attention"
+)
+
+// tagStatus summarizes the findings for an app as the value of its status
+// annotation
+func (info *AppBuildpackInfo) tagStatus() string {
+	switch {
+	case !info.needsAttention():
+		return tagStatusOK
+	case info.inFlight():
+		return tagStatusDeploying
+	case info.needsRestage():
+		return tagStatusOutdated
+	default:
+		return tagStatusAttention
+	}
+}
+
+// tagAnnotations returns the annotations recording the findings for an app,
+// checked at checkedAt
+func (info *AppBuildpackInfo) tagAnnotations(checkedAt time.Time) map[string]string {
+	var codes []string
+	for _, r := range info.Reasons {
+		if !stringList(codes).contains(r.Code) {
+			codes = append(codes, r.Code)
+		}
+	}
+	// an empty value removes an annotation, so reasons no longer found
+	// are cleared
+	return map[string]string{
+		tagPrefix + "status":     info.tagStatus(),
+		tagPrefix + "reasons":    strings.Join(codes, ","),
+		tagPrefix + "checked-at": checkedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// tagApps writes the findings for each app in allInfo onto it as
+// annotations, with at most workers requests at once
+func tagApps(fd Client, allInfo []*AppBuildpackInfo, checkedAt time.Time, workers int) error {
+	errs := make([]error, len(allInfo))
+	err := parallel(workers, len(allInfo), func(i int) error {
+		info := allInfo[i]
+		errs[i] = fd.Annotate(info.AppGUID, info.tagAnnotations(checkedAt))
+		if errs[i] != nil {
+			logf(levelError, nil, "failed to tag %s: %s", info.name(), errs[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d apps failed to be tagged", failed, len(allInfo))
+	}
+	log.Printf("tagged %d apps", len(allInfo))
+	return nil
+}
@@ -0,0 +1,66 @@
+package report
+
+import "errors"
+
+// Target is the org, and space if any, that the cf CLI is targeting
+type Target struct {
+	OrgGuid   string
+	OrgName   string
+	SpaceGuid string
+	SpaceName string
+}
+
+// TargetConnection is a Connection that knows which org and space the cf CLI
+// is targeting, as needed by -current
+type TargetConnection interface {
+	Connection
+	CurrentTarget() (*Target, error)
+}
+
+// currentTarget returns the target of conn, which must be a TargetConnection
+// targeting an org
+func currentTarget(conn Connection) (*Target, error) {
+	tc, ok := conn.(TargetConnection)
+	if !ok {
+		return nil, errors.New("-current can only be used when run as a cf CLI plugin")
+	}
+	t, err := tc.CurrentTarget()
+	if err != nil {
+		return nil, err
+	}
+	if t.OrgGuid == "" {
+		return nil, errors.New("no org is targeted, run 'cf target -o ORG' first")
+	}
+	return t, nil
+}
+
+// targetFoundation only reports on the targeted org and space, fetching them
+// directly rather than listing all the orgs and spaces the user can see
+type targetFoundation struct {
+	Client
+	target *Target
+}
+
+func (tf *targetFoundation) Orgs(f func(*Resource) error) error {
+	org, err := tf.Client.Org(tf.target.OrgGuid)
+	if err != nil {
+		return err
+	}
+	return f(org)
+}
+
+func (tf *targetFoundation) Spaces(org *Resource, f func(*Resource) error) error {
+	if tf.target.SpaceGuid == "" {
+		return tf.Client.Spaces(org, f)
+	}
+	space, err := tf.Client.Space(org, tf.target.SpaceGuid)
+	if err != nil {
+		return err
+	}
+	return f(space)
+}
+
+// AllApps is unsupported, as it would list apps outside the target
+func (tf *targetFoundation) AllApps(f func(org, space, app *Resource) error) error {
+	return errAllAppsUnsupported
+}
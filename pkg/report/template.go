@@ -0,0 +1,61 @@
+package report
+
+import (
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateReport is the data -output-template is executed with
+type templateReport struct {
+	GeneratedAt time.Time
+	API         string
+	Partial     string
+	Rows        []*AppBuildpackInfo
+	Summary     []*buildpackSummary
+}
+
+// templateFuncs are the functions available to -output-template, in
+// addition to text/template's own
+func templateFuncs(opts *Options) template.FuncMap {
+	return template.FuncMap{
+		"join": func(sep string, values []string) string {
+			return strings.Join(values, sep)
+		},
+		"memory": func(mb int64) string {
+			return formatMemory(mb, opts.MemoryUnit)
+		},
+		"needsAttention": func(info *AppBuildpackInfo) bool {
+			return info.needsAttention()
+		},
+		"needsRestage": func(info *AppBuildpackInfo) bool {
+			return info.needsRestage()
+		},
+	}
+}
+
+// parseOutputTemplate parses the -output-template option, which is either
+// the name of a file containing the template or the template itself
+func parseOutputTemplate(v string, opts *Options) (*template.Template, error) {
+	text := v
+	if b, err := os.ReadFile(v); err == nil {
+		text = string(b)
+	}
+	return template.New("output-template").Funcs(templateFuncs(opts)).Parse(text)
+}
+
+// renderTemplate writes allInfo to out through opts.OutputTemplate, eg
+//
+//	{{range .Rows}}{{if needsRestage .}}cf restage {{.Application}}
+//	{{end}}{{end}}
+func renderTemplate(out io.Writer, allInfo []*AppBuildpackInfo, opts *Options) error {
+	return opts.OutputTemplate.Execute(out, &templateReport{
+		GeneratedAt: time.Now().UTC(),
+		API:         opts.API,
+		Partial:     opts.Partial,
+		Rows:        allInfo,
+		Summary:     summarizeUsageInfo(allInfo),
+	})
+}
@@ -0,0 +1,109 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceDest is where request/response traces are written: "" or "false" to
+// disable, "true" for stderr, or a path to a file to append to. As with
+// CF_TRACE it may be given as a bare -trace to write to stderr.
+type traceDest string
+
+func (td *traceDest) String() string {
+	return string(*td)
+}
+
+func (td *traceDest) Set(s string) error {
+	*td = traceDest(s)
+	return nil
+}
+
+// IsBoolFlag allows -trace to be given without a value
+func (td *traceDest) IsBoolFlag() bool {
+	return true
+}
+
+// open returns the writer for traces, or nil if tracing is disabled
+func (td traceDest) open() (io.Writer, error) {
+	switch strings.ToLower(string(td)) {
+	case "", "false":
+		return nil, nil
+	case "true":
+		return os.Stderr, nil
+	}
+	return os.OpenFile(string(td), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+}
+
+// tracingTransport dumps each request and response, with the Authorization
+// header redacted, to Out
+type tracingTransport struct {
+	Transport http.RoundTripper
+	Out       io.Writer
+
+	// mu stops dumps from concurrent requests being interleaved
+	mu sync.Mutex
+}
+
+func (tt *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return nil, err
+	}
+	tt.write("REQUEST", req, dump)
+
+	resp, err := tt.Transport.RoundTrip(req)
+	if err != nil {
+		tt.write("RESPONSE", req, []byte(err.Error()+"\n"))
+		return nil, err
+	}
+	dump, err = httputil.DumpResponse(resp, true)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	tt.write("RESPONSE", req, dump)
+	return resp, nil
+}
+
+// write dumps a request or response, labelled with the request it is for as
+// responses to concurrent requests may arrive in any order
+func (tt *tracingTransport) write(kind string, req *http.Request, dump []byte) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	fmt.Fprintf(tt.Out, "%s: [%s] %s %s\n%s\n\n", kind, time.Now().Format(time.RFC3339), req.Method, req.URL, redactAuthorization(dump))
+}
+
+// redactAuthorization hides the value of any Authorization header in dump
+func redactAuthorization(dump []byte) []byte {
+	lines := bytes.Split(dump, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.ToLower(line), []byte("authorization:")) {
+			lines[i] = []byte("Authorization: [PRIVATE DATA HIDDEN]\r")
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// Trace makes the client dump every request and response to w
+func (sc *simpleClient) Trace(w io.Writer) {
+	transport := http.DefaultTransport
+	if sc.Client != nil && sc.Client.Transport != nil {
+		transport = sc.Client.Transport
+	}
+	timeout := time.Duration(0)
+	if sc.Client != nil {
+		timeout = sc.Client.Timeout
+	}
+	sc.Client = &http.Client{
+		Transport: &tracingTransport{Transport: transport, Out: w},
+		Timeout:   timeout,
+	}
+}
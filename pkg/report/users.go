@@ -0,0 +1,104 @@
+package report
+
+import "io"
+
+// userRoleInfo is a role a user has in an org, or in a space if Space is set
+type userRoleInfo struct {
+	Organization string `json:"organization"`
+	Space        string `json:"space,omitempty"`
+	Role         string `json:"role"`
+	Username     string `json:"username"`
+}
+
+// reportUsers lists the roles users have in every org and space selected by
+// opts, renders them to out and returns the rows reported on
+func (c *reportBuildpacks) reportUsers(client *simpleClient, fd Client, out io.Writer, opts *Options) ([]*userRoleInfo, error) {
+	allInfo, err := collectUserRoleInfo(client, fd, opts)
+	if err == ErrInterrupted {
+		opts.Partial = partialNote
+	} else if err != nil {
+		return nil, err
+	}
+
+	sortUserRoleInfo(allInfo, opts)
+
+	rerr := renderUserRoleInfo(out, allInfo, opts)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	return allInfo, err
+}
+
+// collectUserRoleInfo lists the roles in every org and space selected by
+// opts. If client.Context is done before all are listed it returns the roles
+// listed so far and ErrInterrupted.
+func collectUserRoleInfo(client *simpleClient, fd Client, opts *Options) ([]*userRoleInfo, error) {
+	defer client.phase("users")()
+
+	orgs, err := walkOrgs(client, fd, opts)
+	if err != nil {
+		return nil, err
+	}
+	orgRoles := make([][]*Role, len(orgs))
+	err = client.Parallel(len(orgs), func(i int) error {
+		roles, err := fd.OrgRoles(orgs[i])
+		if err != nil && !isPermissionDenied(err) {
+			return err
+		}
+		orgRoles[i] = roles
+		return nil
+	})
+	err = interruptedOr(client, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var allInfo []*userRoleInfo
+	for i, roles := range orgRoles {
+		for _, r := range roles {
+			allInfo = append(allInfo, &userRoleInfo{Organization: orgs[i].Entity.Name, Role: r.Type, Username: r.Username})
+		}
+	}
+
+	spaces, err := orgSpaces(client, fd, opts, orgs)
+	if err == ErrInterrupted {
+		return allInfo, err
+	} else if err != nil {
+		return nil, err
+	}
+	spaceRoles := make([][]*Role, len(spaces))
+	err = client.Parallel(len(spaces), func(i int) error {
+		roles, err := fd.SpaceRoles(spaces[i].space)
+		if err != nil && !isPermissionDenied(err) {
+			return err
+		}
+		spaceRoles[i] = roles
+		return nil
+	})
+	// if interrupted, the spaces listed so far are still returned
+	err = interruptedOr(client, err)
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	for i, roles := range spaceRoles {
+		for _, r := range roles {
+			allInfo = append(allInfo, &userRoleInfo{Organization: spaces[i].org.Entity.Name, Space: spaces[i].space.Entity.Name, Role: r.Type, Username: r.Username})
+		}
+	}
+	return allInfo, err
+}
+
+// renderUserRoleInfo writes allInfo to out in the format selected by opts
+func renderUserRoleInfo(out io.Writer, allInfo []*userRoleInfo, opts *Options) error {
+	if opts.OutputJSON {
+		return renderJSON(out, allInfo, opts)
+	}
+
+	var rows [][]string
+	for _, info := range allInfo {
+		rows = append(rows, []string{info.Organization, info.Space, info.Role, info.Username})
+	}
+	return renderRows(out, []string{"Organization", "Space", "Role", "Username"}, rows, opts)
+}
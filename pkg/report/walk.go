@@ -0,0 +1,296 @@
+package report
+
+import (
+	"net/http"
+	"sync"
+)
+
+// appStateStarted is the state of apps that are meant to be running
+const appStateStarted = "STARTED"
+
+// defaultExcludedOrgs are the orgs left out of reports unless -exclude-orgs
+// or -include-system is given, as their apps are managed by the platform or
+// service brokers rather than app teams
+var defaultExcludedOrgs = stringList{"system", "p-spring-cloud-services", "p-dataflow"}
+
+// spaceInOrg is a space, along with the org that contains it
+type spaceInOrg struct {
+	org, space *Resource
+}
+
+// appInSpace is an app, along with the space and org that contain it
+type appInSpace struct {
+	spaceInOrg
+	app *Resource
+
+	// metadata - the app's labels and annotations, if -label-selector or
+	// -metadata-columns is set
+	metadata *AppMetadata
+}
+
+// inaccessibleCounts counts the orgs and spaces skipped because the user
+// isn't permitted to read them, by kind
+type inaccessibleCounts struct {
+	mu     sync.Mutex
+	byKind map[string]int
+}
+
+// inaccessibleCounts returns the client's counts, creating them if need be
+func (client *simpleClient) inaccessibleCounts() *inaccessibleCounts {
+	client.inaccessibleMu.Lock()
+	defer client.inaccessibleMu.Unlock()
+	if client.inaccessible == nil {
+		client.inaccessible = &inaccessibleCounts{byKind: make(map[string]int)}
+	}
+	return client.inaccessible
+}
+
+// skipInaccessible warns that the kind of resource r is skipped because err
+// shows the user isn't permitted to read it, and counts it for
+// logInaccessible
+func (client *simpleClient) skipInaccessible(kind string, r *Resource, err error) {
+	logf(levelWarn, logFields{kind: r.Entity.Name, "guid": r.Metadata.Guid}, "skipping %s %s: %s", kind, r.Entity.Name, err)
+	counts := client.inaccessibleCounts()
+	counts.mu.Lock()
+	defer counts.mu.Unlock()
+	counts.byKind[kind]++
+}
+
+// logInaccessible summarizes the orgs and spaces skipped by skipInaccessible,
+// if any, so that a report missing them isn't mistaken for a complete one
+func (client *simpleClient) logInaccessible() {
+	counts := client.inaccessibleCounts()
+	counts.mu.Lock()
+	defer counts.mu.Unlock()
+	orgs, spaces := counts.byKind["org"], counts.byKind["space"]
+	if orgs == 0 && spaces == 0 {
+		return
+	}
+	logf(levelWarn, logFields{"inaccessible_orgs": orgs, "inaccessible_spaces": spaces},
+		"%d orgs and %d spaces were skipped as the user isn't permitted to read them, so the report is incomplete", orgs, spaces)
+}
+
+// walkOrgs lists the orgs selected by opts
+func walkOrgs(client *simpleClient, fd Client, opts *Options) ([]*Resource, error) {
+	var orgs []*Resource
+	err := fd.Orgs(func(org *Resource) error {
+		if len(opts.Orgs) != 0 && !opts.Orgs.contains(org.Entity.Name) {
+			return nil
+		}
+		// orgs named by -org are reported even if excluded
+		if opts.ExcludeOrgs.contains(org.Entity.Name) && !opts.Orgs.contains(org.Entity.Name) {
+			return nil
+		}
+		orgs = append(orgs, org)
+		return nil
+	})
+	if err != nil {
+		return nil, interruptedOr(client, err)
+	}
+	return orgs, nil
+}
+
+// walkSpaces lists all spaces in the orgs and spaces selected by opts
+func walkSpaces(client *simpleClient, fd Client, opts *Options) ([]spaceInOrg, error) {
+	orgs, err := walkOrgs(client, fd, opts)
+	if err != nil {
+		return nil, err
+	}
+	return orgSpaces(client, fd, opts, orgs)
+}
+
+// orgSpaces lists the spaces selected by opts in orgs
+func orgSpaces(client *simpleClient, fd Client, opts *Options, orgs []*Resource) ([]spaceInOrg, error) {
+	// list spaces for each org in parallel. Results are stored by index so that output order matches the order
+	// the API returned them in, regardless of which request finishes first.
+	spacesByOrg := make([][]*Resource, len(orgs))
+	err := client.Parallel(len(orgs), func(i int) (err error) {
+		span := client.Tracer.start("org", resourceAttributes("org", orgs[i])...)
+		defer func() { span.finish(err) }()
+		var spaces []*Resource
+		err = fd.Spaces(orgs[i], func(space *Resource) error {
+			if len(opts.Spaces) != 0 && !opts.Spaces.contains(space.Entity.Name) {
+				return nil
+			}
+			if opts.Resume != nil && opts.Resume.done(space.Metadata.Guid) {
+				return nil
+			}
+			spaces = append(spaces, space)
+			return nil
+		})
+		if isPermissionDenied(err) {
+			client.skipInaccessible("org", orgs[i], err)
+			return nil
+		}
+		spacesByOrg[i] = spaces
+		return err
+	})
+	if err != nil {
+		return nil, interruptedOr(client, err)
+	}
+
+	var spaces []spaceInOrg
+	for i, ss := range spacesByOrg {
+		for _, space := range ss {
+			spaces = append(spaces, spaceInOrg{org: orgs[i], space: space})
+		}
+	}
+	client.Stats.found(len(orgs), len(spaces), 0)
+
+	return spaces, nil
+}
+
+// walkApps lists all apps in the orgs and spaces selected by opts. If
+// client.Context is done before all apps are listed it returns the apps
+// listed so far and ErrInterrupted.
+func walkApps(client *simpleClient, fd Client, opts *Options) ([]appInSpace, error) {
+	defer client.phase("apps")()
+
+	apps, err := []appInSpace(nil), errAllAppsUnsupported
+	if len(opts.Orgs) == 0 && len(opts.Spaces) == 0 {
+		apps, err = allApps(client, fd, opts)
+	}
+	if err == errAllAppsUnsupported {
+		apps, err = spaceApps(client, fd, opts)
+	}
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	if !opts.LabelSelector.empty() || len(opts.MetadataColumns) != 0 {
+		var merr error
+		apps, merr = selectApps(client, fd, opts, apps)
+		if merr != nil && merr != ErrInterrupted {
+			return nil, merr
+		}
+		if merr != nil {
+			err = merr
+		}
+	}
+	client.Stats.found(0, 0, len(apps))
+
+	return apps, err
+}
+
+// selectsApp returns true if app passes the filters in opts
+func (opts *Options) selectsApp(app *Resource) bool {
+	switch {
+	case !opts.IncludeStopped && app.Entity.State != appStateStarted:
+		return false
+	case opts.ExcludeDocker && app.Entity.Lifecycle == lifecycleDocker:
+		return false
+	case app.totalMemory() < opts.MinMemory:
+		return false
+	case opts.AppFilter != nil && !opts.AppFilter.MatchString(app.Entity.Name):
+		return false
+	case opts.ExcludeApp != nil && opts.ExcludeApp.MatchString(app.Entity.Name):
+		return false
+	}
+	return true
+}
+
+// allApps lists the apps selected by opts with Client.AllApps, which is only
+// used when all orgs and spaces are reported. It returns
+// errAllAppsUnsupported if the apps must be listed space by space instead.
+func allApps(client *simpleClient, fd Client, opts *Options) ([]appInSpace, error) {
+	orgs := make(map[string]bool)
+	spaces := make(map[string]bool)
+	var apps []appInSpace
+	err := fd.AllApps(func(org, space, app *Resource) error {
+		if opts.ExcludeOrgs.contains(org.Entity.Name) {
+			return nil
+		}
+		if opts.Resume != nil && opts.Resume.done(space.Metadata.Guid) {
+			return nil
+		}
+		orgs[org.Metadata.Guid] = true
+		spaces[space.Metadata.Guid] = true
+		if opts.selectsApp(app) {
+			apps = append(apps, appInSpace{spaceInOrg: spaceInOrg{org: org, space: space}, app: app})
+		}
+		return nil
+	})
+	if err == errAllAppsUnsupported {
+		return nil, err
+	}
+	if ae, ok := err.(*apiError); ok && (ae.StatusCode == http.StatusBadRequest || ae.StatusCode == http.StatusNotFound) {
+		// older APIs reject the inline relations or includes, and proxies
+		// in front of the API may not pass the listings through
+		logf(levelWarn, nil, "listing all apps at once failed, listing them space by space instead: %s", err)
+		return nil, errAllAppsUnsupported
+	}
+	// if interrupted, the apps listed so far are still returned
+	err = interruptedOr(client, err)
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+	client.Stats.found(len(orgs), len(spaces), 0)
+	return apps, err
+}
+
+// spaceApps lists the orgs and spaces selected by opts, and then the apps
+// selected by opts in each space
+func spaceApps(client *simpleClient, fd Client, opts *Options) ([]appInSpace, error) {
+	spaces, err := walkSpaces(client, fd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// list apps for each space in parallel, stored by index as spaces are
+	appsBySpace := make([][]*Resource, len(spaces))
+	err = client.Parallel(len(spaces), func(i int) (err error) {
+		span := client.Tracer.start("space", spaces[i].attributes()...)
+		defer func() { span.finish(err) }()
+		var apps []*Resource
+		err = fd.Apps(spaces[i].space, func(app *Resource) error {
+			if opts.selectsApp(app) {
+				apps = append(apps, app)
+			}
+			return nil
+		})
+		if isPermissionDenied(err) {
+			client.skipInaccessible("space", spaces[i].space, err)
+			return nil
+		}
+		appsBySpace[i] = apps
+		return err
+	})
+	// if interrupted, the spaces listed so far are still returned
+	err = interruptedOr(client, err)
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	var apps []appInSpace
+	for i, as := range appsBySpace {
+		for _, app := range as {
+			apps = append(apps, appInSpace{spaceInOrg: spaces[i], app: app})
+		}
+	}
+	return apps, err
+}
+
+// selectApps looks up the metadata of apps, and returns those matching
+// opts.LabelSelector. If client.Context is done before all are looked up, it
+// returns the matching apps looked up so far and ErrInterrupted.
+func selectApps(client *simpleClient, fd Client, opts *Options, apps []appInSpace) ([]appInSpace, error) {
+	err := client.Parallel(len(apps), func(i int) (err error) {
+		apps[i].metadata, err = fd.AppMetadata(apps[i].app)
+		if isPermissionDenied(err) {
+			apps[i].metadata, err = &AppMetadata{}, nil
+		}
+		return err
+	})
+	err = interruptedOr(client, err)
+	if err != nil && err != ErrInterrupted {
+		return nil, err
+	}
+
+	var rv []appInSpace
+	for _, a := range apps {
+		if a.metadata != nil && opts.LabelSelector.matches(a.metadata) {
+			rv = append(rv, a)
+		}
+	}
+	return rv, err
+}
@@ -0,0 +1,110 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchTimeFormat is used to name the files -watch writes to a directory
+const watchTimeFormat = "20060102T150405Z"
+
+// watchOptions controls where -watch saves each report
+type watchOptions struct {
+	// Interval - how often the report is collected
+	Interval time.Duration
+
+	// Output - a directory to write a file per report to, or a file to append
+	// a line per report to
+	Output string
+
+	// MaxSize - size in MB at which the file Output is rotated
+	MaxSize int64
+
+	// Keep - number of rotated files to keep
+	Keep int
+}
+
+// watchRecord is a line appended to a -watch file
+type watchRecord struct {
+	CollectedAt time.Time           `json:"collected_at"`
+	Apps        []*AppBuildpackInfo `json:"apps"`
+}
+
+// watchReports collects the report every interval and saves it as set by
+// wopts, until saving fails. If onReport is not nil, it is called with each
+// report once it is saved.
+func watchReports(client *simpleClient, fd Client, opts *Options, wopts *watchOptions, onReport func([]*AppBuildpackInfo)) error {
+	for {
+		start := time.Now().UTC()
+		allInfo, err := collectUsageInfo(client, fd, opts, nil)
+		if err != nil {
+			// keep going, the next run may well succeed
+			logf(levelError, nil, "error collecting report: %s", err)
+		} else {
+			Sort(allInfo, opts)
+			err = saveWatchReport(start, allInfo, wopts)
+			if err != nil {
+				return err
+			}
+			if onReport != nil {
+				onReport(allInfo)
+			}
+		}
+		time.Sleep(time.Until(start.Add(wopts.Interval)))
+	}
+}
+
+// saveWatchReport writes allInfo to a new file in wopts.Output if it is a
+// directory, and otherwise appends it to wopts.Output
+func saveWatchReport(collectedAt time.Time, allInfo []*AppBuildpackInfo, wopts *watchOptions) error {
+	fi, err := os.Stat(wopts.Output)
+	if err == nil && fi.IsDir() {
+		af, err := createAtomicFile(filepath.Join(wopts.Output, fmt.Sprintf("report-%s.json", collectedAt.Format(watchTimeFormat))))
+		if err != nil {
+			return err
+		}
+		err = json.NewEncoder(af).Encode(allInfo)
+		if err != nil {
+			af.Abort()
+			return err
+		}
+		return af.Commit()
+	}
+
+	if err == nil && fi.Size() >= wopts.MaxSize<<20 {
+		err = rotateFile(wopts.Output, wopts.Keep)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(wopts.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(f).Encode(&watchRecord{CollectedAt: collectedAt, Apps: allInfo})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotateFile renames path to path.1, path.1 to path.2 and so on, removing
+// any beyond path.keep
+func rotateFile(path string, keep int) error {
+	if keep < 1 {
+		return os.Remove(path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", path, keep))
+	for i := keep - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
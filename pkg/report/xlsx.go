@@ -0,0 +1,250 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxSheet is a worksheet of a workbook written by -output-xlsx. Cells are
+// strings, or int64s to be numbers Excel can sum.
+type xlsxSheet struct {
+	name   string
+	header []string
+	rows   [][]interface{}
+}
+
+// xlsxSheetName returns name as a valid sheet name, which must be at most
+// 31 characters without []:*?/\, and distinct from the names in used
+func xlsxSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "_"
+	}
+	rv := name
+	for i := 2; ; i++ {
+		if len([]rune(rv)) > 31 {
+			suffix := strings.TrimPrefix(rv, name)
+			rv = string([]rune(name)[:31-len(suffix)]) + suffix
+		}
+		if !used[strings.ToLower(rv)] {
+			used[strings.ToLower(rv)] = true
+			return rv
+		}
+		rv = fmt.Sprintf("%s (%d)", name, i)
+	}
+}
+
+// xlsxColumn returns the letters of the ith column, eg A, B, ... Z, AA
+func xlsxColumn(i int) string {
+	rv := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		rv = string(rune('A'+(i-1)%26)) + rv
+	}
+	return rv
+}
+
+// usageSheets returns a summary sheet of allInfo by buildpack, then a sheet
+// of the apps in each org
+func usageSheets(allInfo []*AppBuildpackInfo) []*xlsxSheet {
+	used := make(map[string]bool)
+	summary := &xlsxSheet{
+		name:   xlsxSheetName("Summary", used),
+		header: []string{"Buildpack", "Apps", "Organizations", "Spaces", "Total Memory (MB)", "Needs Attention"},
+	}
+	for _, s := range summarizeUsageInfo(allInfo) {
+		summary.rows = append(summary.rows, []interface{}{s.Buildpack, int64(s.Apps), int64(s.Organizations), int64(s.Spaces), s.TotalMemory, int64(s.NeedsAttention)})
+	}
+	sheets := []*xlsxSheet{summary}
+
+	foundations := hasFoundation(allInfo)
+	byOrg := make(map[appKey]*xlsxSheet)
+	for _, info := range allInfo {
+		k := appKey{foundation: info.Foundation, org: info.Organization}
+		sheet, found := byOrg[k]
+		if !found {
+			name := info.Organization
+			if foundations {
+				name = info.Foundation + " " + name
+			}
+			sheet = &xlsxSheet{
+				name:   xlsxSheetName(name, used),
+				header: []string{"Space", "Application", "App State", "Stack", "Buildpacks", "Custom Buildpack", "Docker Image", "Total Memory (MB)", "Last Staged", "Messages"},
+			}
+			byOrg[k] = sheet
+			sheets = append(sheets, sheet)
+		}
+		sheet.rows = append(sheet.rows, []interface{}{
+			info.Space,
+			info.Application,
+			info.State,
+			info.Stack,
+			info.buildpackList(),
+			customBuildpacksMessage(info.CustomBuildpacks),
+			info.DockerImage,
+			info.memory(),
+			info.lastStaged(),
+			info.messages(),
+		})
+	}
+	return sheets
+}
+
+// writeXLSX writes allInfo to path as an Excel workbook, with a summary
+// sheet and a sheet per org, each with a frozen header and auto-filter
+func writeXLSX(path string, allInfo []*AppBuildpackInfo) error {
+	af, err := createAtomicFile(path)
+	if err != nil {
+		return err
+	}
+	err = renderXLSX(af, usageSheets(allInfo))
+	if err != nil {
+		af.Abort()
+		return err
+	}
+	return af.Commit()
+}
+
+// renderXLSX writes sheets to out as an Office Open XML workbook
+func renderXLSX(out io.Writer, sheets []*xlsxSheet) error {
+	zw := zip.NewWriter(out)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", []byte(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`)},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", []byte(xml.Header + xlsxStyles)},
+	}
+	for i, sheet := range sheets {
+		files = append(files, struct {
+			name    string
+			content []byte
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxWorksheet(sheet, i == 0)})
+	}
+
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(f.content)
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func xlsxContentTypes(sheets int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.Bytes()
+}
+
+func xlsxWorkbook(sheets []*xlsxSheet) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), i+1, i+1)
+	}
+	b.WriteString(`</sheets><definedNames>`)
+	for i, sheet := range sheets {
+		// Excel records auto-filter ranges as hidden names
+		fmt.Fprintf(&b, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">%s</definedName>`, i, xmlEscape("'"+strings.Replace(sheet.name, "'", "''", -1)+"'!"+xlsxRange(sheet, true)))
+	}
+	b.WriteString(`</definedNames></workbook>`)
+	return b.Bytes()
+}
+
+func xlsxWorkbookRels(sheets int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.Bytes()
+}
+
+// xlsxStyles has a second cell format with a bold font, for headers
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// xlsxRange returns the range of cells in sheet, including its header, as
+// absolute references if absolute is set
+func xlsxRange(sheet *xlsxSheet, absolute bool) string {
+	last := xlsxColumn(len(sheet.header) - 1)
+	rows := strconv.Itoa(len(sheet.rows) + 1)
+	if absolute {
+		return "$A$1:$" + last + "$" + rows
+	}
+	return "A1:" + last + rows
+}
+
+func xlsxWorksheet(sheet *xlsxSheet, selected bool) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"`)
+	if selected {
+		b.WriteString(` tabSelected="1"`)
+	}
+	// the header row stays in view while scrolling
+	b.WriteString(`><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><sheetData>`)
+
+	header := make([]interface{}, len(sheet.header))
+	for i, h := range sheet.header {
+		header[i] = h
+	}
+	for r, row := range append([][]interface{}{header}, sheet.rows...) {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, v := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			style := ""
+			if r == 0 {
+				style = ` s="1"`
+			}
+			switch v := v.(type) {
+			case int64:
+				fmt.Fprintf(&b, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+			default:
+				fmt.Fprintf(&b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(fmt.Sprint(v)))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	fmt.Fprintf(&b, `</sheetData><autoFilter ref="%s"/></worksheet>`, xlsxRange(sheet, false))
+	return b.Bytes()
+}
+
+// xmlEscape escapes s for use in XML text or attributes
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}